@@ -9,6 +9,7 @@ require (
 	github.com/mark3labs/mcp-go v0.21.1
 	github.com/toqueteos/webbrowser v1.2.0
 	github.com/zerodha/gokiteconnect/v4 v4.3.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -41,5 +42,4 @@ require (
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 	google.golang.org/protobuf v1.34.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
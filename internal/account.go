@@ -0,0 +1,386 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// Account is one Kite login in the account registry, with its own API credentials,
+// token store and auth state.
+type Account struct {
+	Name string
+
+	apiKey    string
+	apiSecret string
+	store     *TokenStore
+
+	// baseURI overrides the Kite API endpoint, for tests.
+	baseURI string
+
+	kcMu sync.RWMutex
+	kc   *kiteconnect.Client
+
+	authMu     sync.Mutex
+	authState  AuthState
+	authDone   chan struct{}
+	loginState string
+	userID     string
+}
+
+func NewAccount(cfg AccountConfig) *Account {
+	var store *TokenStore
+	if cfg.TokenStorePath != "" {
+		store = NewTokenStore(cfg.TokenStorePath)
+	}
+
+	return &Account{
+		Name:      cfg.Name,
+		apiKey:    cfg.APIKey,
+		apiSecret: cfg.APISecret,
+		store:     store,
+		authState: AuthUnauthenticated,
+		authDone:  make(chan struct{}),
+	}
+}
+
+// SetKc swaps in a new Kite client. Handlers already in flight keep using the client they started with.
+func (a *Account) SetKc(kc *kiteconnect.Client) {
+	a.kcMu.Lock()
+	defer a.kcMu.Unlock()
+	a.kc = kc
+}
+
+func (a *Account) client() *kiteconnect.Client {
+	a.kcMu.RLock()
+	defer a.kcMu.RUnlock()
+	return a.kc
+}
+
+func (a *Account) AuthState() AuthState {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+	return a.authState
+}
+
+// UserID returns the Kite user ID of the logged in session, if known.
+func (a *Account) UserID() string {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+	return a.userID
+}
+
+// LoginURL returns the Kite login URL for the pending login attempt. Kite echoes the
+// state nonce back to the redirect URL so the callback can be matched to this attempt.
+func (a *Account) LoginURL() string {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+	return a.loginURLLocked()
+}
+
+// newClient returns a Kite client without an access token.
+func (a *Account) newClient() *kiteconnect.Client {
+	kc := kiteconnect.New(a.apiKey)
+	if a.baseURI != "" {
+		kc.SetBaseURI(a.baseURI)
+	}
+	return kc
+}
+
+func (a *Account) loginURLLocked() string {
+	kc := kiteconnect.New(a.apiKey)
+	if a.loginState == "" {
+		return kc.GetLoginURL()
+	}
+	return kc.GetLoginURLWithparams(url.Values{"state": {a.loginState}})
+}
+
+func newLoginState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RestoreSession reuses a persisted access token if it is still accepted by Kite.
+func (a *Account) RestoreSession() bool {
+	if a.store == nil {
+		return false
+	}
+
+	token, err := a.store.Load()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Unable to read stored access token", "account", a.Name, "error", err)
+		}
+		return false
+	}
+
+	if token.APIKey != a.apiKey || token.IsExpired(time.Now()) {
+		slog.Info("Stored access token has expired, login required", "account", a.Name)
+		return false
+	}
+
+	kc := a.newClient()
+	kc.SetAccessToken(token.AccessToken)
+	if _, err := kc.GetUserProfile(); err != nil {
+		slog.Info("Stored access token was rejected by Kite", "account", a.Name, "error", err)
+		return false
+	}
+
+	a.authenticate(kc, token.UserID)
+	slog.Info("Reusing stored access token", "account", a.Name, "user_id", token.UserID)
+	return true
+}
+
+// BeginLogin moves the account to the awaiting callback state and returns the login URL.
+// A new state nonce is generated for every attempt; calls during a pending attempt reuse it.
+func (a *Account) BeginLogin() string {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+
+	if a.authState != AuthAuthenticated && a.authState != AuthAwaitingCallback {
+		loginState, err := newLoginState()
+		if err != nil {
+			slog.Error("Unable to generate login state", "account", a.Name, "error", err)
+			return a.loginURLLocked()
+		}
+		a.loginState = loginState
+		a.authState = AuthAwaitingCallback
+	}
+	return a.loginURLLocked()
+}
+
+// AbandonLogin gives up on a pending login attempt, e.g. after the auth timeout.
+func (a *Account) AbandonLogin() {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+
+	if a.authState == AuthAwaitingCallback {
+		a.authState = AuthUnauthenticated
+		a.loginState = ""
+	}
+}
+
+// LoginPending reports whether a login attempt is waiting for its callback.
+func (a *Account) LoginPending() bool {
+	return a.AuthState() == AuthAwaitingCallback
+}
+
+// matchesLoginState reports whether the callback state belongs to this account's pending attempt.
+func (a *Account) matchesLoginState(loginState string) bool {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+
+	return a.authState == AuthAwaitingCallback && a.loginState != "" &&
+		subtle.ConstantTimeCompare([]byte(loginState), []byte(a.loginState)) == 1
+}
+
+// claimLogin checks the callback state against the pending attempt and consumes it,
+// so a request token can only be exchanged once per attempt.
+func (a *Account) claimLogin(loginState string) error {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+
+	if a.authState != AuthAwaitingCallback || a.loginState == "" {
+		return ErrNoLoginPending
+	}
+	if subtle.ConstantTimeCompare([]byte(loginState), []byte(a.loginState)) != 1 {
+		return ErrLoginStateInvalid
+	}
+	a.loginState = ""
+	return nil
+}
+
+// CompleteLogin exchanges the request token from the Kite redirect for an access token.
+// The state must match the nonce of the pending login attempt.
+func (a *Account) CompleteLogin(requestToken, loginState string) error {
+	if requestToken == "" {
+		return errors.New("request token is required")
+	}
+	if err := a.claimLogin(loginState); err != nil {
+		return err
+	}
+	return a.exchangeRequestToken(requestToken)
+}
+
+// completeLoginWithoutState exchanges a request token typed by the operator, which carries no
+// state. It still needs a pending attempt, which it consumes like claimLogin.
+func (a *Account) completeLoginWithoutState(requestToken string) error {
+	if requestToken == "" {
+		return errors.New("request token is required")
+	}
+	a.authMu.Lock()
+	if a.authState != AuthAwaitingCallback {
+		a.authMu.Unlock()
+		return ErrNoLoginPending
+	}
+	a.loginState = ""
+	a.authMu.Unlock()
+	return a.exchangeRequestToken(requestToken)
+}
+
+func (a *Account) exchangeRequestToken(requestToken string) error {
+	kc := a.newClient()
+	data, err := kc.GenerateSession(requestToken, a.apiSecret)
+	if err != nil {
+		a.AbandonLogin()
+		return err
+	}
+	kc.SetAccessToken(data.AccessToken)
+
+	if a.store != nil {
+		if err := a.store.Save(NewStoredToken(a.apiKey, data)); err != nil {
+			slog.Warn("Unable to persist access token", "account", a.Name, "error", err)
+		}
+	}
+
+	a.authenticate(kc, data.UserID)
+	return nil
+}
+
+func (a *Account) authenticate(kc *kiteconnect.Client, userID string) {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+
+	a.SetKc(kc)
+	a.userID = userID
+	a.loginState = ""
+	if a.authState != AuthAuthenticated {
+		a.authState = AuthAuthenticated
+		close(a.authDone)
+	}
+}
+
+// MarkExpired drops the current session after Kite rejected its access token.
+func (a *Account) MarkExpired() {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+
+	if a.authState != AuthAuthenticated {
+		return
+	}
+	a.authState = AuthExpired
+	a.authDone = make(chan struct{})
+
+	if a.store != nil {
+		if err := a.store.Clear(); err != nil {
+			slog.Warn("Unable to clear stored access token", "account", a.Name, "error", err)
+		}
+	}
+	slog.Warn("Kite access token expired, login required", "account", a.Name)
+}
+
+// WaitForLogin blocks until the account is authenticated or ctx is done.
+func (a *Account) WaitForLogin(ctx context.Context) error {
+	a.authMu.Lock()
+	done := a.authDone
+	a.authMu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Account returns the named account, or the default account when name is empty.
+func (z *ZerodhaMcpServer) Account(name string) (*Account, error) {
+	if name == "" {
+		return z.defaultAccount, nil
+	}
+	for _, account := range z.accounts {
+		if account.Name == name {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown account %q, use list_accounts to see configured accounts", name)
+}
+
+// DefaultAccount is used by tool calls that do not name an account.
+func (z *ZerodhaMcpServer) DefaultAccount() *Account {
+	return z.defaultAccount
+}
+
+func (z *ZerodhaMcpServer) Accounts() []*Account {
+	return z.accounts
+}
+
+// LoginPending reports whether any account is waiting for its login callback.
+func (z *ZerodhaMcpServer) LoginPending() bool {
+	for _, account := range z.accounts {
+		if account.LoginPending() {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteLogin routes a login callback to the account whose pending attempt issued the state.
+func (z *ZerodhaMcpServer) CompleteLogin(requestToken, loginState string) error {
+	for _, account := range z.accounts {
+		if account.matchesLoginState(loginState) {
+			return account.CompleteLogin(requestToken, loginState)
+		}
+	}
+	if !z.LoginPending() {
+		return ErrNoLoginPending
+	}
+	return ErrLoginStateInvalid
+}
+
+// CompletePastedLogin finishes a login from a redirect URL pasted into the complete_login tool, for
+// machines where the browser cannot reach the callback listener. Any MCP client can call the tool,
+// so the URL must carry the state of a pending attempt, exactly like the callback.
+func (z *ZerodhaMcpServer) CompletePastedLogin(input string) (*Account, error) {
+	requestToken, loginState, err := parseLoginInput(input)
+	if err != nil {
+		return nil, err
+	}
+	if loginState == "" {
+		return nil, ErrLoginStateMissing
+	}
+	return z.completeLoginWithState(requestToken, loginState)
+}
+
+// CompletePromptedLogin finishes a login typed at the terminal prompt. Only the operator can type
+// there, so a bare request token is accepted as well, for a pending attempt of the named account.
+func (z *ZerodhaMcpServer) CompletePromptedLogin(accountName, input string) (*Account, error) {
+	requestToken, loginState, err := parseLoginInput(input)
+	if err != nil {
+		return nil, err
+	}
+	if loginState != "" {
+		return z.completeLoginWithState(requestToken, loginState)
+	}
+
+	account, err := z.Account(accountName)
+	if err != nil {
+		return nil, err
+	}
+	return account, account.completeLoginWithoutState(requestToken)
+}
+
+func (z *ZerodhaMcpServer) completeLoginWithState(requestToken, loginState string) (*Account, error) {
+	for _, account := range z.accounts {
+		if account.matchesLoginState(loginState) {
+			return account, account.CompleteLogin(requestToken, loginState)
+		}
+	}
+	if !z.LoginPending() {
+		return nil, ErrNoLoginPending
+	}
+	return nil, ErrLoginStateInvalid
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// AllAccounts is the account argument value that aggregates a tool across every account.
+const AllAccounts = "all"
+
+// aggregateTools accept account=all.
+var aggregateTools = map[string]bool{
+	"get_kite_holdings": true,
+	"get_positions":     true,
+	"get_user_margins":  true,
+}
+
+// SkippedAccount is an account left out of an aggregated result.
+type SkippedAccount struct {
+	Account string `json:"account"`
+	Reason  string `json:"reason"`
+}
+
+// AggregatedHolding is one instrument held across accounts.
+type AggregatedHolding struct {
+	Tradingsymbol       string   `json:"tradingsymbol"`
+	Exchange            string   `json:"exchange"`
+	ISIN                string   `json:"isin"`
+	Quantity            int      `json:"quantity"`
+	AveragePrice        float64  `json:"average_price"`
+	LastPrice           float64  `json:"last_price"`
+	InvestedValue       float64  `json:"invested_value"`
+	CurrentValue        float64  `json:"current_value"`
+	PnL                 float64  `json:"pnl"`
+	DayChangePercentage float64  `json:"day_change_percentage"`
+	Accounts            []string `json:"accounts"`
+}
+
+// AggregatedPosition is one net position summed across accounts.
+type AggregatedPosition struct {
+	Tradingsymbol string   `json:"tradingsymbol"`
+	Exchange      string   `json:"exchange"`
+	Product       string   `json:"product"`
+	Quantity      int      `json:"quantity"`
+	LastPrice     float64  `json:"last_price"`
+	Value         float64  `json:"value"`
+	PnL           float64  `json:"pnl"`
+	M2M           float64  `json:"m2m"`
+	Realised      float64  `json:"realised"`
+	Unrealised    float64  `json:"unrealised"`
+	Accounts      []string `json:"accounts"`
+}
+
+// AggregatedMargins is one margin segment summed across accounts.
+type AggregatedMargins struct {
+	Segment        string   `json:"segment"`
+	Net            float64  `json:"net"`
+	AvailableCash  float64  `json:"available_cash"`
+	OpeningBalance float64  `json:"opening_balance"`
+	Collateral     float64  `json:"collateral"`
+	UsedDebits     float64  `json:"used_debits"`
+	Accounts       []string `json:"accounts"`
+}
+
+func isAllAccounts(request mcp.CallToolRequest) bool {
+	name, _ := request.Params.Arguments[accountArg].(string)
+	return name == AllAccounts
+}
+
+// aggregateResult is the body of a tool result aggregated across accounts.
+type aggregateResult[T any] struct {
+	Rows            []T              `json:"rows"`
+	SkippedAccounts []SkippedAccount `json:"skipped_accounts"`
+}
+
+func aggregateSummary(rows int, noun string, skipped []SkippedAccount) string {
+	summary := countSummary(rows, noun) + " across all accounts"
+	if len(skipped) > 0 {
+		names := make([]string, 0, len(skipped))
+		for _, skip := range skipped {
+			names = append(names, skip.Account)
+		}
+		summary += fmt.Sprintf(", skipped %s", strings.Join(names, ", "))
+	}
+	return summary + "."
+}
+
+// eachAuthenticatedAccount calls fn for every logged in account. Accounts that are not logged in,
+// or whose token Kite rejects, are reported as skipped instead of failing the whole call.
+func (z *ZerodhaMcpServer) eachAuthenticatedAccount(fn func(account *Account, kc *kiteconnect.Client) error) ([]SkippedAccount, error) {
+	var skipped []SkippedAccount
+	for _, account := range z.accounts {
+		if state := account.AuthState(); state != AuthAuthenticated {
+			skipped = append(skipped, SkippedAccount{Account: account.Name, Reason: "login required (" + state.String() + ")"})
+			continue
+		}
+
+		if err := fn(account, account.client()); err != nil {
+			if !isTokenError(err) {
+				return nil, fmt.Errorf("account %s: %w", account.Name, err)
+			}
+			account.MarkExpired()
+			skipped = append(skipped, SkippedAccount{Account: account.Name, Reason: "login required (expired)"})
+		}
+	}
+	return skipped, nil
+}
+
+func (z *ZerodhaMcpServer) aggregateHoldings() ([]AggregatedHolding, []SkippedAccount, error) {
+	byInstrument := map[string]*AggregatedHolding{}
+	skipped, err := z.eachAuthenticatedAccount(func(account *Account, kc *kiteconnect.Client) error {
+		holdings, err := kc.GetHoldings()
+		if err != nil {
+			return err
+		}
+		for _, holding := range holdings {
+			key := holding.Exchange + ":" + holding.Tradingsymbol
+			agg, ok := byInstrument[key]
+			if !ok {
+				agg = &AggregatedHolding{
+					Tradingsymbol: holding.Tradingsymbol,
+					Exchange:      holding.Exchange,
+					ISIN:          holding.ISIN,
+				}
+				byInstrument[key] = agg
+			}
+			agg.Quantity += holding.Quantity
+			agg.LastPrice = holding.LastPrice
+			agg.DayChangePercentage = holding.DayChangePercentage
+			agg.InvestedValue += holding.AveragePrice * float64(holding.Quantity)
+			agg.CurrentValue += holding.LastPrice * float64(holding.Quantity)
+			agg.PnL += holding.PnL
+			agg.Accounts = append(agg.Accounts, account.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	holdings := make([]AggregatedHolding, 0, len(byInstrument))
+	for _, agg := range byInstrument {
+		if agg.Quantity != 0 {
+			agg.AveragePrice = agg.InvestedValue / float64(agg.Quantity)
+		}
+		holdings = append(holdings, *agg)
+	}
+	sort.Slice(holdings, func(i, j int) bool {
+		return holdings[i].Exchange+":"+holdings[i].Tradingsymbol < holdings[j].Exchange+":"+holdings[j].Tradingsymbol
+	})
+	return holdings, skipped, nil
+}
+
+func (z *ZerodhaMcpServer) aggregatePositions() ([]AggregatedPosition, []SkippedAccount, error) {
+	byInstrument := map[string]*AggregatedPosition{}
+	skipped, err := z.eachAuthenticatedAccount(func(account *Account, kc *kiteconnect.Client) error {
+		positions, err := kc.GetPositions()
+		if err != nil {
+			return err
+		}
+		for _, position := range positions.Net {
+			key := position.Exchange + ":" + position.Tradingsymbol + ":" + position.Product
+			agg, ok := byInstrument[key]
+			if !ok {
+				agg = &AggregatedPosition{
+					Tradingsymbol: position.Tradingsymbol,
+					Exchange:      position.Exchange,
+					Product:       position.Product,
+				}
+				byInstrument[key] = agg
+			}
+			agg.Quantity += position.Quantity
+			agg.LastPrice = position.LastPrice
+			agg.Value += position.Value
+			agg.PnL += position.PnL
+			agg.M2M += position.M2M
+			agg.Realised += position.Realised
+			agg.Unrealised += position.Unrealised
+			agg.Accounts = append(agg.Accounts, account.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	positions := make([]AggregatedPosition, 0, len(byInstrument))
+	for _, agg := range byInstrument {
+		positions = append(positions, *agg)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		return a.Exchange+":"+a.Tradingsymbol+":"+a.Product < b.Exchange+":"+b.Tradingsymbol+":"+b.Product
+	})
+	return positions, skipped, nil
+}
+
+func (z *ZerodhaMcpServer) aggregateMargins() ([]AggregatedMargins, []SkippedAccount, error) {
+	equity := AggregatedMargins{Segment: "equity"}
+	commodity := AggregatedMargins{Segment: "commodity"}
+	add := func(agg *AggregatedMargins, account string, margins kiteconnect.Margins) {
+		if !margins.Enabled {
+			return
+		}
+		agg.Net += margins.Net
+		agg.AvailableCash += margins.Available.Cash
+		agg.OpeningBalance += margins.Available.OpeningBalance
+		agg.Collateral += margins.Available.Collateral
+		agg.UsedDebits += margins.Used.Debits
+		agg.Accounts = append(agg.Accounts, account)
+	}
+
+	skipped, err := z.eachAuthenticatedAccount(func(account *Account, kc *kiteconnect.Client) error {
+		margins, err := kc.GetUserMargins()
+		if err != nil {
+			return err
+		}
+		add(&equity, account.Name, margins.Equity)
+		add(&commodity, account.Name, margins.Commodity)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []AggregatedMargins{equity, commodity}, skipped, nil
+}
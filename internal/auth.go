@@ -0,0 +1,284 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// AuthState is the Kite login state of an account.
+type AuthState int
+
+const (
+	AuthUnauthenticated AuthState = iota
+	AuthAwaitingCallback
+	AuthAuthenticated
+	AuthExpired
+)
+
+func (s AuthState) String() string {
+	switch s {
+	case AuthUnauthenticated:
+		return "unauthenticated"
+	case AuthAwaitingCallback:
+		return "awaiting_callback"
+	case AuthAuthenticated:
+		return "authenticated"
+	case AuthExpired:
+		return "expired"
+	default:
+		return fmt.Sprintf("AuthState(%d)", int(s))
+	}
+}
+
+const (
+	loginToolName         = "login"
+	completeLoginToolName = "complete_login"
+	listAccountsToolName  = "list_accounts"
+
+	// accountArg selects the account a tool call runs against.
+	accountArg = "account"
+)
+
+var (
+	ErrNoLoginPending    = errors.New("no login in progress")
+	ErrLoginStateInvalid = errors.New("login state does not match the pending login")
+	ErrLoginStateMissing = errors.New("the redirect URL has no state, paste the full URL the browser was redirected to")
+)
+
+// publicTools can be called before the account is authenticated.
+var publicTools = map[string]bool{
+	loginToolName:         true,
+	completeLoginToolName: true,
+	listAccountsToolName:  true,
+}
+
+// authStatus is the body of the login tool result and of the login required result that
+// every other tool returns while the account has no usable Kite session.
+type authStatus struct {
+	Error     string `json:"error,omitempty"`
+	Account   string `json:"account"`
+	AuthState string `json:"auth_state"`
+	UserID    string `json:"user_id,omitempty"`
+	LoginURL  string `json:"login_url,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Default   bool   `json:"default,omitempty"`
+}
+
+type accountContextKey struct{}
+
+// client returns the Kite client of the account the middleware resolved for this call.
+func (z *ZerodhaMcpServer) client(ctx context.Context) *kiteconnect.Client {
+	return z.accountFor(ctx).client()
+}
+
+// accountFor returns the account the middleware resolved for this call.
+func (z *ZerodhaMcpServer) accountFor(ctx context.Context) *Account {
+	if account, ok := ctx.Value(accountContextKey{}).(*Account); ok {
+		return account
+	}
+	return z.DefaultAccount()
+}
+
+// parseLoginInput accepts either the full redirect URL or just the request token.
+func parseLoginInput(input string) (requestToken, loginState string, err error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", "", errors.New("redirect URL or request token is required")
+	}
+	if !strings.Contains(input, "request_token=") {
+		return input, "", nil
+	}
+
+	query := input
+	if u, err := url.Parse(input); err == nil && u.RawQuery != "" {
+		query = u.RawQuery
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(query, "?"))
+	if err != nil {
+		return "", "", fmt.Errorf("parse redirect URL: %w", err)
+	}
+	if values.Get("request_token") == "" {
+		return "", "", errors.New("redirect URL has no request_token")
+	}
+	return values.Get("request_token"), values.Get("state"), nil
+}
+
+// AuthMiddleware resolves the account of a tool call and short-circuits with a login required result
+// until that account is authenticated. It also expires the session when Kite rejects the access token.
+// With account=all, a login is only required when no account is authenticated.
+func (z *ZerodhaMcpServer) AuthMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if publicTools[request.Params.Name] {
+			return next(ctx, request)
+		}
+
+		name, _ := request.Params.Arguments[accountArg].(string)
+		if name == AllAccounts {
+			if !aggregateTools[request.Params.Name] {
+				return mcp.NewToolResultError(fmt.Sprintf("%s does not support account=%s", request.Params.Name, AllAccounts)), nil
+			}
+			// Aggregating handlers skip the accounts that are not logged in, or whose token Kite
+			// rejects, and list them in skipped_accounts. Only when that leaves no account is the
+			// call answered with a login required result, as for a single account.
+			if account := z.loginRequiredAccount(); account != nil {
+				return loginRequiredResult(account)
+			}
+			result, err := next(ctx, request)
+			if account := z.loginRequiredAccount(); account != nil {
+				return loginRequiredResult(account)
+			}
+			return result, err
+		}
+
+		account, err := z.Account(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if account.AuthState() != AuthAuthenticated {
+			return loginRequiredResult(account)
+		}
+
+		result, err := next(context.WithValue(ctx, accountContextKey{}, account), request)
+		if isTokenError(err) {
+			account.MarkExpired()
+			return loginRequiredResult(account)
+		}
+		return result, err
+	}
+}
+
+// loginRequiredAccount returns the default account to log in when no account is authenticated,
+// and nil when at least one is.
+func (z *ZerodhaMcpServer) loginRequiredAccount() *Account {
+	for _, account := range z.accounts {
+		if account.AuthState() == AuthAuthenticated {
+			return nil
+		}
+	}
+	return z.defaultAccount
+}
+
+func isTokenError(err error) bool {
+	var kiteErr kiteconnect.Error
+	return errors.As(err, &kiteErr) && kiteErr.ErrorType == kiteconnect.TokenError
+}
+
+func (z *ZerodhaMcpServer) requestAccount(request mcp.CallToolRequest) (*Account, error) {
+	name, _ := request.Params.Arguments[accountArg].(string)
+	return z.Account(name)
+}
+
+// Login returns the Kite login URL and optionally waits for the /auth callback to complete.
+func (z *ZerodhaMcpServer) Login() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		account, err := z.requestAccount(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		wait, _ := request.Params.Arguments["wait"].(bool)
+
+		if account.AuthState() == AuthAuthenticated {
+			return authStatusResult(account, "Already logged in to Zerodha.")
+		}
+
+		loginURL := account.BeginLogin()
+		slog.Info("Login requested", "account", account.Name, "login_url", loginURL)
+		if z.headless {
+			return authStatusResult(account, "Ask the user to open login_url in a browser, log in, and paste back the URL they are redirected to. Then call complete_login with it.")
+		}
+		if !wait {
+			return authStatusResult(account, "Ask the user to open login_url in a browser, then call login again with wait=true.")
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, z.authTimeout)
+		defer cancel()
+
+		if err := account.WaitForLogin(waitCtx); err != nil {
+			return authStatusResult(account, "Timed out waiting for the Kite login to complete. Call login again to retry.")
+		}
+		return authStatusResult(account, "Zerodha login completed.")
+	}
+}
+
+// ManualLogin completes a login from a pasted redirect URL. Unlike the terminal prompt, the tool can
+// be called by any MCP client, so the URL must carry the state of a pending login attempt.
+func (z *ZerodhaMcpServer) ManualLogin() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		input, _ := request.Params.Arguments["redirect_url"].(string)
+
+		account, err := z.CompletePastedLogin(input)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Unable to complete login: %v", err)), nil
+		}
+		return authStatusResult(account, "Zerodha login completed.")
+	}
+}
+
+// ListAccounts reports the auth state of every configured account.
+func (z *ZerodhaMcpServer) ListAccounts() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		statuses := make([]authStatus, 0, len(z.accounts))
+		for _, account := range z.accounts {
+			status := newAuthStatus(account)
+			status.Default = account == z.DefaultAccount()
+			statuses = append(statuses, status)
+		}
+
+		body, err := json.Marshal(statuses)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(string(body)), nil
+	}
+}
+
+func newAuthStatus(account *Account) authStatus {
+	status := authStatus{
+		Account:   account.Name,
+		AuthState: account.AuthState().String(),
+	}
+	switch account.AuthState() {
+	case AuthAuthenticated:
+		status.UserID = account.UserID()
+	case AuthAwaitingCallback:
+		status.LoginURL = account.LoginURL()
+	}
+	return status
+}
+
+func authStatusResult(account *Account, message string) (*mcp.CallToolResult, error) {
+	status := newAuthStatus(account)
+	status.Message = message
+
+	body, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(body)), nil
+}
+
+func loginRequiredResult(account *Account) (*mcp.CallToolResult, error) {
+	// Report the state that caused the failure, e.g. expired, before moving to awaiting callback.
+	state := account.AuthState()
+	loginURL := account.BeginLogin()
+	body, err := json.Marshal(authStatus{
+		Error:     "login_required",
+		Account:   account.Name,
+		AuthState: state.String(),
+		LoginURL:  loginURL,
+		Message:   fmt.Sprintf("Zerodha login required for account %s. Ask the user to open login_url in a browser and complete the Kite login, then retry.", account.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultError(string(body)), nil
+}
@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// newLoginServer returns a server with one account per name whose request tokens are exchanged by
+// a fake Kite session endpoint, which accepts every token but "rejected".
+func newLoginServer(t *testing.T, names ...string) *ZerodhaMcpServer {
+	t.Helper()
+	baseURI := newKiteServer(t, kiteRoutes{
+		kiteconnect.URIUserSession: func(r *http.Request) any {
+			if r.FormValue("request_token") == "rejected" {
+				return nil
+			}
+			return map[string]any{"user_id": "AB1234", "access_token": "access-" + r.FormValue("request_token")}
+		},
+	})
+
+	z := &ZerodhaMcpServer{}
+	for _, name := range names {
+		account := NewAccount(AccountConfig{Name: name, APIKey: "key-" + name, APISecret: "secret"})
+		account.baseURI = baseURI
+		z.accounts = append(z.accounts, account)
+	}
+	z.defaultAccount = z.accounts[0]
+	return z
+}
+
+// loginStateOf returns the state nonce carried by the login URL of a pending attempt.
+func loginStateOf(t *testing.T, loginURL string) string {
+	t.Helper()
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := url.ParseQuery(u.Query().Get("redirect_params"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redirect.Get("state")
+}
+
+func TestParseLoginInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantToken string
+		wantState string
+		wantErr   string
+	}{
+		{name: "bare token", input: "  abc123 \n", wantToken: "abc123"},
+		{name: "full URL", input: "http://127.0.0.1:5888/auth?action=login&type=login&status=success&request_token=abc123&state=s1", wantToken: "abc123", wantState: "s1"},
+		{name: "URL without state", input: "http://127.0.0.1:5888/auth?request_token=abc123", wantToken: "abc123"},
+		{name: "query string only", input: "?request_token=abc123&state=s1", wantToken: "abc123", wantState: "s1"},
+		{name: "query without the question mark", input: "status=success&request_token=abc123", wantToken: "abc123"},
+		{name: "empty", input: "   ", wantErr: "is required"},
+		{name: "empty request_token", input: "http://127.0.0.1:5888/auth?request_token=&state=s1", wantErr: "has no request_token"},
+		{name: "bad escape", input: "request_token=%zz", wantErr: "parse redirect URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, state, err := parseLoginInput(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || token != tt.wantToken || state != tt.wantState {
+				t.Errorf("got %q, %q, %v; want %q, %q", token, state, err, tt.wantToken, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCompletePastedLogin(t *testing.T) {
+	z := newLoginServer(t, "main")
+	account := z.DefaultAccount()
+	state := loginStateOf(t, account.BeginLogin())
+
+	for _, input := range []string{"abc123", "http://127.0.0.1:5888/auth?request_token=abc123"} {
+		if _, err := z.CompletePastedLogin(input); !errors.Is(err, ErrLoginStateMissing) {
+			t.Errorf("CompletePastedLogin(%q) = %v, want %v", input, err, ErrLoginStateMissing)
+		}
+	}
+	if _, err := z.CompletePastedLogin("http://127.0.0.1:5888/auth?request_token=abc123&state=other"); !errors.Is(err, ErrLoginStateInvalid) {
+		t.Errorf("wrong state: got %v, want %v", err, ErrLoginStateInvalid)
+	}
+	if !account.LoginPending() {
+		t.Fatal("a rejected paste ended the pending login")
+	}
+
+	got, err := z.CompletePastedLogin("http://127.0.0.1:5888/auth?request_token=abc123&state=" + state)
+	if err != nil || got != account {
+		t.Fatalf("got %v, %v; want the main account", got, err)
+	}
+	if account.AuthState() != AuthAuthenticated || account.UserID() != "AB1234" {
+		t.Errorf("account is %s as %q", account.AuthState(), account.UserID())
+	}
+	if _, err := z.CompletePastedLogin("http://127.0.0.1:5888/auth?request_token=abc123&state=" + state); !errors.Is(err, ErrNoLoginPending) {
+		t.Errorf("reusing the URL: got %v, want %v", err, ErrNoLoginPending)
+	}
+}
+
+func TestCompletePromptedLogin(t *testing.T) {
+	z := newLoginServer(t, "main", "family")
+	main, family := z.accounts[0], z.accounts[1]
+
+	if _, err := z.CompletePromptedLogin("", "abc123"); !errors.Is(err, ErrNoLoginPending) {
+		t.Fatalf("token without a pending login: got %v, want %v", err, ErrNoLoginPending)
+	}
+	if main.AuthState() != AuthUnauthenticated {
+		t.Fatalf("account is %s", main.AuthState())
+	}
+
+	// A bare token completes the pending login of the named account only
+	family.BeginLogin()
+	if _, err := z.CompletePromptedLogin("", "abc123"); !errors.Is(err, ErrNoLoginPending) {
+		t.Errorf("token for the default account: got %v, want %v", err, ErrNoLoginPending)
+	}
+	if _, err := z.CompletePromptedLogin("nobody", "abc123"); err == nil || !strings.Contains(err.Error(), "unknown account") {
+		t.Errorf("token for an unknown account: got %v", err)
+	}
+	got, err := z.CompletePromptedLogin("family", "abc123")
+	if err != nil || got != family || family.AuthState() != AuthAuthenticated {
+		t.Fatalf("got %v, %v with the account %s", got, err, family.AuthState())
+	}
+	if _, err := z.CompletePromptedLogin("family", "abc123"); !errors.Is(err, ErrNoLoginPending) {
+		t.Errorf("reusing the token: got %v, want %v", err, ErrNoLoginPending)
+	}
+
+	// A pasted URL is routed by its state, whatever the account
+	state := loginStateOf(t, main.BeginLogin())
+	got, err = z.CompletePromptedLogin("family", "?request_token=abc123&state="+state)
+	if err != nil || got != main || main.AuthState() != AuthAuthenticated {
+		t.Errorf("got %v, %v with the account %s", got, err, main.AuthState())
+	}
+}
+
+func TestCompletePromptedLoginRejected(t *testing.T) {
+	z := newLoginServer(t, "main")
+	account := z.DefaultAccount()
+	account.BeginLogin()
+
+	if _, err := z.CompletePromptedLogin("", "rejected"); err == nil {
+		t.Fatal("a token rejected by Kite logged in")
+	}
+	// The attempt is given up, so the rejected token cannot be retried against it
+	if account.AuthState() != AuthUnauthenticated {
+		t.Errorf("account is %s, want %s", account.AuthState(), AuthUnauthenticated)
+	}
+}
+
+func TestBeginLogin(t *testing.T) {
+	z := newLoginServer(t, "main")
+	account := z.DefaultAccount()
+
+	first := account.BeginLogin()
+	state := loginStateOf(t, first)
+	if len(state) != 32 || account.AuthState() != AuthAwaitingCallback {
+		t.Fatalf("state %q with the account %s", state, account.AuthState())
+	}
+	// Asking again while the attempt is pending hands out the same nonce
+	if again := account.BeginLogin(); again != first || account.LoginURL() != first {
+		t.Errorf("pending login URL changed from %s to %s", first, again)
+	}
+
+	account.AbandonLogin()
+	if account.AuthState() != AuthUnauthenticated || account.LoginPending() {
+		t.Fatalf("abandoned login is %s", account.AuthState())
+	}
+	if next := loginStateOf(t, account.BeginLogin()); next == "" || next == state {
+		t.Errorf("new attempt reused the nonce %q", next)
+	}
+}
+
+func TestClaimLogin(t *testing.T) {
+	tests := []struct {
+		name string
+		// claim returns the state to claim, given the nonce of the pending attempt, if any.
+		claim func(account *Account, state string) string
+		want  error
+	}{
+		{name: "pending nonce", claim: func(_ *Account, state string) string { return state }},
+		{name: "wrong state", claim: func(_ *Account, state string) string { return state[1:] + "0" }, want: ErrLoginStateInvalid},
+		{name: "empty state", claim: func(*Account, string) string { return "" }, want: ErrLoginStateInvalid},
+		{
+			name: "no pending login",
+			claim: func(account *Account, state string) string {
+				account.AbandonLogin()
+				return state
+			},
+			want: ErrNoLoginPending,
+		},
+		{
+			name: "already authenticated",
+			claim: func(account *Account, state string) string {
+				account.authenticate(kiteconnect.New("key"), "AB1234")
+				return state
+			},
+			want: ErrNoLoginPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := NewAccount(AccountConfig{Name: "main", APIKey: "key"})
+			state := loginStateOf(t, account.BeginLogin())
+
+			if err := account.claimLogin(tt.claim(account, state)); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			// A claimed nonce is consumed, a rejected claim leaves it pending
+			err := account.claimLogin(state)
+			switch {
+			case tt.want == nil && !errors.Is(err, ErrNoLoginPending):
+				t.Errorf("claiming the nonce twice: got %v, want %v", err, ErrNoLoginPending)
+			case tt.want == ErrLoginStateInvalid && err != nil:
+				t.Errorf("claiming the nonce after a wrong state: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompleteLoginRouting(t *testing.T) {
+	z := newLoginServer(t, "main", "family")
+	main, family := z.accounts[0], z.accounts[1]
+
+	if err := z.CompleteLogin("abc123", "anything"); !errors.Is(err, ErrNoLoginPending) {
+		t.Fatalf("callback without a pending login: got %v, want %v", err, ErrNoLoginPending)
+	}
+
+	mainState := loginStateOf(t, main.BeginLogin())
+	familyState := loginStateOf(t, family.BeginLogin())
+	if err := z.CompleteLogin("abc123", "anything"); !errors.Is(err, ErrLoginStateInvalid) {
+		t.Errorf("callback with a wrong state: got %v, want %v", err, ErrLoginStateInvalid)
+	}
+	if err := z.CompleteLogin("", familyState); err == nil {
+		t.Error("callback without a request token was accepted")
+	}
+
+	if err := z.CompleteLogin("abc123", familyState); err != nil {
+		t.Fatal(err)
+	}
+	if family.AuthState() != AuthAuthenticated || main.AuthState() != AuthAwaitingCallback {
+		t.Fatalf("family is %s and main is %s", family.AuthState(), main.AuthState())
+	}
+	// Replaying the callback of a completed login fails, while the other account still waits for its own
+	if err := z.CompleteLogin("abc123", familyState); !errors.Is(err, ErrLoginStateInvalid) {
+		t.Errorf("replayed callback: got %v, want %v", err, ErrLoginStateInvalid)
+	}
+	if err := z.CompleteLogin("abc123", mainState); err != nil || main.AuthState() != AuthAuthenticated {
+		t.Fatalf("got %v with main %s", err, main.AuthState())
+	}
+	if err := z.CompleteLogin("abc123", mainState); !errors.Is(err, ErrNoLoginPending) {
+		t.Errorf("replayed callback after every login: got %v, want %v", err, ErrNoLoginPending)
+	}
+}
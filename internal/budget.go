@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	cursorArg    = "cursor"
+	maxBytesArg  = "max_bytes"
+	maxTokensArg = "max_tokens"
+
+	// bytesPerToken is a rough estimate for JSON and tables, good enough to size a page.
+	bytesPerToken = 4
+)
+
+// requestBudget returns the maximum size of a list result in bytes, 0 for no limit. The call can
+// override the configured budget with max_bytes or max_tokens; when both are given the smaller wins.
+func (z *ZerodhaMcpServer) requestBudget(request mcp.CallToolRequest) (int, error) {
+	maxBytes, err := intArg(request.Params.Arguments, maxBytesArg)
+	if err != nil {
+		return 0, err
+	}
+	maxTokens, err := intArg(request.Params.Arguments, maxTokensArg)
+	if err != nil {
+		return 0, err
+	}
+
+	budget := z.responseBudget
+	switch {
+	case maxBytes > 0 && maxTokens > 0:
+		budget = min(maxBytes, maxTokens*bytesPerToken)
+	case maxBytes > 0:
+		budget = maxBytes
+	case maxTokens > 0:
+		budget = maxTokens * bytesPerToken
+	}
+	return budget, nil
+}
+
+// encodeCursor returns the cursor of the page that starts at row next. The cursor carries a
+// fingerprint of the call arguments so it cannot be replayed against a different query.
+func encodeCursor(request mcp.CallToolRequest, next int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(next) + "." + cursorFingerprint(request)))
+}
+
+// decodeCursor returns the first row of the page the cursor points to, 0 without a cursor.
+func decodeCursor(request mcp.CallToolRequest) (int, error) {
+	cursor, _ := request.Params.Arguments[cursorArg].(string)
+	if cursor == "" {
+		return 0, nil
+	}
+
+	invalid := errors.New("cursor is invalid, repeat the call without a cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalid
+	}
+	offset, fingerprint, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return 0, invalid
+	}
+	start, err := strconv.Atoi(offset)
+	if err != nil || start < 0 {
+		return 0, invalid
+	}
+	if fingerprint != cursorFingerprint(request) {
+		return 0, errors.New("cursor belongs to a call with different arguments, pass the same arguments as the call that returned it")
+	}
+	return start, nil
+}
+
+// cursorFingerprint hashes the tool name and every argument that shapes the rows.
+// The page size arguments are left out so they can change between pages.
+func cursorFingerprint(request mcp.CallToolRequest) string {
+	return argsFingerprint(request, cursorArg, maxBytesArg, maxTokensArg)
+}
+
+// argsFingerprint hashes the tool name and arguments of a call, leaving out the skipped arguments.
+func argsFingerprint(request mcp.CallToolRequest, skip ...string) string {
+	args := make(map[string]any, len(request.Params.Arguments))
+	for name, value := range request.Params.Arguments {
+		if !slices.Contains(skip, name) {
+			args[name] = value
+		}
+	}
+	body, _ := json.Marshal(args)
+	sum := sha256.Sum256(append([]byte(request.Params.Name+"\x00"), body...))
+	return hex.EncodeToString(sum[:8])
+}
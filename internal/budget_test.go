@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+func toolRequest(name string, args map[string]any) mcp.CallToolRequest {
+	request := callRequest(args)
+	request.Params.Name = name
+	return request
+}
+
+func TestCursor(t *testing.T) {
+	issued := toolRequest("get_positions", map[string]any{filterArg: "pnl<0", maxBytesArg: float64(1000)})
+	cursor := encodeCursor(issued, 42)
+
+	tests := []struct {
+		name    string
+		request mcp.CallToolRequest
+		want    int
+		wantErr string
+	}{
+		{name: "no cursor", request: toolRequest("get_positions", map[string]any{filterArg: "pnl<0"}), want: 0},
+		{
+			name:    "same arguments",
+			request: toolRequest("get_positions", map[string]any{filterArg: "pnl<0", maxBytesArg: float64(1000), cursorArg: cursor}),
+			want:    42,
+		},
+		{
+			name:    "page size may change",
+			request: toolRequest("get_positions", map[string]any{filterArg: "pnl<0", maxTokensArg: float64(50), cursorArg: cursor}),
+			want:    42,
+		},
+		{
+			name:    "different filter",
+			request: toolRequest("get_positions", map[string]any{filterArg: "pnl>0", maxBytesArg: float64(1000), cursorArg: cursor}),
+			wantErr: "different arguments",
+		},
+		{
+			name:    "extra argument",
+			request: toolRequest("get_positions", map[string]any{filterArg: "pnl<0", sortByArg: "pnl", cursorArg: cursor}),
+			wantErr: "different arguments",
+		},
+		{
+			name:    "different tool",
+			request: toolRequest("get_kite_holdings", map[string]any{filterArg: "pnl<0", cursorArg: cursor}),
+			wantErr: "different arguments",
+		},
+		{
+			name:    "not base64",
+			request: toolRequest("get_positions", map[string]any{filterArg: "pnl<0", cursorArg: "not a cursor!"}),
+			wantErr: "cursor is invalid",
+		},
+		{
+			name:    "no fingerprint",
+			request: toolRequest("get_positions", map[string]any{filterArg: "pnl<0", cursorArg: "NDI"}),
+			wantErr: "cursor is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.request)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %d, %v; want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %d, %v; want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestBudget(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]any
+		want int
+	}{
+		{name: "configured", args: map[string]any{}, want: 4096},
+		{name: "max_bytes", args: map[string]any{maxBytesArg: float64(100)}, want: 100},
+		{name: "max_tokens", args: map[string]any{maxTokensArg: float64(100)}, want: 100 * bytesPerToken},
+		{name: "smaller of both", args: map[string]any{maxBytesArg: float64(300), maxTokensArg: float64(50)}, want: 200},
+	}
+	z := &ZerodhaMcpServer{responseBudget: 4096}
+	for _, tt := range tests {
+		got, err := z.requestBudget(callRequest(tt.args))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %d, %v; want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestWriteRowsBudget(t *testing.T) {
+	set := newRowSet(queryRows)
+	tests := []struct {
+		name     string
+		format   string
+		start    int
+		budget   int
+		wantNext int
+		wantText string
+	}{
+		{name: "no budget", format: FormatCSV, wantNext: 5},
+		{name: "csv cut exactly at a row", format: FormatCSV, budget: 86, wantNext: 2,
+			wantText: "tradingsymbol,segment,pnl,strike\nINFY,NSE,120,\nNIFTY24NOV24000CE,NFO-OPT,-300.5,24000\n"},
+		{name: "csv one byte short", format: FormatCSV, budget: 85, wantNext: 1,
+			wantText: "tradingsymbol,segment,pnl,strike\nINFY,NSE,120,\n"},
+		{name: "at least one row", format: FormatCSV, budget: 1, wantNext: 1,
+			wantText: "tradingsymbol,segment,pnl,strike\nINFY,NSE,120,\n"},
+		{name: "later page repeats the header", format: FormatCSV, start: 3, budget: 1000, wantNext: 5,
+			wantText: "tradingsymbol,segment,pnl,strike\nNIFTY24NOV23000PE,NFO-OPT,45,23000\nNIFTY24NOVFUT,NFO-FUT,0,\n"},
+		{name: "json counts the closing bracket", format: FormatJSON, budget: 152, wantNext: 2},
+		{name: "json one byte short", format: FormatJSON, budget: 151, wantNext: 1,
+			wantText: `[{"tradingsymbol":"INFY","segment":"NSE","pnl":120,"strike":null}]`},
+		{name: "markdown", format: FormatMarkdown, start: 4, budget: 1, wantNext: 5,
+			wantText: "| tradingsymbol | segment | pnl | strike |\n| --- | --- | --- | --- |\n| NIFTY24NOVFUT | NFO-FUT | 0 |  |\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, next, err := writeRows(tt.format, set, tt.start, tt.budget)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next != tt.wantNext {
+				t.Errorf("next %d, want %d", next, tt.wantNext)
+			}
+			if tt.budget > 0 && next > tt.start+1 && len(text) > tt.budget {
+				t.Errorf("%d bytes exceed the budget of %d", len(text), tt.budget)
+			}
+			if tt.wantText != "" && text != tt.wantText {
+				t.Errorf("got\n%s\nwant\n%s", text, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestListResultPages(t *testing.T) {
+	z := &ZerodhaMcpServer{responseBudget: 86}
+	args := map[string]any{formatArg: FormatCSV}
+
+	var pages []string
+	for page := 0; page < len(queryRows); page++ {
+		result, err := z.listResult(toolRequest("get_positions", args), "Positions.", queryRows)
+		summary, text := resultText(t, result, err)
+		pages = append(pages, text)
+
+		_, cursor, ok := strings.Cut(summary, "cursor=")
+		if !ok {
+			break
+		}
+		args = map[string]any{formatArg: FormatCSV, cursorArg: strings.Trim(cursor[:strings.IndexByte(cursor, ' ')], `",`)}
+	}
+
+	want := []string{
+		"tradingsymbol,segment,pnl,strike\nINFY,NSE,120,\nNIFTY24NOV24000CE,NFO-OPT,-300.5,24000\n",
+		"tradingsymbol,segment,pnl,strike\nTCS,NSE,-20,\nNIFTY24NOV23000PE,NFO-OPT,45,23000\n",
+		"tradingsymbol,segment,pnl,strike\nNIFTY24NOVFUT,NFO-FUT,0,\n",
+	}
+	if strings.Join(pages, "") != strings.Join(want, "") {
+		t.Errorf("got pages %q, want %q", pages, want)
+	}
+}
+
+func TestFormattedResultBody(t *testing.T) {
+	z := &ZerodhaMcpServer{responseBudget: DefaultConfig().ResponseBudget}
+	body := aggregateResult[testRow]{Rows: testRows, SkippedAccounts: []SkippedAccount{{Account: "family", Reason: "login required"}}}
+	rowsJSON := `[{"tradingsymbol":"INFY","open":1500.5,"close":1510,"last_price":1510,"note":"a|b","tags":["x"]},` +
+		`{"tradingsymbol":"TCS","open":4000,"close":3990.25,"last_price":3990.25,"note":"say \"hi\", ok","tags":[]}]`
+	bodyJSON := `{"rows":` + rowsJSON + `,"skipped_accounts":[{"account":"family","reason":"login required"}]}`
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{name: "fits the default budget", args: map[string]any{}, want: bodyJSON},
+		{name: "fits exactly", args: map[string]any{maxBytesArg: float64(len(bodyJSON))}, want: bodyJSON},
+		{name: "rows fit but the body does not", args: map[string]any{maxBytesArg: float64(len(bodyJSON) - 1)}, want: rowsJSON},
+		{name: "query returns the rows", args: map[string]any{limitArg: float64(5)}, want: rowsJSON},
+		{name: "cut", args: map[string]any{maxBytesArg: float64(10)}, want: rowsJSON[:strings.Index(rowsJSON, `},{`)+1] + "]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := z.formattedResult(toolRequest("get_kite_holdings", tt.args), "Holdings.", body, testRows)
+			if _, text := resultText(t, result, err); text != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", text, tt.want)
+			}
+		})
+	}
+}
+
+func TestPositionsKeepNetAndDay(t *testing.T) {
+	position := map[string]any{"exchange": "NSE", "tradingsymbol": "INFY", "product": "CNC", "quantity": 10, "pnl": 25.5}
+	z := newTestServer(t, kiteRoutes{
+		kiteconnect.URIGetPositions: map[string]any{"net": []any{position}, "day": []any{position}},
+	})
+	z.responseBudget = DefaultConfig().ResponseBudget
+
+	result, err := z.Positions()(context.Background(), toolRequest("get_positions", nil))
+	_, text := resultText(t, result, err)
+	var got map[string][]map[string]any
+	if err := json.Unmarshal([]byte(text), &got); err != nil {
+		t.Fatalf("positions are not an object of net and day lists: %v\n%s", err, text)
+	}
+	if len(got["net"]) != 1 || len(got["day"]) != 1 || got["net"][0]["tradingsymbol"] != "INFY" {
+		t.Errorf("got %s", text)
+	}
+}
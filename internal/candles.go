@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+const candleCacheDir = "candles"
+
+// maxCandleSeries is how many series the store keeps in memory. Series not in use are dropped
+// beyond it, least recently used first, and read back from disk when asked for again.
+const maxCandleSeries = 32
+
+// DefaultCandleCacheDir returns the candle cache location under the user config dir.
+func DefaultCandleCacheDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, tokenStoreDir, candleCacheDir), nil
+}
+
+// timeRange is an inclusive range of time, to the second.
+type timeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// candleSeries holds the stored candles of one instrument and interval, and the ranges that have
+// been fetched. A covered range without candles is a holiday or a period without trades.
+type candleSeries struct {
+	mu      sync.Mutex
+	Candles []kiteconnect.HistoricalData
+	Covered []timeRange
+
+	// users and lastUsed are guarded by the store's mu; a series in use is never dropped.
+	users    int
+	lastUsed time.Time
+}
+
+// CandleStore keeps historical candles on disk so repeated requests only fetch the ranges that are
+// missing. Candles of the current day are still forming, so they are always fetched and never stored.
+type CandleStore struct {
+	dir string
+
+	// mu guards the map of series. Each series has its own lock, held while its gaps are fetched,
+	// so slow requests for one instrument do not hold up the others. The map holds at most
+	// maxCandleSeries series besides those in use.
+	mu     sync.Mutex
+	series map[string]*candleSeries
+}
+
+// NewCandleStore returns a store that persists to dir, or only keeps candles in memory when dir is empty.
+func NewCandleStore(dir string) *CandleStore {
+	return &CandleStore{dir: dir, series: map[string]*candleSeries{}}
+}
+
+func candleSeriesKey(req candleRequest) string {
+	key := fmt.Sprintf("%d_%s", req.Token, req.Interval)
+	if req.Continuous {
+		key += "_continuous"
+	}
+	if req.OI {
+		key += "_oi"
+	}
+	return key
+}
+
+// Candles returns the candles of the request, fetching only what the store does not have yet.
+// It also returns how many requests were made to Kite.
+func (s *CandleStore) Candles(ctx context.Context, kc *kiteconnect.Client, req candleRequest) ([]kiteconnect.HistoricalData, int, error) {
+	key := candleSeriesKey(req)
+	series := s.acquire(key)
+	defer s.release(series)
+	series.mu.Lock()
+
+	now := time.Now().In(istLocation)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, istLocation)
+
+	requests := 0
+	if req.From.Before(today) {
+		stored := timeRange{From: req.From, To: minTime(req.To, today.Add(-time.Second))}
+		filled := 0
+		for _, gap := range missingRanges(series.Covered, stored) {
+			gapReq := req
+			gapReq.From, gapReq.To = gap.From, gap.To
+			candles, n, err := fetchCandles(ctx, kc, gapReq)
+			requests += n
+			if err != nil {
+				// Keep the gaps filled so far, the next call continues from there
+				if filled > 0 {
+					s.save(key, series)
+				}
+				series.mu.Unlock()
+				return nil, requests, err
+			}
+			series.Candles = mergeCandles(append(series.Candles, candles...))
+			series.Covered = addRange(series.Covered, gap)
+			filled++
+		}
+		if filled > 0 {
+			s.save(key, series)
+		}
+	}
+
+	var candles []kiteconnect.HistoricalData
+	for _, candle := range series.Candles {
+		if !candle.Date.Before(req.From) && !candle.Date.After(req.To) {
+			candles = append(candles, candle)
+		}
+	}
+	series.mu.Unlock()
+
+	if !req.To.Before(today) {
+		liveReq := req
+		liveReq.From = maxTime(req.From, today)
+		live, n, err := fetchCandles(ctx, kc, liveReq)
+		requests += n
+		if err != nil {
+			return nil, requests, err
+		}
+		candles = mergeCandles(append(candles, live...))
+	}
+	return candles, requests, nil
+}
+
+// missingRanges returns the parts of want that are not covered, in time order.
+func missingRanges(covered []timeRange, want timeRange) []timeRange {
+	var gaps []timeRange
+	next := want.From
+	for _, r := range covered {
+		if r.To.Before(next) {
+			continue
+		}
+		if r.From.After(want.To) {
+			break
+		}
+		if r.From.After(next) {
+			gaps = append(gaps, timeRange{From: next, To: r.From.Add(-time.Second)})
+		}
+		next = r.To.Add(time.Second)
+		if next.After(want.To) {
+			return gaps
+		}
+	}
+	return append(gaps, timeRange{From: next, To: want.To})
+}
+
+// addRange adds r to the sorted covered ranges, merging ranges that overlap or touch.
+func addRange(covered []timeRange, r timeRange) []timeRange {
+	covered = append(covered, r)
+	sort.Slice(covered, func(i, j int) bool {
+		return covered[i].From.Before(covered[j].From)
+	})
+
+	merged := covered[:1]
+	for _, r := range covered[1:] {
+		last := &merged[len(merged)-1]
+		if !r.From.After(last.To.Add(time.Second)) {
+			last.To = maxTime(last.To, r.To)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (s *CandleStore) path(key string) string {
+	return filepath.Join(s.dir, key+".gob")
+}
+
+// acquire returns the series of key, reading it from disk when it is not in memory. The series
+// stays in memory until it is released.
+func (s *CandleStore) acquire(key string) *candleSeries {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, ok := s.series[key]
+	if !ok {
+		s.evictLocked(maxCandleSeries - 1)
+		series = s.load(key)
+		s.series[key] = series
+	}
+	series.users++
+	series.lastUsed = time.Now()
+	return series
+}
+
+func (s *CandleStore) release(series *candleSeries) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series.users--
+	s.evictLocked(maxCandleSeries)
+}
+
+// evictLocked drops the least recently used series that are not in use until at most n are left.
+func (s *CandleStore) evictLocked(n int) {
+	for len(s.series) > n {
+		oldest := ""
+		for key, series := range s.series {
+			if series.users == 0 && (oldest == "" || series.lastUsed.Before(s.series[oldest].lastUsed)) {
+				oldest = key
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		delete(s.series, oldest)
+	}
+}
+
+// load reads the series of key from disk.
+func (s *CandleStore) load(key string) *candleSeries {
+	series := &candleSeries{}
+	if s.dir == "" {
+		return series
+	}
+
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Unable to read candle cache", "path", s.path(key), "error", err)
+		}
+		return series
+	}
+	defer f.Close()
+
+	if err := gob.NewDecoder(f).Decode(series); err != nil {
+		slog.Warn("Ignoring unreadable candle cache", "path", s.path(key), "error", err)
+		series.Candles, series.Covered = nil, nil
+	}
+	return series
+}
+
+// save writes a series, with the series lock held by the caller.
+func (s *CandleStore) save(key string, series *candleSeries) {
+	if s.dir == "" {
+		return
+	}
+	if err := s.writeSeries(key, series); err != nil {
+		slog.Warn("Unable to write candle cache", "path", s.path(key), "error", err)
+	}
+}
+
+// writeSeries replaces the cache file of a series atomically, like the token store.
+func (s *CandleStore) writeSeries(key string, series *candleSeries) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, key+".gob.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(series); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encode candle cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// days returns the range of whole IST days from one date to another, such as days("2026-10-12", "2026-10-13").
+func days(t *testing.T, from, to string) timeRange {
+	t.Helper()
+	return timeRange{From: istTime(t, from+" 00:00:00"), To: istTime(t, to+" 23:59:59")}
+}
+
+func formatRanges(ranges []timeRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, r.From.In(istLocation).Format(time.DateTime)+" - "+r.To.In(istLocation).Format(time.DateTime))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func TestMissingRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		covered []timeRange
+		want    string
+	}{
+		{name: "nothing covered", want: "2026-10-05 00:00:00 - 2026-10-09 23:59:59"},
+		{name: "all covered", covered: []timeRange{days(t, "2026-10-01", "2026-10-31")}, want: ""},
+		{name: "exactly covered", covered: []timeRange{days(t, "2026-10-05", "2026-10-09")}, want: ""},
+		{name: "covered before and after", covered: []timeRange{days(t, "2026-09-01", "2026-09-30"), days(t, "2026-10-12", "2026-10-16")},
+			want: "2026-10-05 00:00:00 - 2026-10-09 23:59:59"},
+		{name: "head covered", covered: []timeRange{days(t, "2026-10-01", "2026-10-06")}, want: "2026-10-07 00:00:00 - 2026-10-09 23:59:59"},
+		{name: "tail covered", covered: []timeRange{days(t, "2026-10-08", "2026-10-20")}, want: "2026-10-05 00:00:00 - 2026-10-07 23:59:59"},
+		{name: "middle covered", covered: []timeRange{days(t, "2026-10-06", "2026-10-07")},
+			want: "2026-10-05 00:00:00 - 2026-10-05 23:59:59, 2026-10-08 00:00:00 - 2026-10-09 23:59:59"},
+		{name: "two gaps between ranges", covered: []timeRange{days(t, "2026-10-05", "2026-10-05"), days(t, "2026-10-07", "2026-10-07")},
+			want: "2026-10-06 00:00:00 - 2026-10-06 23:59:59, 2026-10-08 00:00:00 - 2026-10-09 23:59:59"},
+	}
+	for _, tt := range tests {
+		if got := formatRanges(missingRanges(tt.covered, days(t, "2026-10-05", "2026-10-09"))); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		added []timeRange
+		want  string
+	}{
+		{name: "one range", added: []timeRange{days(t, "2026-10-05", "2026-10-09")}, want: "2026-10-05 00:00:00 - 2026-10-09 23:59:59"},
+		{name: "disjoint ranges are sorted", added: []timeRange{days(t, "2026-10-12", "2026-10-16"), days(t, "2026-10-01", "2026-10-02")},
+			want: "2026-10-01 00:00:00 - 2026-10-02 23:59:59, 2026-10-12 00:00:00 - 2026-10-16 23:59:59"},
+		{name: "adjacent ranges merge", added: []timeRange{days(t, "2026-10-05", "2026-10-06"), days(t, "2026-10-07", "2026-10-09")},
+			want: "2026-10-05 00:00:00 - 2026-10-09 23:59:59"},
+		{name: "overlapping ranges merge", added: []timeRange{days(t, "2026-10-05", "2026-10-08"), days(t, "2026-10-07", "2026-10-09")},
+			want: "2026-10-05 00:00:00 - 2026-10-09 23:59:59"},
+		{name: "contained range", added: []timeRange{days(t, "2026-10-01", "2026-10-31"), days(t, "2026-10-07", "2026-10-09")},
+			want: "2026-10-01 00:00:00 - 2026-10-31 23:59:59"},
+		{name: "a range bridges two", added: []timeRange{days(t, "2026-10-01", "2026-10-02"), days(t, "2026-10-06", "2026-10-07"), days(t, "2026-10-03", "2026-10-05")},
+			want: "2026-10-01 00:00:00 - 2026-10-07 23:59:59"},
+		{name: "a second apart is not adjacent", added: []timeRange{days(t, "2026-10-05", "2026-10-05"), {From: istTime(t, "2026-10-06 00:00:01"), To: istTime(t, "2026-10-06 23:59:59")}},
+			want: "2026-10-05 00:00:00 - 2026-10-05 23:59:59, 2026-10-06 00:00:01 - 2026-10-06 23:59:59"},
+	}
+	for _, tt := range tests {
+		var covered []timeRange
+		for _, r := range tt.added {
+			covered = addRange(covered, r)
+		}
+		if got := formatRanges(covered); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCandleStore(t *testing.T) {
+	route := &historicalRoute{}
+	kc := newKiteClient(t, kiteRoutes{fmt.Sprintf(kiteconnect.URIGetHistorical, 408065, "day"): route.serve})
+	dir := t.TempDir()
+	request := func(store *CandleStore, r timeRange) int {
+		t.Helper()
+		_, requests, err := store.Candles(context.Background(), kc, candleRequest{Token: 408065, Interval: "day", From: r.From, To: r.To})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return requests
+	}
+
+	store := NewCandleStore(dir)
+	if got := request(store, days(t, "2026-09-01", "2026-09-30")); got != 1 {
+		t.Fatalf("first request made %d requests to Kite, want 1", got)
+	}
+	if got := request(store, days(t, "2026-09-10", "2026-09-20")); got != 0 {
+		t.Errorf("a covered range made %d requests to Kite", got)
+	}
+	if got := request(store, days(t, "2026-09-15", "2026-10-05")); got != 1 || !strings.HasPrefix(route.ranges[1], "2026-10-01 00:00:00") {
+		t.Errorf("an overlapping range made %d requests for %q, want only the missing days", got, route.ranges[1:])
+	}
+
+	// Another store reads the covered ranges back from disk
+	reopened := NewCandleStore(dir)
+	if got := request(reopened, days(t, "2026-09-01", "2026-10-05")); got != 0 {
+		t.Errorf("the reopened store made %d requests to Kite", got)
+	}
+	series := reopened.acquire(candleSeriesKey(candleRequest{Token: 408065, Interval: "day"}))
+	defer reopened.release(series)
+	if got, want := formatRanges(series.Covered), "2026-09-01 00:00:00 - 2026-10-05 23:59:59"; got != want {
+		t.Errorf("reopened store covers %q, want %q", got, want)
+	}
+	if len(series.Candles) != 2 {
+		t.Errorf("reopened store has %d candles, want one per request", len(series.Candles))
+	}
+}
+
+func TestCandleStoreToday(t *testing.T) {
+	route := &historicalRoute{}
+	kc := newKiteClient(t, kiteRoutes{fmt.Sprintf(kiteconnect.URIGetHistorical, 408065, "day"): route.serve})
+	store := NewCandleStore("")
+
+	now := time.Now().In(istLocation)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, istLocation)
+	req := candleRequest{Token: 408065, Interval: "day", From: today.AddDate(0, 0, -3), To: now}
+	for call := 1; call <= 2; call++ {
+		if _, _, err := store.Candles(context.Background(), kc, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the past days are stored, today is fetched on every call
+	want := []string{
+		today.AddDate(0, 0, -3).Format(time.DateTime) + " - " + today.Add(-time.Second).Format(time.DateTime),
+		today.Format(time.DateTime) + " - " + now.Format(time.DateTime),
+		today.Format(time.DateTime) + " - " + now.Format(time.DateTime),
+	}
+	if strings.Join(route.ranges, ", ") != strings.Join(want, ", ") {
+		t.Errorf("requested %q, want %q", route.ranges, want)
+	}
+	series := store.acquire(candleSeriesKey(req))
+	defer store.release(series)
+	if last := series.Covered[len(series.Covered)-1].To; !last.Before(today) {
+		t.Errorf("stored range ends at %s, after the start of today", last)
+	}
+}
+
+func TestCandleStoreEviction(t *testing.T) {
+	store := NewCandleStore("")
+	held := store.acquire("held")
+	for i := range 2 * maxCandleSeries {
+		store.release(store.acquire(fmt.Sprint("series_", i)))
+	}
+	if len(store.series) != maxCandleSeries {
+		t.Errorf("store keeps %d series, want %d", len(store.series), maxCandleSeries)
+	}
+	if store.series["held"] != held {
+		t.Error("a series in use was dropped")
+	}
+	if _, ok := store.series["series_0"]; ok {
+		t.Error("the least recently used series was kept")
+	}
+	if _, ok := store.series[fmt.Sprint("series_", 2*maxCandleSeries-1)]; !ok {
+		t.Error("the most recently used series was dropped")
+	}
+
+	store.release(held)
+	if again := store.acquire("held"); again != held {
+		t.Error("a recently used series was dropped once released")
+	}
+}
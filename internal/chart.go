@@ -0,0 +1,442 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+const (
+	ChartCandlestick = "candlestick"
+	ChartLine        = "line"
+)
+
+const (
+	defaultChartCandles = 120
+	maxChartCandles     = 1000
+	defaultChartWidth   = 1000
+	defaultChartHeight  = 600
+)
+
+var (
+	chartBackground = color.RGBA{255, 255, 255, 255}
+	chartGrid       = color.RGBA{235, 235, 235, 255}
+	chartAxis       = color.RGBA{120, 120, 120, 255}
+	chartLabel      = color.RGBA{70, 70, 70, 255}
+	chartUp         = color.RGBA{38, 166, 154, 255}
+	chartDown       = color.RGBA{239, 83, 80, 255}
+	chartUpVolume   = color.RGBA{167, 219, 214, 255}
+	chartDownVolume = color.RGBA{249, 185, 184, 255}
+	chartClose      = color.RGBA{33, 150, 243, 255}
+	chartBuy        = color.RGBA{0, 140, 60, 255}
+	chartSell       = color.RGBA{200, 30, 30, 255}
+)
+
+// overlayColors are handed out to overlays in order; the names are listed in the tool result
+// because the chart has no legend.
+var overlayColors = []struct {
+	name  string
+	color color.RGBA
+}{
+	{"orange", color.RGBA{255, 152, 0, 255}},
+	{"purple", color.RGBA{156, 39, 176, 255}},
+	{"blue", color.RGBA{33, 150, 243, 255}},
+	{"brown", color.RGBA{121, 85, 72, 255}},
+	{"pink", color.RGBA{233, 30, 99, 255}},
+	{"grey", color.RGBA{96, 125, 139, 255}},
+}
+
+// chartOverlays are the indicators drawn on the price scale.
+var chartOverlays = map[string]bool{"sma": true, "ema": true, "bollinger": true, "vwap": true, "supertrend": true}
+
+type chartSeries struct {
+	values []float64
+	color  color.RGBA
+}
+
+type chartMarker struct {
+	index int
+	price float64
+	buy   bool
+}
+
+type chartSpec struct {
+	candles  []kiteconnect.HistoricalData
+	line     bool
+	volume   bool
+	intraday bool
+	overlays []chartSeries
+	markers  []chartMarker
+	width    int
+	height   int
+}
+
+// renderChart draws candles, overlays, volume bars and trade markers as a PNG, with the price
+// scale on the right and dates along the bottom.
+func renderChart(spec chartSpec) ([]byte, error) {
+	const left, right, top, bottom, gap = 8, 86, 10, 24, 6
+	if len(spec.candles) == 0 {
+		return nil, errors.New("no candles to draw")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, spec.width, spec.height))
+	fillRect(img, 0, 0, spec.width, spec.height, chartBackground)
+
+	plotW := spec.width - left - right
+	priceH := spec.height - top - bottom
+	volumeH := 0
+	if spec.volume {
+		volumeH = priceH / 4
+		priceH -= volumeH + gap
+	}
+	priceBottom := top + priceH
+	volumeTop := priceBottom + gap
+	plotBottom := top + priceH
+	if spec.volume {
+		plotBottom = volumeTop + volumeH
+	}
+
+	n := len(spec.candles)
+	slot := float64(plotW) / float64(n)
+	xAt := func(i int) int { return left + int(slot*(float64(i)+0.5)) }
+	bodyW := max(1, int(slot*0.7))
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, candle := range spec.candles {
+		if spec.line {
+			lo, hi = math.Min(lo, candle.Close), math.Max(hi, candle.Close)
+		} else {
+			lo, hi = math.Min(lo, candle.Low), math.Max(hi, candle.High)
+		}
+	}
+	for _, overlay := range spec.overlays {
+		for _, v := range overlay.values {
+			if !math.IsNaN(v) {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	for _, marker := range spec.markers {
+		lo, hi = math.Min(lo, marker.price), math.Max(hi, marker.price)
+	}
+	if hi <= lo {
+		hi, lo = hi+1, lo-1
+	}
+	pad := (hi - lo) * 0.05
+	lo, hi = lo-pad, hi+pad
+	yAt := func(price float64) int { return top + int((hi-price)/(hi-lo)*float64(priceH)) }
+
+	// Price grid and labels
+	step := niceStep((hi - lo) / 6)
+	decimals := max(0, -int(math.Floor(math.Log10(step))))
+	for p := math.Ceil(lo/step) * step; p <= hi; p += step {
+		y := yAt(p)
+		drawLine(img, left, y, left+plotW, y, chartGrid)
+		drawText(img, left+plotW+6, y-glyphHeight/2, strconv.FormatFloat(p, 'f', decimals, 64), chartLabel)
+	}
+
+	// Date grid and labels, spaced so the labels do not overlap
+	layout := "2006-01-02"
+	if spec.intraday {
+		layout = "01-02 15:04"
+	}
+	labelW := textWidth(layout) + 24
+	every := max(1, int(math.Ceil(float64(labelW)/slot)))
+	for i := 0; i < n; i += every {
+		x := xAt(i)
+		drawLine(img, x, top, x, plotBottom, chartGrid)
+		label := spec.candles[i].Date.In(istLocation).Format(layout)
+		if lx := x - textWidth(label)/2; lx >= 0 && lx+textWidth(label) <= left+plotW {
+			drawText(img, lx, plotBottom+7, label, chartLabel)
+		}
+	}
+
+	// Volume bars
+	if spec.volume {
+		maxVolume := 0
+		for _, candle := range spec.candles {
+			maxVolume = max(maxVolume, candle.Volume)
+		}
+		if maxVolume > 0 {
+			for i, candle := range spec.candles {
+				barH := int(float64(candle.Volume) / float64(maxVolume) * float64(volumeH))
+				c := chartUpVolume
+				if candle.Close < candle.Open {
+					c = chartDownVolume
+				}
+				x := xAt(i)
+				fillRect(img, x-bodyW/2, volumeTop+volumeH-barH, x-bodyW/2+bodyW, volumeTop+volumeH, c)
+			}
+			drawText(img, left+plotW+6, volumeTop, compactNumber(float64(maxVolume)), chartLabel)
+		}
+		drawLine(img, left, volumeTop-gap/2, left+plotW, volumeTop-gap/2, chartAxis)
+	}
+
+	// Prices
+	if spec.line {
+		if n == 1 {
+			// A single close has no line to draw, so it is marked with a dot
+			x, y := xAt(0), yAt(spec.candles[0].Close)
+			fillRect(img, x-2, y-2, x+3, y+3, chartClose)
+		}
+		for i := 1; i < n; i++ {
+			drawThickLine(img, xAt(i-1), yAt(spec.candles[i-1].Close), xAt(i), yAt(spec.candles[i].Close), chartClose)
+		}
+	} else {
+		for i, candle := range spec.candles {
+			c := chartUp
+			if candle.Close < candle.Open {
+				c = chartDown
+			}
+			x := xAt(i)
+			drawLine(img, x, yAt(candle.High), x, yAt(candle.Low), c)
+			bodyTop, bodyBottom := yAt(math.Max(candle.Open, candle.Close)), yAt(math.Min(candle.Open, candle.Close))
+			fillRect(img, x-bodyW/2, bodyTop, x-bodyW/2+bodyW, bodyBottom+1, c)
+		}
+	}
+
+	for _, overlay := range spec.overlays {
+		for i := 1; i < len(overlay.values); i++ {
+			a, b := overlay.values[i-1], overlay.values[i]
+			if !math.IsNaN(a) && !math.IsNaN(b) {
+				drawThickLine(img, xAt(i-1), yAt(a), xAt(i), yAt(b), overlay.color)
+			}
+		}
+	}
+
+	// Buys point up and sells point down, with the tip at the traded price
+	for _, marker := range spec.markers {
+		if marker.buy {
+			fillTriangle(img, xAt(marker.index), yAt(marker.price), 10, true, chartBuy)
+		} else {
+			fillTriangle(img, xAt(marker.index), yAt(marker.price), 10, false, chartSell)
+		}
+	}
+
+	drawLine(img, left, top, left+plotW, top, chartAxis)
+	drawLine(img, left, plotBottom, left+plotW, plotBottom, chartAxis)
+	drawLine(img, left, top, left, plotBottom, chartAxis)
+	drawLine(img, left+plotW, top, left+plotW, plotBottom, chartAxis)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// niceStep rounds a grid step to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 || math.IsNaN(raw) || math.IsInf(raw, 0) {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func compactNumber(v float64) string {
+	for _, unit := range []struct {
+		size   float64
+		suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "K"}} {
+		if v >= unit.size {
+			return strconv.FormatFloat(v/unit.size, 'f', 1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
+
+// tradeMarkers places the trades of an instrument on the candle they were filled in. Kite's
+// tradebook only holds the current day, so older trades cannot be shown.
+func tradeMarkers(trades kiteconnect.Trades, token int, candles []kiteconnect.HistoricalData, candleLength time.Duration) []chartMarker {
+	var markers []chartMarker
+	for _, trade := range trades {
+		if int(trade.InstrumentToken) != token {
+			continue
+		}
+		filled := trade.FillTimestamp.Time
+		if filled.IsZero() {
+			filled = trade.ExchangeTimestamp.Time
+		}
+		filled = exchangeTime(filled)
+		i := sort.Search(len(candles), func(i int) bool {
+			return candles[i].Date.After(filled)
+		}) - 1
+		if i < 0 || filled.Sub(candles[i].Date.Time) >= candleLength {
+			continue
+		}
+		markers = append(markers, chartMarker{
+			index: i,
+			price: trade.AveragePrice,
+			buy:   strings.EqualFold(trade.TransactionType, kiteconnect.TransactionTypeBuy),
+		})
+	}
+	return markers
+}
+
+func (z *ZerodhaMcpServer) Chart() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.Params.Arguments
+
+		chartType, _ := args["type"].(string)
+		switch chartType {
+		case "":
+			chartType = ChartCandlestick
+		case ChartCandlestick, ChartLine:
+		default:
+			return mcp.NewToolResultError(fmt.Sprintf("type %q must be %s or %s", chartType, ChartCandlestick, ChartLine)), nil
+		}
+
+		var specs []indicatorSpec
+		warmup := 0
+		for _, name := range stringListArg(args["overlays"]) {
+			spec, err := parseIndicatorSpec(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if !chartOverlays[spec.name] {
+				return mcp.NewToolResultError(fmt.Sprintf("%s is not on the price scale, overlays can be sma, ema, bollinger, vwap or supertrend; use get_indicators for it", spec.label())), nil
+			}
+			specs = append(specs, spec)
+			warmup = max(warmup, spec.warmup())
+		}
+
+		count, err := intArg(args, "candles")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if count == 0 {
+			count = defaultChartCandles
+		}
+		count = min(count, maxChartCandles)
+
+		width, err := intArg(args, "width")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		height, err := intArg(args, "height")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if width == 0 {
+			width = defaultChartWidth
+		}
+		if height == 0 {
+			height = defaultChartHeight
+		}
+		width, height = min(max(width, 400), 2000), min(max(height, 300), 1200)
+
+		volume, ok := args["volume"].(bool)
+		if !ok {
+			volume = true
+		}
+		showTrades, _ := args["trades"].(bool)
+
+		kc := z.client(ctx)
+		instrument, req, err := z.parseCandleRequest(kc, request, count+warmup)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		candles, _, err := z.candles.Candles(ctx, kc, req)
+		if err != nil {
+			return nil, err
+		}
+		label := instrumentLabel(instrument)
+		if len(candles) == 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("no %s candles of %s in the range", req.Interval, label)), nil
+		}
+
+		// Overlays are computed over the whole fetch so they have settled by the first visible candle
+		start := max(0, len(candles)-count)
+		visible := candles[start:]
+		chart := chartSpec{
+			candles:  visible,
+			line:     chartType == ChartLine,
+			volume:   volume,
+			intraday: intervalMinutes(req.Interval) > 0,
+			width:    width,
+			height:   height,
+		}
+
+		var legend []string
+		for i, spec := range specs {
+			palette := overlayColors[i%len(overlayColors)]
+			columns := spec.compute(candles)
+			if spec.name == "supertrend" {
+				// Draw the line green below price in an uptrend and red above it in a downtrend
+				up, down := nanSeries(len(visible)), nanSeries(len(visible))
+				for j := range visible {
+					if columns[1].values[start+j] > 0 {
+						up[j] = columns[0].values[start+j]
+					} else {
+						down[j] = columns[0].values[start+j]
+					}
+				}
+				chart.overlays = append(chart.overlays, chartSeries{values: up, color: chartUp}, chartSeries{values: down, color: chartDown})
+				legend = append(legend, spec.label()+" green/red")
+				continue
+			}
+			for _, column := range columns {
+				chart.overlays = append(chart.overlays, chartSeries{values: column.values[start:], color: palette.color})
+			}
+			legend = append(legend, spec.label()+" "+palette.name)
+		}
+
+		var notes []string
+		if showTrades {
+			trades, err := kc.GetTrades()
+			if err != nil {
+				if isTokenError(err) {
+					return nil, err
+				}
+				slog.Warn("Unable to fetch trades for chart", "error", err)
+				notes = append(notes, "Trades could not be fetched: "+err.Error()+".")
+			} else {
+				candleLength := 24 * time.Hour
+				if minutes := intervalMinutes(req.Interval); minutes > 0 {
+					candleLength = time.Duration(minutes) * time.Minute
+				}
+				chart.markers = tradeMarkers(trades, instrument.InstrumentToken, visible, candleLength)
+				notes = append(notes, fmt.Sprintf("%s from today's tradebook marked, buys as green triangles pointing up and sells as red triangles pointing down.",
+					countSummary(len(chart.markers), "trade")))
+			}
+		}
+
+		body, err := renderChart(chart)
+		if err != nil {
+			return nil, err
+		}
+
+		first, last := visible[0], visible[len(visible)-1]
+		summary := fmt.Sprintf("A %s chart of %s, %s from %v to %v, last close %s.", chartType, label,
+			countSummary(len(visible), req.Interval+" candle"), formatTime(first.Date.Time), formatTime(last.Date.Time),
+			strconv.FormatFloat(last.Close, 'f', -1, 64))
+		if len(legend) > 0 {
+			summary += " Overlays: " + strings.Join(legend, ", ") + "."
+		}
+		if len(notes) > 0 {
+			summary += " " + strings.Join(notes, " ")
+		}
+		return mcp.NewToolResultImage(summary, base64.StdEncoding.EncodeToString(body), "image/png"), nil
+	}
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct{ raw, want float64 }{
+		{0.012, 0.02},
+		{0.3, 0.5},
+		{1, 1},
+		{1.2, 2},
+		{3, 5},
+		{7, 10},
+		{45, 50},
+		{150, 200},
+		{1000, 1000},
+		{0, 1},
+		{-5, 1},
+		{math.NaN(), 1},
+		{math.Inf(1), 1},
+	}
+	for _, tt := range tests {
+		if got := niceStep(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("niceStep(%g) = %g, want %g", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// risingCandles returns n day candles from 2026-10-01, the last one falling.
+func risingCandles(t *testing.T, n int) []kiteconnect.HistoricalData {
+	t.Helper()
+	candles := make([]kiteconnect.HistoricalData, n)
+	for i := range candles {
+		candles[i] = candleAt(t, time.Date(2026, 10, 1+i, 0, 0, 0, 0, istLocation).Format("2006-01-02 15:04"), 100+float64(i), 1000*(i+1))
+	}
+	candles[n-1].Close = candles[n-1].Open - 0.5
+	return candles
+}
+
+// decodeChart decodes a rendered chart and counts its pixels of each color.
+func decodeChart(t *testing.T, data []byte) (image.Rectangle, map[color.RGBA]int) {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors := map[color.RGBA]int{}
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			colors[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)]++
+		}
+	}
+	return img.Bounds(), colors
+}
+
+func TestRenderChart(t *testing.T) {
+	overlay := nanSeries(20)
+	for i := 5; i < 20; i++ {
+		overlay[i] = 105
+	}
+	flat := risingCandles(t, 3)
+	for i := range flat {
+		flat[i].Open, flat[i].High, flat[i].Low, flat[i].Close = 100, 100, 100, 100
+	}
+
+	tests := []struct {
+		name       string
+		spec       chartSpec
+		wantColors []color.RGBA
+		noColors   []color.RGBA
+	}{
+		{
+			name: "candlestick",
+			spec: chartSpec{candles: risingCandles(t, 20), volume: true, width: 1000, height: 600,
+				overlays: []chartSeries{{values: overlay, color: overlayColors[0].color}},
+				markers:  []chartMarker{{index: 3, price: 103, buy: true}, {index: 10, price: 150}}},
+			wantColors: []color.RGBA{chartUp, chartDown, chartUpVolume, chartDownVolume, overlayColors[0].color, chartBuy, chartSell},
+			noColors:   []color.RGBA{chartClose},
+		},
+		{
+			name:       "line without volume",
+			spec:       chartSpec{candles: risingCandles(t, 20), line: true, intraday: true, width: 400, height: 300},
+			wantColors: []color.RGBA{chartClose},
+			noColors:   []color.RGBA{chartUp, chartDown, chartUpVolume, chartDownVolume},
+		},
+		{
+			name:       "one candle",
+			spec:       chartSpec{candles: risingCandles(t, 1), volume: true, width: 400, height: 300},
+			wantColors: []color.RGBA{chartDown, chartDownVolume},
+		},
+		{
+			name:       "one candle as a line",
+			spec:       chartSpec{candles: risingCandles(t, 1), line: true, width: 400, height: 300},
+			wantColors: []color.RGBA{chartClose},
+		},
+		{
+			name:       "flat prices",
+			spec:       chartSpec{candles: flat, width: 400, height: 300},
+			wantColors: []color.RGBA{chartUp},
+		},
+		{
+			name: "more candles than pixels",
+			spec: chartSpec{candles: risingCandles(t, 1000), volume: true, width: 400, height: 300},
+		},
+	}
+	for _, tt := range tests {
+		data, err := renderChart(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		bounds, colors := decodeChart(t, data)
+		if bounds != image.Rect(0, 0, tt.spec.width, tt.spec.height) {
+			t.Errorf("%s: image bounds %v, want %dx%d", tt.name, bounds, tt.spec.width, tt.spec.height)
+		}
+		for _, c := range tt.wantColors {
+			if colors[c] == 0 {
+				t.Errorf("%s: nothing drawn in %v", tt.name, c)
+			}
+		}
+		for _, c := range tt.noColors {
+			if colors[c] != 0 {
+				t.Errorf("%s: %d pixels drawn in %v", tt.name, colors[c], c)
+			}
+		}
+	}
+
+	if _, err := renderChart(chartSpec{width: 400, height: 300}); err == nil {
+		t.Error("rendered a chart without candles")
+	}
+}
+
+func TestTradeMarkers(t *testing.T) {
+	candles := make([]kiteconnect.HistoricalData, 4)
+	for i := range candles {
+		candles[i] = candleAt(t, istTime(t, "2026-10-16 09:15:00").Add(time.Duration(i)*15*time.Minute).Format("2006-01-02 15:04"), 1500, 100)
+	}
+	trade := func(token uint32, side, fill, exchange string, price float64) kiteconnect.Trade {
+		trade := kiteconnect.Trade{InstrumentToken: token, TransactionType: side, AveragePrice: price}
+		if fill != "" {
+			trade.FillTimestamp = models.Time{Time: kiteTime(t, fill)}
+		}
+		if exchange != "" {
+			trade.ExchangeTimestamp = models.Time{Time: kiteTime(t, exchange)}
+		}
+		return trade
+	}
+	trades := kiteconnect.Trades{
+		trade(408065, "BUY", "2026-10-16 09:15:00", "", 1501),
+		trade(408065, "SELL", "2026-10-16 09:44:59", "", 1502),
+		trade(408065, "buy", "", "2026-10-16 10:05:00", 1503),
+		trade(2953217, "BUY", "2026-10-16 09:20:00", "", 3000),
+		trade(408065, "BUY", "2026-10-16 09:14:59", "", 1499),
+		trade(408065, "SELL", "2026-10-16 10:00:00", "", 1504),
+		trade(408065, "SELL", "", "", 1505),
+	}
+
+	markers := tradeMarkers(trades, 408065, candles, 15*time.Minute)
+	want := []chartMarker{{index: 0, price: 1501, buy: true}, {index: 1, price: 1502}, {index: 3, price: 1503, buy: true}, {index: 3, price: 1504}}
+	if len(markers) != len(want) {
+		t.Fatalf("got %+v, want %+v", markers, want)
+	}
+	for i := range want {
+		if markers[i] != want[i] {
+			t.Errorf("marker %d: got %+v, want %+v", i, markers[i], want[i])
+		}
+	}
+
+	// A day candle holds every trade of the day, a trade after the last candle is not shown
+	days := []kiteconnect.HistoricalData{candleAt(t, "2026-10-15 00:00", 1500, 100), candleAt(t, "2026-10-16 00:00", 1500, 100)}
+	if markers := tradeMarkers(trades[:1], 408065, days, 24*time.Hour); len(markers) != 1 || markers[0].index != 1 {
+		t.Errorf("day candles: got %+v", markers)
+	}
+	if markers := tradeMarkers(trades[:1], 408065, days[:1], 24*time.Hour); len(markers) != 0 {
+		t.Errorf("a trade after the last day candle: got %+v", markers)
+	}
+}
@@ -0,0 +1,492 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFile = "config.yaml"
+
+	// defaultAccountName is used when the credentials are given directly instead of as a list of accounts.
+	defaultAccountName = "default"
+)
+
+var accountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// AccountConfig holds the credentials and token store of one Kite account.
+type AccountConfig struct {
+	Name           string `yaml:"name"`
+	APIKey         string `yaml:"api_key"`
+	APISecret      string `yaml:"api_secret"`
+	TokenStorePath string `yaml:"token_store_path"`
+}
+
+// Config holds the server settings. Values are resolved with the precedence
+// flags > environment variables > config file > defaults.
+type Config struct {
+	APIKey         string        `yaml:"api_key"`
+	APISecret      string        `yaml:"api_secret"`
+	ListenHost     string        `yaml:"listen_host"`
+	ListenPort     int           `yaml:"listen_port"`
+	RedirectPath   string        `yaml:"redirect_path"`
+	AuthTimeout    time.Duration `yaml:"auth_timeout"`
+	TokenStorePath string        `yaml:"token_store_path"`
+	EnabledTools   []string      `yaml:"enabled_tools"`
+	DisabledTools  []string      `yaml:"disabled_tools"`
+	ReadOnly       bool          `yaml:"read_only"`
+	LogLevel       string        `yaml:"log_level"`
+	Headless       bool          `yaml:"headless"`
+
+	// InstrumentCachePath and CandleCacheDir locate the on-disk caches; empty keeps the data in memory only.
+	InstrumentCachePath string `yaml:"instrument_cache_path"`
+	CandleCacheDir      string `yaml:"candle_cache_dir"`
+
+	// Transport selects stdio or SSE. SSE listens on HTTPAddr and requires BearerToken.
+	Transport   string `yaml:"transport"`
+	HTTPAddr    string `yaml:"http_addr"`
+	BaseURL     string `yaml:"base_url"`
+	BearerToken string `yaml:"bearer_token"`
+
+	// ResponseBudget caps list results in bytes; longer results are paged with a cursor. 0 disables it.
+	ResponseBudget int `yaml:"response_budget"`
+
+	// Risk holds the guardrails of the trading tools.
+	Risk RiskPolicy `yaml:"risk"`
+
+	// Accounts replaces APIKey, APISecret and TokenStorePath when several Kite accounts are used.
+	Accounts       []AccountConfig `yaml:"accounts"`
+	DefaultAccount string          `yaml:"default_account"`
+}
+
+func DefaultConfig() Config {
+	tokenStorePath, _ := DefaultTokenStorePath()
+	instrumentCachePath, _ := DefaultInstrumentCachePath()
+	candleCacheDir, _ := DefaultCandleCacheDir()
+	return Config{
+		ListenHost:          "127.0.0.1",
+		ListenPort:          5888,
+		RedirectPath:        "/auth",
+		AuthTimeout:         2 * time.Minute,
+		TokenStorePath:      tokenStorePath,
+		InstrumentCachePath: instrumentCachePath,
+		CandleCacheDir:      candleCacheDir,
+		LogLevel:            "info",
+		Transport:           TransportStdio,
+		HTTPAddr:            "127.0.0.1:5889",
+		ResponseBudget:      64 * 1024,
+	}
+}
+
+// DefaultConfigPath returns the config file location under the user config dir.
+func DefaultConfigPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, tokenStoreDir, configFile), nil
+}
+
+// LoadConfig resolves the configuration from the command line arguments, the
+// environment and the config file, and validates the result.
+func LoadConfig(args []string) (Config, error) {
+	cfg := DefaultConfig()
+
+	var (
+		configPath string
+		flagCfg    Config
+		tools      string
+		disabled   string
+	)
+	fs := flag.NewFlagSet("zerodha-mcp", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&configPath, "config", "", "path to a YAML config file (env ZERODHA_MCP_CONFIG)")
+	fs.StringVar(&flagCfg.APIKey, "api-key", "", "Kite Connect API key (env ZERODHA_API_KEY)")
+	fs.StringVar(&flagCfg.APISecret, "api-secret", "", "Kite Connect API secret (env ZERODHA_API_SECRET)")
+	fs.StringVar(&flagCfg.ListenHost, "listen-host", "", "host for the login callback listener (env ZERODHA_LISTEN_HOST)")
+	fs.IntVar(&flagCfg.ListenPort, "listen-port", 0, "port for the login callback listener (env ZERODHA_LISTEN_PORT)")
+	fs.StringVar(&flagCfg.RedirectPath, "redirect-path", "", "path of the login callback (env ZERODHA_REDIRECT_PATH)")
+	fs.DurationVar(&flagCfg.AuthTimeout, "auth-timeout", 0, "how long to wait for the login callback (env ZERODHA_AUTH_TIMEOUT)")
+	fs.StringVar(&flagCfg.TokenStorePath, "token-store", "", "path of the access token file (env ZERODHA_TOKEN_STORE)")
+	fs.StringVar(&flagCfg.InstrumentCachePath, "instrument-cache", "", "path of the instrument master cache (env ZERODHA_INSTRUMENT_CACHE)")
+	fs.StringVar(&flagCfg.CandleCacheDir, "candle-cache", "", "directory of the historical candle cache (env ZERODHA_CANDLE_CACHE)")
+	fs.StringVar(&tools, "enabled-tools", "", "comma separated tools to register, all when empty (env ZERODHA_ENABLED_TOOLS)")
+	fs.StringVar(&disabled, "disabled-tools", "", "comma separated tools not to register (env ZERODHA_DISABLED_TOOLS)")
+	fs.BoolVar(&flagCfg.ReadOnly, "read-only", false, "register no tools that change orders or GTTs, and refuse them if called (env ZERODHA_READ_ONLY)")
+	fs.StringVar(&flagCfg.LogLevel, "log-level", "", "debug, info, warn or error (env ZERODHA_LOG_LEVEL)")
+	fs.StringVar(&flagCfg.Transport, "transport", "", "stdio or sse (env ZERODHA_MCP_TRANSPORT)")
+	fs.StringVar(&flagCfg.HTTPAddr, "http-addr", "", "listen address of the SSE transport (env ZERODHA_MCP_HTTP_ADDR)")
+	fs.StringVar(&flagCfg.BaseURL, "base-url", "", "URL clients use to reach the SSE transport, defaults to http://<http-addr> (env ZERODHA_MCP_BASE_URL)")
+	fs.StringVar(&flagCfg.BearerToken, "bearer-token", "", "token SSE clients must send as Authorization: Bearer; prefer the env var (env ZERODHA_MCP_BEARER_TOKEN)")
+	fs.IntVar(&flagCfg.ResponseBudget, "response-budget", 0, "maximum size of a list result in bytes before it is paged, 0 for no limit (env ZERODHA_RESPONSE_BUDGET)")
+	fs.BoolVar(&flagCfg.Risk.KillSwitch, "kill-switch", false, "refuse every order placement, modification and cancellation (env ZERODHA_KILL_SWITCH)")
+	fs.BoolVar(&flagCfg.Headless, "headless", false, "do not open a browser; print the login URL and accept a pasted redirect URL (env ZERODHA_HEADLESS)")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, fmt.Errorf("%w\n\nUsage of zerodha-mcp:\n%s", err, flagUsage(fs))
+	}
+
+	if configPath == "" {
+		configPath = os.Getenv("ZERODHA_MCP_CONFIG")
+	}
+	if err := cfg.loadFile(configPath); err != nil {
+		return cfg, err
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "api-key":
+			cfg.APIKey = flagCfg.APIKey
+		case "api-secret":
+			cfg.APISecret = flagCfg.APISecret
+		case "listen-host":
+			cfg.ListenHost = flagCfg.ListenHost
+		case "listen-port":
+			cfg.ListenPort = flagCfg.ListenPort
+		case "redirect-path":
+			cfg.RedirectPath = flagCfg.RedirectPath
+		case "auth-timeout":
+			cfg.AuthTimeout = flagCfg.AuthTimeout
+		case "token-store":
+			cfg.TokenStorePath = flagCfg.TokenStorePath
+		case "instrument-cache":
+			cfg.InstrumentCachePath = flagCfg.InstrumentCachePath
+		case "candle-cache":
+			cfg.CandleCacheDir = flagCfg.CandleCacheDir
+		case "enabled-tools":
+			cfg.EnabledTools = splitList(tools)
+		case "disabled-tools":
+			cfg.DisabledTools = splitList(disabled)
+		case "read-only":
+			cfg.ReadOnly = flagCfg.ReadOnly
+		case "log-level":
+			cfg.LogLevel = flagCfg.LogLevel
+		case "headless":
+			cfg.Headless = flagCfg.Headless
+		case "kill-switch":
+			cfg.Risk.KillSwitch = flagCfg.Risk.KillSwitch
+		case "transport":
+			cfg.Transport = flagCfg.Transport
+		case "http-addr":
+			cfg.HTTPAddr = flagCfg.HTTPAddr
+		case "base-url":
+			cfg.BaseURL = flagCfg.BaseURL
+		case "bearer-token":
+			cfg.BearerToken = flagCfg.BearerToken
+		case "response-budget":
+			cfg.ResponseBudget = flagCfg.ResponseBudget
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w\n\nUsage of zerodha-mcp:\n%s", err, flagUsage(fs))
+	}
+	return cfg, nil
+}
+
+// loadFile reads the YAML config file. An explicit path must exist, the default path is optional.
+func (c *Config) loadFile(path string) error {
+	explicit := path != ""
+	if !explicit {
+		defaultPath, err := DefaultConfigPath()
+		if err != nil {
+			return nil
+		}
+		path = defaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	if v := os.Getenv("ZERODHA_API_KEY"); v != "" {
+		c.APIKey = v
+	}
+	if v := os.Getenv("ZERODHA_API_SECRET"); v != "" {
+		c.APISecret = v
+	}
+	if v := os.Getenv("ZERODHA_LISTEN_HOST"); v != "" {
+		c.ListenHost = v
+	}
+	if v := os.Getenv("ZERODHA_LISTEN_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("ZERODHA_LISTEN_PORT: %q is not a port number", v)
+		}
+		c.ListenPort = port
+	}
+	if v := os.Getenv("ZERODHA_REDIRECT_PATH"); v != "" {
+		c.RedirectPath = v
+	}
+	if v := os.Getenv("ZERODHA_AUTH_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("ZERODHA_AUTH_TIMEOUT: %q is not a duration such as 2m or 90s", v)
+		}
+		c.AuthTimeout = timeout
+	}
+	if v := os.Getenv("ZERODHA_TOKEN_STORE"); v != "" {
+		c.TokenStorePath = v
+	}
+	if v := os.Getenv("ZERODHA_INSTRUMENT_CACHE"); v != "" {
+		c.InstrumentCachePath = v
+	}
+	if v := os.Getenv("ZERODHA_CANDLE_CACHE"); v != "" {
+		c.CandleCacheDir = v
+	}
+	if v := os.Getenv("ZERODHA_ENABLED_TOOLS"); v != "" {
+		c.EnabledTools = splitList(v)
+	}
+	if v := os.Getenv("ZERODHA_DISABLED_TOOLS"); v != "" {
+		c.DisabledTools = splitList(v)
+	}
+	if v := os.Getenv("ZERODHA_READ_ONLY"); v != "" {
+		readOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("ZERODHA_READ_ONLY: %q is not a boolean", v)
+		}
+		c.ReadOnly = readOnly
+	}
+	if v := os.Getenv("ZERODHA_LOG_LEVEL"); v != "" {
+		c.LogLevel = v
+	}
+	if v := os.Getenv("ZERODHA_HEADLESS"); v != "" {
+		headless, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("ZERODHA_HEADLESS: %q is not a boolean", v)
+		}
+		c.Headless = headless
+	}
+	if v := os.Getenv("ZERODHA_KILL_SWITCH"); v != "" {
+		killSwitch, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("ZERODHA_KILL_SWITCH: %q is not a boolean", v)
+		}
+		c.Risk.KillSwitch = killSwitch
+	}
+	if v := os.Getenv("ZERODHA_RESPONSE_BUDGET"); v != "" {
+		budget, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("ZERODHA_RESPONSE_BUDGET: %q is not a number of bytes", v)
+		}
+		c.ResponseBudget = budget
+	}
+	if v := os.Getenv("ZERODHA_MCP_TRANSPORT"); v != "" {
+		c.Transport = v
+	}
+	if v := os.Getenv("ZERODHA_MCP_HTTP_ADDR"); v != "" {
+		c.HTTPAddr = v
+	}
+	if v := os.Getenv("ZERODHA_MCP_BASE_URL"); v != "" {
+		c.BaseURL = v
+	}
+	if v := os.Getenv("ZERODHA_MCP_BEARER_TOKEN"); v != "" {
+		c.BearerToken = v
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	if len(c.Accounts) == 0 {
+		if c.APIKey == "" {
+			errs = append(errs, errors.New("api_key is required (flag -api-key, env ZERODHA_API_KEY)"))
+		}
+		if c.APISecret == "" {
+			errs = append(errs, errors.New("api_secret is required (flag -api-secret, env ZERODHA_API_SECRET)"))
+		}
+		if c.DefaultAccount != "" && c.DefaultAccount != defaultAccountName {
+			errs = append(errs, fmt.Errorf("default_account %q requires a matching entry in accounts", c.DefaultAccount))
+		}
+	} else {
+		errs = append(errs, c.validateAccounts()...)
+	}
+	if c.ListenHost == "" {
+		errs = append(errs, errors.New("listen_host must not be empty"))
+	}
+	if c.ListenPort < 1 || c.ListenPort > 65535 {
+		errs = append(errs, fmt.Errorf("listen_port %d is out of range 1-65535", c.ListenPort))
+	}
+	if !strings.HasPrefix(c.RedirectPath, "/") {
+		errs = append(errs, fmt.Errorf("redirect_path %q must start with /", c.RedirectPath))
+	}
+	if c.AuthTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("auth_timeout %s must be positive", c.AuthTimeout))
+	}
+	if _, err := c.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ResponseBudget < 0 {
+		errs = append(errs, fmt.Errorf("response_budget %d must not be negative", c.ResponseBudget))
+	}
+	errs = append(errs, c.Risk.validate()...)
+	for _, tool := range c.EnabledTools {
+		if slices.Contains(c.DisabledTools, tool) {
+			errs = append(errs, fmt.Errorf("tool %q is in both enabled_tools and disabled_tools", tool))
+		}
+		if c.ReadOnly && slices.Contains(MutationTools, tool) {
+			errs = append(errs, fmt.Errorf("enabled_tools: %q changes orders and cannot be enabled with read_only", tool))
+		}
+	}
+
+	switch c.Transport {
+	case TransportStdio:
+	case TransportSSE:
+		if _, _, err := net.SplitHostPort(c.HTTPAddr); err != nil {
+			errs = append(errs, fmt.Errorf("http_addr %q must be host:port: %v", c.HTTPAddr, err))
+		}
+		if len(c.BearerToken) < minBearerTokenLength {
+			errs = append(errs, fmt.Errorf("bearer_token of at least %d characters is required for the sse transport (env ZERODHA_MCP_BEARER_TOKEN)", minBearerTokenLength))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("transport %q must be %s or %s", c.Transport, TransportStdio, TransportSSE))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c Config) validateAccounts() []error {
+	var errs []error
+
+	if c.APIKey != "" || c.APISecret != "" {
+		errs = append(errs, errors.New("api_key and api_secret cannot be combined with accounts, set them on each account instead"))
+	}
+
+	seen := map[string]bool{}
+	for i, account := range c.Accounts {
+		if !accountNamePattern.MatchString(account.Name) {
+			errs = append(errs, fmt.Errorf("accounts[%d]: name %q must be lowercase letters, digits, - or _", i, account.Name))
+		}
+		if account.Name == AllAccounts {
+			errs = append(errs, fmt.Errorf("accounts[%d]: name %q is reserved for aggregating across accounts", i, AllAccounts))
+		}
+		if seen[account.Name] {
+			errs = append(errs, fmt.Errorf("accounts[%d]: duplicate name %q", i, account.Name))
+		}
+		seen[account.Name] = true
+
+		if account.APIKey == "" {
+			errs = append(errs, fmt.Errorf("accounts[%d] (%s): api_key is required", i, account.Name))
+		}
+		if account.APISecret == "" {
+			errs = append(errs, fmt.Errorf("accounts[%d] (%s): api_secret is required", i, account.Name))
+		}
+	}
+
+	if c.DefaultAccount != "" && !seen[c.DefaultAccount] {
+		errs = append(errs, fmt.Errorf("default_account %q is not one of the configured accounts", c.DefaultAccount))
+	}
+	return errs
+}
+
+// AccountConfigs returns the configured accounts, or a single account named "default"
+// built from the top level credentials. Accounts without a token store path get one per name.
+func (c Config) AccountConfigs() []AccountConfig {
+	if len(c.Accounts) == 0 {
+		return []AccountConfig{
+			{
+				Name:           defaultAccountName,
+				APIKey:         c.APIKey,
+				APISecret:      c.APISecret,
+				TokenStorePath: c.TokenStorePath,
+			},
+		}
+	}
+
+	accounts := make([]AccountConfig, 0, len(c.Accounts))
+	for _, account := range c.Accounts {
+		if account.TokenStorePath == "" && c.TokenStorePath != "" {
+			account.TokenStorePath = filepath.Join(filepath.Dir(c.TokenStorePath), "tokens", account.Name+".json")
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// HTTPBaseURL is the URL SSE clients are told to post messages to.
+func (c Config) HTTPBaseURL() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	return "http://" + c.HTTPAddr
+}
+
+func (c Config) SlogLevel() (slog.Level, error) {
+	switch strings.ToLower(c.LogLevel) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("log_level %q must be one of debug, info, warn, error", c.LogLevel)
+	}
+}
+
+// MutationTools are the tools that change orders or GTTs. They are not registered in read-only mode.
+var MutationTools = []string{"place_order", "modify_order", "cancel_order", "create_gtt", "modify_gtt", "delete_gtt"}
+
+// ToolEnabled reports whether a tool should be registered. All tools are enabled when the allowlist
+// is empty; the denylist and read-only mode take tools away from it.
+func (c Config) ToolEnabled(name string) bool {
+	if c.ReadOnly && slices.Contains(MutationTools, name) {
+		return false
+	}
+	if slices.Contains(c.DisabledTools, name) {
+		return false
+	}
+	return len(c.EnabledTools) == 0 || slices.Contains(c.EnabledTools, name)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func flagUsage(fs *flag.FlagSet) string {
+	var b strings.Builder
+	fs.SetOutput(&b)
+	fs.PrintDefaults()
+	fs.SetOutput(io.Discard)
+	return b.String()
+}
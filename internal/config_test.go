@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolateConfig points the user config dir at a temporary directory and clears the ZERODHA_
+// variables of the environment running the tests.
+func isolateConfig(t *testing.T) string {
+	t.Helper()
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, "ZERODHA_") {
+			t.Setenv(name, "")
+		}
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	return dir
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	isolateConfig(t)
+	path := writeConfigFile(t, `
+api_key: file-key
+api_secret: file-secret
+listen_port: 6000
+auth_timeout: 3m
+log_level: warn
+read_only: true
+`)
+	t.Setenv("ZERODHA_API_KEY", "env-key")
+	t.Setenv("ZERODHA_LISTEN_PORT", "7000")
+	t.Setenv("ZERODHA_REDIRECT_PATH", "/callback")
+
+	cfg, err := LoadConfig([]string{"-config", path, "-listen-port", "8000", "-read-only=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"env over file", cfg.APIKey, "env-key"},
+		{"file", cfg.APISecret, "file-secret"},
+		{"flag over env and file", cfg.ListenPort, 8000},
+		{"flag set to its zero value", cfg.ReadOnly, false},
+		{"env over default", cfg.RedirectPath, "/callback"},
+		{"file over default", cfg.AuthTimeout, 3 * time.Minute},
+		{"file log level", cfg.LogLevel, "warn"},
+		{"default", cfg.ListenHost, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := isolateConfig(t)
+	t.Setenv("ZERODHA_API_KEY", "key")
+	t.Setenv("ZERODHA_API_SECRET", "secret")
+
+	// The default config file is optional
+	if _, err := LoadConfig(nil); err != nil {
+		t.Fatalf("without a config file: %v", err)
+	}
+
+	// and read when present
+	defaultPath := filepath.Join(dir, tokenStoreDir, configFile)
+	if err := os.MkdirAll(filepath.Dir(defaultPath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(defaultPath, []byte("listen_port: 6001\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(nil)
+	if err != nil || cfg.ListenPort != 6001 {
+		t.Fatalf("default config file: got port %d, %v", cfg.ListenPort, err)
+	}
+
+	// ZERODHA_MCP_CONFIG names another file, which must exist
+	t.Setenv("ZERODHA_MCP_CONFIG", writeConfigFile(t, "listen_port: 6002\n"))
+	if cfg, err := LoadConfig(nil); err != nil || cfg.ListenPort != 6002 {
+		t.Errorf("ZERODHA_MCP_CONFIG: got port %d, %v", cfg.ListenPort, err)
+	}
+	if _, err := LoadConfig([]string{"-config", filepath.Join(dir, "missing.yaml")}); err == nil || !strings.Contains(err.Error(), "read config file") {
+		t.Errorf("missing explicit config file: got %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown file setting", file: "api_key: key\napi_secret: secret\nlisten_prot: 6000\n", wantErr: "field listen_prot not found"},
+		{name: "malformed file", file: "api_key: [key\n", wantErr: "parse config file"},
+		{name: "env port", env: map[string]string{"ZERODHA_LISTEN_PORT": "http"}, wantErr: `ZERODHA_LISTEN_PORT: "http" is not a port number`},
+		{name: "env timeout", env: map[string]string{"ZERODHA_AUTH_TIMEOUT": "2"}, wantErr: "ZERODHA_AUTH_TIMEOUT"},
+		{name: "env boolean", env: map[string]string{"ZERODHA_HEADLESS": "sometimes"}, wantErr: "ZERODHA_HEADLESS"},
+		{name: "unknown flag", args: []string{"-api_key", "key"}, wantErr: "flag provided but not defined"},
+		{name: "invalid result", args: []string{"-listen-port", "70000"}, wantErr: "listen_port 70000 is out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateConfig(t)
+			t.Setenv("ZERODHA_API_KEY", "key")
+			t.Setenv("ZERODHA_API_SECRET", "secret")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, tt.file)}, args...)
+			}
+			if _, err := LoadConfig(args); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := DefaultConfig()
+		cfg.APIKey, cfg.APISecret = "key", "secret"
+		return cfg
+	}
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr []string
+	}{
+		{name: "valid", change: func(*Config) {}},
+		{name: "credentials", change: func(c *Config) { c.APIKey, c.APISecret = "", "" }, wantErr: []string{"api_key is required", "api_secret is required"}},
+		{name: "listener", change: func(c *Config) { c.ListenHost, c.ListenPort, c.RedirectPath = "", 0, "auth" },
+			wantErr: []string{"listen_host must not be empty", "listen_port 0 is out of range", `redirect_path "auth" must start with /`}},
+		{name: "auth timeout", change: func(c *Config) { c.AuthTimeout = 0 }, wantErr: []string{"auth_timeout 0s must be positive"}},
+		{name: "log level", change: func(c *Config) { c.LogLevel = "verbose" }, wantErr: []string{"verbose"}},
+	}
+	for _, tt := range tests {
+		cfg := valid()
+		tt.change(&cfg)
+		err := cfg.Validate()
+		if len(tt.wantErr) == 0 && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %v, want %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestAccountConfigs(t *testing.T) {
+	isolateConfig(t)
+	path := writeConfigFile(t, `
+token_store_path: /var/lib/zerodha-mcp/token.json
+default_account: family
+accounts:
+  - name: main
+    api_key: main-key
+    api_secret: main-secret
+  - name: family
+    api_key: family-key
+    api_secret: family-secret
+    token_store_path: /srv/family.json
+`)
+	cfg, err := LoadConfig([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := cfg.AccountConfigs()
+	want := []AccountConfig{
+		{Name: "main", APIKey: "main-key", APISecret: "main-secret", TokenStorePath: "/var/lib/zerodha-mcp/tokens/main.json"},
+		{Name: "family", APIKey: "family-key", APISecret: "family-secret", TokenStorePath: "/srv/family.json"},
+	}
+	if len(accounts) != len(want) || accounts[0] != want[0] || accounts[1] != want[1] {
+		t.Errorf("got %+v, want %+v", accounts, want)
+	}
+
+	single := Config{APIKey: "key", APISecret: "secret", TokenStorePath: "/var/lib/zerodha-mcp/token.json"}
+	if got := single.AccountConfigs(); len(got) != 1 || got[0] != (AccountConfig{Name: defaultAccountName, APIKey: "key", APISecret: "secret", TokenStorePath: single.TokenStorePath}) {
+		t.Errorf("single account: got %+v", got)
+	}
+	inMemory := Config{Accounts: []AccountConfig{{Name: "main", APIKey: "key", APISecret: "secret"}}}
+	if got := inMemory.AccountConfigs(); got[0].TokenStorePath != "" {
+		t.Errorf("account without any token store got %q", got[0].TokenStorePath)
+	}
+}
+
+func TestValidateAccounts(t *testing.T) {
+	account := func(name string) AccountConfig {
+		return AccountConfig{Name: name, APIKey: name + "-key", APISecret: name + "-secret"}
+	}
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr []string
+	}{
+		{name: "valid", change: func(c *Config) { c.DefaultAccount = "family" }},
+		{name: "top level credentials", change: func(c *Config) { c.APIKey = "key" }, wantErr: []string{"cannot be combined with accounts"}},
+		{name: "names", change: func(c *Config) { c.Accounts = append(c.Accounts, account("Main"), account("all"), account("main")) },
+			wantErr: []string{`accounts[2]: name "Main" must be lowercase`, `accounts[3]: name "all" is reserved`, `accounts[4]: duplicate name "main"`}},
+		{name: "credentials", change: func(c *Config) { c.Accounts[1].APISecret = "" }, wantErr: []string{"accounts[1] (family): api_secret is required"}},
+		{name: "default account", change: func(c *Config) { c.DefaultAccount = "other" }, wantErr: []string{`default_account "other" is not one of the configured accounts`}},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Accounts = []AccountConfig{account("main"), account("family")}
+		tt.change(&cfg)
+		err := cfg.Validate()
+		if len(tt.wantErr) == 0 && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %v, want %q", tt.name, err, want)
+			}
+		}
+	}
+
+	single := DefaultConfig()
+	single.APIKey, single.APISecret, single.DefaultAccount = "key", "secret", "main"
+	if err := single.Validate(); err == nil || !strings.Contains(err.Error(), "requires a matching entry in accounts") {
+		t.Errorf("default_account without accounts: got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// confirmationArg carries the token of a preview back to the tool to execute it.
+	confirmationArg = "confirmation_token"
+
+	confirmationTTL = 5 * time.Minute
+)
+
+var (
+	ErrConfirmationUnknown  = errors.New("confirmation token is unknown or was already used, call the tool again without confirmation_token for a new preview")
+	ErrConfirmationExpired  = errors.New("confirmation token has expired, call the tool again without confirmation_token for a new preview")
+	ErrConfirmationMismatch = errors.New("confirmation token was issued for different arguments, repeat the previewed call exactly with confirmation_token added")
+)
+
+type pendingConfirmation struct {
+	account     string
+	fingerprint string
+	expires     time.Time
+}
+
+// Confirmations issues one-time tokens for previewed actions. A token is bound to the account and
+// the exact arguments of the preview, and can only be used once, within confirmationTTL.
+type Confirmations struct {
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+func NewConfirmations() *Confirmations {
+	return &Confirmations{pending: map[string]pendingConfirmation{}}
+}
+
+// Issue returns a token that confirms request for account, and when it expires.
+func (c *Confirmations) Issue(account string, request mcp.CallToolRequest) (string, time.Time, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+	expires := time.Now().Add(confirmationTTL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for t, p := range c.pending {
+		if time.Now().After(p.expires) {
+			delete(c.pending, t)
+		}
+	}
+	c.pending[token] = pendingConfirmation{
+		account:     account,
+		fingerprint: argsFingerprint(request, confirmationArg),
+		expires:     expires,
+	}
+	return token, expires, nil
+}
+
+// Consume checks the token of request and uses it up. A token offered with the wrong arguments is
+// also used up, so a mistaken confirmation always needs a fresh preview.
+func (c *Confirmations) Consume(account string, request mcp.CallToolRequest) error {
+	token, _ := request.Params.Arguments[confirmationArg].(string)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[token]
+	if !ok {
+		return ErrConfirmationUnknown
+	}
+	delete(c.pending, token)
+
+	if time.Now().After(p.expires) {
+		return ErrConfirmationExpired
+	}
+	if p.account != account || p.fingerprint != argsFingerprint(request, confirmationArg) {
+		return ErrConfirmationMismatch
+	}
+	return nil
+}
+
+// confirming reports whether the call carries a confirmation token rather than asking for a preview.
+func confirming(request mcp.CallToolRequest) bool {
+	token, _ := request.Params.Arguments[confirmationArg].(string)
+	return token != ""
+}
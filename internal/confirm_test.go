@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestConfirmations(t *testing.T) {
+	preview := map[string]any{"tradingsymbol": "INFY", "quantity": float64(10)}
+	with := func(args map[string]any, token string) map[string]any {
+		args = maps.Clone(args)
+		args[confirmationArg] = token
+		return args
+	}
+
+	tests := []struct {
+		name string
+		// confirm builds the confirming call from the token of the preview.
+		confirm func(token string) (account string, args map[string]any)
+		expire  bool
+		want    error
+	}{
+		{
+			name:    "same account and arguments",
+			confirm: func(token string) (string, map[string]any) { return "main", with(preview, token) },
+		},
+		{
+			name: "different arguments",
+			confirm: func(token string) (string, map[string]any) {
+				args := with(preview, token)
+				args["quantity"] = float64(100)
+				return "main", args
+			},
+			want: ErrConfirmationMismatch,
+		},
+		{
+			name: "added argument",
+			confirm: func(token string) (string, map[string]any) {
+				args := with(preview, token)
+				args["price"] = float64(1500)
+				return "main", args
+			},
+			want: ErrConfirmationMismatch,
+		},
+		{
+			name:    "different account",
+			confirm: func(token string) (string, map[string]any) { return "family", with(preview, token) },
+			want:    ErrConfirmationMismatch,
+		},
+		{
+			name:    "unknown token",
+			confirm: func(string) (string, map[string]any) { return "main", with(preview, "0123456789abcdef") },
+			want:    ErrConfirmationUnknown,
+		},
+		{
+			name:    "expired",
+			confirm: func(token string) (string, map[string]any) { return "main", with(preview, token) },
+			expire:  true,
+			want:    ErrConfirmationExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfirmations()
+			token, expires, err := c.Issue("main", toolRequest("place_order", preview))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := time.Until(expires); d <= 0 || d > confirmationTTL {
+				t.Fatalf("token expires in %s, want within %s", d, confirmationTTL)
+			}
+			if tt.expire {
+				p := c.pending[token]
+				p.expires = time.Now().Add(-time.Second)
+				c.pending[token] = p
+			}
+
+			account, args := tt.confirm(token)
+			if err := c.Consume(account, toolRequest("place_order", args)); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if args[confirmationArg] != token {
+				return
+			}
+			// Every token is single use, whether or not it was accepted
+			if err := c.Consume("main", toolRequest("place_order", with(preview, token))); !errors.Is(err, ErrConfirmationUnknown) {
+				t.Errorf("reusing the token: got %v, want %v", err, ErrConfirmationUnknown)
+			}
+		})
+	}
+}
+
+func TestConfirmationsOtherTool(t *testing.T) {
+	c := NewConfirmations()
+	args := map[string]any{"order_id": "230101000000001"}
+	token, _, err := c.Issue("main", toolRequest("cancel_order", args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirm := maps.Clone(args)
+	confirm[confirmationArg] = token
+	if err := c.Consume("main", toolRequest("modify_order", confirm)); !errors.Is(err, ErrConfirmationMismatch) {
+		t.Errorf("got %v, want %v", err, ErrConfirmationMismatch)
+	}
+}
+
+func TestConfirmationsDropExpired(t *testing.T) {
+	c := NewConfirmations()
+	old, _, _ := c.Issue("main", toolRequest("place_order", nil))
+	p := c.pending[old]
+	p.expires = time.Now().Add(-time.Second)
+	c.pending[old] = p
+
+	if _, _, err := c.Issue("main", toolRequest("place_order", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.pending[old]; ok || len(c.pending) != 1 {
+		t.Errorf("expired token kept, %d pending", len(c.pending))
+	}
+}
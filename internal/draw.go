@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// glyphs is a 3x5 pixel font for axis labels, one row of three bits per line. Charts only
+// label prices, volumes, dates and times, so digits and a few symbols are enough.
+var glyphs = map[rune][5]uint8{
+	'0': {0b111, 0b101, 0b101, 0b101, 0b111},
+	'1': {0b010, 0b110, 0b010, 0b010, 0b111},
+	'2': {0b111, 0b001, 0b111, 0b100, 0b111},
+	'3': {0b111, 0b001, 0b111, 0b001, 0b111},
+	'4': {0b101, 0b101, 0b111, 0b001, 0b001},
+	'5': {0b111, 0b100, 0b111, 0b001, 0b111},
+	'6': {0b111, 0b100, 0b111, 0b101, 0b111},
+	'7': {0b111, 0b001, 0b001, 0b001, 0b001},
+	'8': {0b111, 0b101, 0b111, 0b101, 0b111},
+	'9': {0b111, 0b101, 0b111, 0b001, 0b111},
+	'.': {0b000, 0b000, 0b000, 0b000, 0b010},
+	'-': {0b000, 0b000, 0b111, 0b000, 0b000},
+	':': {0b000, 0b010, 0b000, 0b010, 0b000},
+	'/': {0b001, 0b001, 0b010, 0b100, 0b100},
+	'K': {0b101, 0b101, 0b110, 0b101, 0b101},
+	'M': {0b101, 0b111, 0b111, 0b101, 0b101},
+	'B': {0b110, 0b101, 0b110, 0b101, 0b110},
+	' ': {},
+}
+
+const (
+	glyphScale   = 2
+	glyphAdvance = 4 * glyphScale
+	glyphHeight  = 5 * glyphScale
+)
+
+func textWidth(s string) int {
+	return len([]rune(s))*glyphAdvance - glyphScale
+}
+
+// drawText draws s with its top left corner at x, y. Characters without a glyph are left blank.
+func drawText(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		rows := glyphs[r]
+		for row, bits := range rows {
+			for col := 0; col < 3; col++ {
+				if bits&(0b100>>col) != 0 {
+					fillRect(img, x+col*glyphScale, y+row*glyphScale, x+(col+1)*glyphScale, y+(row+1)*glyphScale, c)
+				}
+			}
+		}
+		x += glyphAdvance
+	}
+}
+
+// fillRect fills the rectangle from x0, y0 up to but not including x1, y1, in any corner order.
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	r := image.Rect(x0, y0, x1, y1).Canon()
+	draw.Draw(img, r, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+// drawLine draws a one pixel line with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		if (image.Point{X: x0, Y: y0}).In(img.Rect) {
+			img.SetRGBA(x0, y0, c)
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// drawThickLine draws a two pixel wide line, which reads better than one pixel on high DPI screens.
+func drawThickLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	drawLine(img, x0, y0, x1, y1, c)
+	if abs(x1-x0) > abs(y1-y0) {
+		drawLine(img, x0, y0+1, x1, y1+1, c)
+	} else {
+		drawLine(img, x0+1, y0, x1+1, y1, c)
+	}
+}
+
+// fillTriangle fills a triangle pointing up or down with its tip at x, y.
+func fillTriangle(img *image.RGBA, x, y, size int, up bool, c color.RGBA) {
+	for row := 0; row <= size; row++ {
+		yy := y + row
+		if !up {
+			yy = y - row
+		}
+		fillRect(img, x-row/2, yy, x+row/2+1, yy+1, c)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
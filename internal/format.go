@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+
+	formatArg = "format"
+)
+
+// requestFormat returns the output format asked for by the tool call, JSON by default.
+func requestFormat(request mcp.CallToolRequest) (string, error) {
+	format, _ := request.Params.Arguments[formatArg].(string)
+	switch format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCSV, FormatMarkdown:
+		return format, nil
+	default:
+		return "", fmt.Errorf("format %q must be %s, %s or %s", format, FormatJSON, FormatCSV, FormatMarkdown)
+	}
+}
+
+// listResult returns rows in the format asked for by the tool call.
+func (z *ZerodhaMcpServer) listResult(request mcp.CallToolRequest, summary string, rows any) (*mcp.CallToolResult, error) {
+	return z.formattedResult(request, summary, rows, rows)
+}
+
+// formattedResult returns body as JSON, or rows as a CSV or Markdown table. Tools whose JSON
+// result wraps the rows, e.g. with the accounts skipped by an aggregation, pass both. body is
+// returned whenever there is no query and it fits the response budget; otherwise the rows are
+// returned, one page at a time.
+func (z *ZerodhaMcpServer) formattedResult(request mcp.CallToolRequest, summary string, body, rows any) (*mcp.CallToolResult, error) {
+	format, err := requestFormat(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	query, err := parseQuery(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	budget, err := z.requestBudget(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	start, err := decodeCursor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Without a budget the whole body is returned. With one, the rows are written one at a time
+	// first so a large result is never encoded in full only to be cut.
+	wholeBody := format == FormatJSON && query.IsZero() && start == 0
+	if wholeBody && budget == 0 {
+		text, err := json.Marshal(normalize(body))
+		if err != nil {
+			return nil, err
+		}
+		return textResult(summary, string(text)), nil
+	}
+
+	set := newRowSet(rows)
+	if !query.IsZero() {
+		var matched int
+		set, matched, err = query.Apply(set)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		summary += fmt.Sprintf(" %d matched the query, %d after limit and offset.", matched, len(set.rows))
+	}
+	if start > len(set.rows) {
+		return mcp.NewToolResultError("cursor is past the end of the result, repeat the call without a cursor"), nil
+	}
+
+	text, next, err := writeRows(format, set, start, budget)
+	if err != nil {
+		return nil, err
+	}
+	if wholeBody && next == len(set.rows) {
+		bodyText, err := json.Marshal(normalize(body))
+		if err != nil {
+			return nil, err
+		}
+		if len(bodyText) <= budget {
+			return textResult(summary, string(bodyText)), nil
+		}
+	}
+	if start > 0 || next < len(set.rows) {
+		summary += fmt.Sprintf(" Rows %d-%d of %d.", start+1, next, len(set.rows))
+	}
+	if next < len(set.rows) {
+		omitted := len(set.rows) - next
+		perRow := len(text) / max(next-start, 1)
+		summary += fmt.Sprintf(" Output was cut at the %d byte response budget, %d more rows (about %d bytes) were omitted. Call again with the same arguments and cursor=%q for the next page, or narrow the result with fields, filter or limit.",
+			budget, omitted, omitted*perRow, encodeCursor(request, next))
+	}
+	return textResult(summary, text), nil
+}
+
+func textResult(summary, text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(summary),
+			mcp.NewTextContent(text),
+		},
+	}
+}
+
+// rowSet is a list of Kite structs normalized into objects that share the same columns.
+// Columns follow the field order of the struct, so every Kite type always has the same
+// column order, including when the list is empty.
+type rowSet struct {
+	columns []string
+	rows    []object
+}
+
+func newRowSet(rows any) rowSet {
+	rv := reflect.ValueOf(rows)
+	set := rowSet{
+		columns: tableColumns(rv.Type().Elem()),
+		rows:    make([]object, 0, rv.Len()),
+	}
+	for i := 0; i < rv.Len(); i++ {
+		row, ok := normalizeValue(rv.Index(i)).(object)
+		if !ok {
+			row = object{{Key: set.columns[0], Value: normalizeValue(rv.Index(i))}}
+		}
+		set.rows = append(set.rows, row)
+	}
+	return set
+}
+
+// record returns the cells of a row, with nested values encoded as JSON.
+func (s rowSet) record(row object) []string {
+	record := make([]string, len(s.columns))
+	for j, m := range row {
+		if j < len(record) {
+			record[j] = tableCell(m.Value)
+		}
+	}
+	return record
+}
+
+func tableColumns(elem reflect.Type) []string {
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct || elem == timeType || elem == modelsTimeType {
+		return []string{"value"}
+	}
+
+	obj := normalizeStruct(reflect.New(elem).Elem())
+	columns := make([]string, len(obj))
+	for i, m := range obj {
+		columns[i] = m.Key
+	}
+	return columns
+}
+
+func tableCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case object, []any:
+		body, _ := json.Marshal(v)
+		return string(body)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeRows renders rows from start on, one row at a time, and stops before the output would
+// exceed budget bytes. At least one row is always written. It returns the index of the first
+// row that was not written.
+func writeRows(format string, set rowSet, start, budget int) (string, int, error) {
+	var (
+		out    bytes.Buffer
+		row    bytes.Buffer
+		footer string
+	)
+	csvWriter := csv.NewWriter(&row)
+	renderRow := func(i int) error {
+		row.Reset()
+		switch format {
+		case FormatJSON:
+			if i > start {
+				row.WriteByte(',')
+			}
+			body, err := json.Marshal(set.rows[i])
+			if err != nil {
+				return err
+			}
+			row.Write(body)
+		case FormatCSV:
+			if err := csvWriter.Write(set.record(set.rows[i])); err != nil {
+				return err
+			}
+			csvWriter.Flush()
+			return csvWriter.Error()
+		default:
+			writeMarkdownRow(&row, set.record(set.rows[i]))
+		}
+		return nil
+	}
+
+	switch format {
+	case FormatJSON:
+		out.WriteByte('[')
+		footer = "]"
+	case FormatCSV:
+		w := csv.NewWriter(&out)
+		if err := w.Write(set.columns); err != nil {
+			return "", 0, err
+		}
+		w.Flush()
+	default:
+		writeMarkdownRow(&out, set.columns)
+		out.WriteString("|")
+		for range set.columns {
+			out.WriteString(" --- |")
+		}
+		out.WriteString("\n")
+	}
+
+	next := start
+	for ; next < len(set.rows); next++ {
+		if err := renderRow(next); err != nil {
+			return "", 0, err
+		}
+		if budget > 0 && next > start && out.Len()+row.Len()+len(footer) > budget {
+			break
+		}
+		out.Write(row.Bytes())
+	}
+	out.WriteString(footer)
+	return out.String(), next, nil
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+func writeMarkdownRow(b *bytes.Buffer, cells []string) {
+	b.WriteString("|")
+	for _, cell := range cells {
+		b.WriteString(" ")
+		b.WriteString(markdownEscaper.Replace(cell))
+		b.WriteString(" |")
+	}
+	b.WriteString("\n")
+}
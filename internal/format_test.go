@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Prices is embedded in testRow like models.OHLC is in Kite quotes.
+type Prices struct {
+	Open  float64 `json:"open"`
+	Close float64 `json:"close"`
+}
+
+type testRow struct {
+	Symbol string `json:"tradingsymbol"`
+	Prices
+	LastPrice float64
+	Note      string   `json:"note"`
+	Tags      []string `json:"tags"`
+}
+
+var testRows = []testRow{
+	{Symbol: "INFY", Prices: Prices{Open: 1500.5, Close: 1510}, LastPrice: 1510, Note: "a|b", Tags: []string{"x"}},
+	{Symbol: "TCS", Prices: Prices{Open: 4000, Close: 3990.25}, LastPrice: 3990.25, Note: `say "hi", ok`},
+}
+
+func callRequest(args map[string]any) mcp.CallToolRequest {
+	var request mcp.CallToolRequest
+	request.Params.Arguments = args
+	return request
+}
+
+func TestListResultFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		rows   []testRow
+		want   string
+	}{
+		{
+			name: "json by default",
+			rows: testRows,
+			want: `[{"tradingsymbol":"INFY","open":1500.5,"close":1510,"last_price":1510,"note":"a|b","tags":["x"]},` +
+				`{"tradingsymbol":"TCS","open":4000,"close":3990.25,"last_price":3990.25,"note":"say \"hi\", ok","tags":[]}]`,
+		},
+		{
+			name:   "csv",
+			format: FormatCSV,
+			rows:   testRows,
+			want: "tradingsymbol,open,close,last_price,note,tags\n" +
+				"INFY,1500.5,1510,1510,a|b,\"[\"\"x\"\"]\"\n" +
+				"TCS,4000,3990.25,3990.25,\"say \"\"hi\"\", ok\",[]\n",
+		},
+		{
+			name:   "markdown",
+			format: FormatMarkdown,
+			rows:   testRows,
+			want: "| tradingsymbol | open | close | last_price | note | tags |\n" +
+				"| --- | --- | --- | --- | --- | --- |\n" +
+				"| INFY | 1500.5 | 1510 | 1510 | a\\|b | [\"x\"] |\n" +
+				"| TCS | 4000 | 3990.25 | 3990.25 | say \"hi\", ok | [] |\n",
+		},
+		{
+			name: "empty json",
+			rows: []testRow{},
+			want: "[]",
+		},
+		{
+			name:   "empty csv keeps the columns",
+			format: FormatCSV,
+			rows:   []testRow{},
+			want:   "tradingsymbol,open,close,last_price,note,tags\n",
+		},
+		{
+			name:   "empty markdown keeps the columns",
+			format: FormatMarkdown,
+			rows:   []testRow{},
+			want:   "| tradingsymbol | open | close | last_price | note | tags |\n| --- | --- | --- | --- | --- | --- |\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]any{}
+			if tt.format != "" {
+				args[formatArg] = tt.format
+			}
+			z := &ZerodhaMcpServer{}
+			result, err := z.listResult(callRequest(args), "summary", tt.rows)
+			_, text := resultText(t, result, err)
+			if text != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", text, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		rows any
+		want []string
+	}{
+		{name: "struct fields in order, embedded flattened", rows: []testRow{}, want: []string{"tradingsymbol", "open", "close", "last_price", "note", "tags"}},
+		{name: "pointers to structs", rows: []*Prices{}, want: []string{"open", "close"}},
+		{name: "scalars", rows: []string{}, want: []string{"value"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newRowSet(tt.rows).columns
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestFormat(t *testing.T) {
+	tests := []struct {
+		format  any
+		want    string
+		wantErr bool
+	}{
+		{format: nil, want: FormatJSON},
+		{format: "", want: FormatJSON},
+		{format: FormatCSV, want: FormatCSV},
+		{format: FormatMarkdown, want: FormatMarkdown},
+		{format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := requestFormat(callRequest(map[string]any{formatArg: tt.format}))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("requestFormat(%v) = %q, %v; want %q, error %v", tt.format, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,867 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// GTT types as the GTT tools name them. Kite calls an OCO GTT "two-leg".
+const (
+	GTTSingle = "single"
+	GTTOCO    = "oco"
+)
+
+// Rules propose_gtts can place the stop-loss and target by.
+const (
+	GTTRulePercent = "percent"
+	GTTRuleATR     = "atr"
+)
+
+var (
+	GTTTypes    = []string{GTTSingle, GTTOCO}
+	GTTProducts = []string{kiteconnect.ProductCNC, kiteconnect.ProductNRML}
+	GTTRules    = []string{GTTRulePercent, GTTRuleATR}
+)
+
+const (
+	gttStatusActive = "active"
+
+	defaultStoplossPct    = 5
+	defaultTargetPct      = 10
+	defaultATRPeriod      = 14
+	defaultStoplossATR    = 2
+	defaultTargetATR      = 4
+	defaultLimitOffsetPct = 0.5
+)
+
+// gttRequest is a GTT as given to create_gtt and modify_gtt. A single GTT uses TriggerPrice and
+// Price; an OCO GTT a lower leg, the stop-loss of a sell, and an upper leg, its target.
+type gttRequest struct {
+	Type            string  `json:"type"`
+	Exchange        string  `json:"exchange"`
+	Tradingsymbol   string  `json:"tradingsymbol"`
+	TransactionType string  `json:"transaction_type"`
+	Product         string  `json:"product"`
+	Quantity        int     `json:"quantity"`
+	TriggerPrice    float64 `json:"trigger_price"`
+	Price           float64 `json:"price"`
+	LowerTrigger    float64 `json:"lower_trigger"`
+	LowerPrice      float64 `json:"lower_price"`
+	UpperTrigger    float64 `json:"upper_trigger"`
+	UpperPrice      float64 `json:"upper_price"`
+}
+
+func (g gttRequest) instrument() string {
+	return g.Exchange + ":" + g.Tradingsymbol
+}
+
+func (g gttRequest) params(lastPrice float64) kiteconnect.GTTParams {
+	params := kiteconnect.GTTParams{
+		Tradingsymbol:   g.Tradingsymbol,
+		Exchange:        g.Exchange,
+		LastPrice:       lastPrice,
+		TransactionType: g.TransactionType,
+		Product:         g.Product,
+	}
+	quantity := float64(g.Quantity)
+	if g.Type == GTTOCO {
+		params.Trigger = &kiteconnect.GTTOneCancelsOtherTrigger{
+			Lower: kiteconnect.TriggerParams{TriggerValue: g.LowerTrigger, LimitPrice: g.LowerPrice, Quantity: quantity},
+			Upper: kiteconnect.TriggerParams{TriggerValue: g.UpperTrigger, LimitPrice: g.UpperPrice, Quantity: quantity},
+		}
+	} else {
+		params.Trigger = &kiteconnect.GTTSingleLegTrigger{
+			TriggerParams: kiteconnect.TriggerParams{TriggerValue: g.TriggerPrice, LimitPrice: g.Price, Quantity: quantity},
+		}
+	}
+	return params
+}
+
+// legs returns the limit orders the GTT places when it triggers, for the risk rules.
+func (g gttRequest) legs() []orderRequest {
+	leg := orderRequest{
+		Variety:         kiteconnect.VarietyRegular,
+		Exchange:        g.Exchange,
+		Tradingsymbol:   g.Tradingsymbol,
+		TransactionType: g.TransactionType,
+		Quantity:        g.Quantity,
+		Product:         g.Product,
+		OrderType:       kiteconnect.OrderTypeLimit,
+		Validity:        kiteconnect.ValidityDay,
+	}
+	if g.Type != GTTOCO {
+		leg.Price = g.Price
+		return []orderRequest{leg}
+	}
+	lower, upper := leg, leg
+	lower.Price, upper.Price = g.LowerPrice, g.UpperPrice
+	return []orderRequest{lower, upper}
+}
+
+// describe returns a one line description such as "OCO GTT SELL 10 NSE:INFY CNC, lower trigger 1400 at 1393, upper trigger 1700 at 1700".
+func (g gttRequest) describe() string {
+	text := fmt.Sprintf("%s GTT %s %d %s %s", strings.ToUpper(g.Type), g.TransactionType, g.Quantity, g.instrument(), g.Product)
+	if g.Type == GTTOCO {
+		return text + fmt.Sprintf(", lower trigger %g at %g, upper trigger %g at %g", g.LowerTrigger, g.LowerPrice, g.UpperTrigger, g.UpperPrice)
+	}
+	return text + fmt.Sprintf(", trigger %g at %g", g.TriggerPrice, g.Price)
+}
+
+// gttFromKite describes an existing GTT in the same form as a new one.
+func gttFromKite(gtt kiteconnect.GTT) gttRequest {
+	g := gttRequest{
+		Type:          GTTSingle,
+		Exchange:      gtt.Condition.Exchange,
+		Tradingsymbol: gtt.Condition.Tradingsymbol,
+	}
+	if gtt.Type == kiteconnect.GTTTypeOCO {
+		g.Type = GTTOCO
+	}
+	if len(gtt.Orders) > 0 {
+		g.TransactionType, g.Product, g.Quantity = gtt.Orders[0].TransactionType, gtt.Orders[0].Product, int(gtt.Orders[0].Quantity)
+	}
+	triggers := gtt.Condition.TriggerValues
+	switch {
+	case g.Type == GTTOCO && len(triggers) == 2 && len(gtt.Orders) == 2:
+		g.LowerTrigger, g.UpperTrigger = triggers[0], triggers[1]
+		g.LowerPrice, g.UpperPrice = gtt.Orders[0].Price, gtt.Orders[1].Price
+	case g.Type == GTTSingle && len(triggers) == 1 && len(gtt.Orders) == 1:
+		g.TriggerPrice, g.Price = triggers[0], gtt.Orders[0].Price
+	}
+	return g
+}
+
+// parseGTTArgs applies the arguments of create_gtt or modify_gtt to g, which holds the defaults
+// or the GTT being modified.
+func parseGTTArgs(args map[string]any, g gttRequest) (gttRequest, error) {
+	var err error
+	if g.Type, err = enumArg(args, "type", g.Type, GTTTypes); err != nil {
+		return g, err
+	}
+	if g.TransactionType, err = enumArg(args, "transaction_type", g.TransactionType, TransactionTypes); err != nil {
+		return g, err
+	}
+	if g.TransactionType == "" {
+		return g, errors.New("transaction_type is required")
+	}
+	if g.Product, err = enumArg(args, "product", g.Product, GTTProducts); err != nil {
+		return g, err
+	}
+	if _, ok := args["quantity"]; ok {
+		if g.Quantity, err = intArg(args, "quantity"); err != nil {
+			return g, err
+		}
+	}
+	for name, target := range map[string]*float64{
+		"trigger_price": &g.TriggerPrice,
+		"price":         &g.Price,
+		"lower_trigger": &g.LowerTrigger,
+		"lower_price":   &g.LowerPrice,
+		"upper_trigger": &g.UpperTrigger,
+		"upper_price":   &g.UpperPrice,
+	} {
+		if _, ok := args[name]; ok {
+			if *target, err = floatArg(args, name); err != nil {
+				return g, err
+			}
+		}
+	}
+
+	// Prices of the other type are left over when a GTT changes type
+	if g.Type == GTTOCO {
+		g.TriggerPrice, g.Price = 0, 0
+	} else {
+		g.LowerTrigger, g.LowerPrice, g.UpperTrigger, g.UpperPrice = 0, 0, 0, 0
+	}
+	return g, nil
+}
+
+// checkGTT applies the rules Kite would reject a GTT for.
+func checkGTT(g gttRequest, instrument kiteconnect.Instrument, lastPrice float64) error {
+	if g.Quantity <= 0 {
+		return errors.New("quantity must be at least 1")
+	}
+	if lot := int(instrument.LotSize); lot > 1 && g.Quantity%lot != 0 {
+		return fmt.Errorf("quantity %d is not a multiple of the lot size %d of %s", g.Quantity, lot, g.instrument())
+	}
+
+	names, prices := []string{"trigger_price", "price"}, []float64{g.TriggerPrice, g.Price}
+	if g.Type == GTTOCO {
+		names = []string{"lower_trigger", "lower_price", "upper_trigger", "upper_price"}
+		prices = []float64{g.LowerTrigger, g.LowerPrice, g.UpperTrigger, g.UpperPrice}
+	}
+	for i, price := range prices {
+		if price <= 0 {
+			return fmt.Errorf("%s GTTs need %s", strings.ToUpper(g.Type), names[i])
+		}
+		if !onTick(price, instrument.TickSize) {
+			return fmt.Errorf("%s %g is not a multiple of the tick size %g of %s", names[i], price, instrument.TickSize, g.instrument())
+		}
+	}
+
+	if g.Type == GTTOCO {
+		if g.LowerTrigger >= g.UpperTrigger {
+			return errors.New("lower_trigger must be below upper_trigger")
+		}
+		if lastPrice > 0 && (g.LowerTrigger >= lastPrice || g.UpperTrigger <= lastPrice) {
+			return fmt.Errorf("the last price %g must lie between lower_trigger %g and upper_trigger %g", lastPrice, g.LowerTrigger, g.UpperTrigger)
+		}
+	} else if lastPrice > 0 && g.TriggerPrice == lastPrice {
+		return fmt.Errorf("trigger_price %g must differ from the last price", g.TriggerPrice)
+	}
+	return nil
+}
+
+// checkGTTRisk applies the risk rules to each order the GTT may place. A GTT counts once
+// against the rate limit.
+func (z *ZerodhaMcpServer) checkGTTRisk(kc *kiteconnect.Client, action string, g gttRequest, commit bool) error {
+	legs := g.legs()
+	for i, leg := range legs {
+		if err := z.risk.Check(kc, action, leg, 0, commit && i == len(legs)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gttLastPrice(kc *kiteconnect.Client, g gttRequest) (float64, error) {
+	ltp, err := kc.GetLTP(g.instrument())
+	if err != nil {
+		return 0, fmt.Errorf("last price of %s: %w", g.instrument(), err)
+	}
+	return ltp[g.instrument()].LastPrice, nil
+}
+
+// GTTPreview is what a GTT change would do, returned before anything is sent to Kite.
+type GTTPreview struct {
+	Action            string        `json:"action"`
+	Account           string        `json:"account"`
+	TriggerID         int           `json:"trigger_id"`
+	GTT               gttRequest    `json:"gtt"`
+	Changes           []orderChange `json:"changes"`
+	Name              string        `json:"name"`
+	InstrumentToken   int           `json:"instrument_token"`
+	LotSize           float64       `json:"lot_size"`
+	TickSize          float64       `json:"tick_size"`
+	LastPrice         float64       `json:"last_price"`
+	HoldingQuantity   int           `json:"holding_quantity"`
+	Warnings          []string      `json:"warnings"`
+	ConfirmationToken string        `json:"confirmation_token"`
+	ExpiresAt         time.Time     `json:"expires_at"`
+}
+
+func previewGTT(kc *kiteconnect.Client, action string, g gttRequest, instrument kiteconnect.Instrument, lastPrice float64) GTTPreview {
+	preview := GTTPreview{
+		Action:          action,
+		GTT:             g,
+		Name:            instrument.Name,
+		InstrumentToken: instrument.InstrumentToken,
+		LotSize:         instrument.LotSize,
+		TickSize:        instrument.TickSize,
+		LastPrice:       lastPrice,
+		Warnings:        []string{},
+	}
+	if g.Product == kiteconnect.ProductCNC && g.TransactionType == kiteconnect.TransactionTypeSell {
+		if holdings, err := kc.GetHoldings(); err != nil {
+			preview.Warnings = append(preview.Warnings, "holdings unavailable: "+err.Error())
+		} else {
+			for _, holding := range holdings {
+				if holding.Exchange == g.Exchange && holding.Tradingsymbol == g.Tradingsymbol {
+					preview.HoldingQuantity += holding.Quantity + holding.T1Quantity
+				}
+			}
+			if g.Quantity > preview.HoldingQuantity {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("selling %d with CNC but only %d are held", g.Quantity, preview.HoldingQuantity))
+			}
+		}
+	}
+	if g.TransactionType == kiteconnect.TransactionTypeSell && g.Type == GTTOCO && g.LowerPrice > g.LowerTrigger {
+		preview.Warnings = append(preview.Warnings, "lower_price is above lower_trigger, so the stop-loss may not fill in a falling market")
+	}
+	return preview
+}
+
+func (z *ZerodhaMcpServer) gttPreviewResult(ctx context.Context, request mcp.CallToolRequest, preview GTTPreview, description string) (*mcp.CallToolResult, error) {
+	var err error
+	preview.Account, preview.ConfirmationToken, preview.ExpiresAt, err = z.issueConfirmation(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("Preview only, nothing was sent: %s.", description)
+	if preview.LastPrice > 0 {
+		summary += fmt.Sprintf(" Last price %g.", preview.LastPrice)
+	}
+	if len(preview.Warnings) > 0 {
+		summary += " Warnings: " + strings.Join(preview.Warnings, "; ") + "."
+	}
+	summary += confirmationPrompt(request, preview.ConfirmationToken, preview.ExpiresAt)
+	return jsonResult(summary, preview)
+}
+
+type gttResult struct {
+	Action    string `json:"action"`
+	Account   string `json:"account"`
+	TriggerID int    `json:"trigger_id"`
+}
+
+func triggerIDArg(args map[string]any) (int, error) {
+	id, err := intArg(args, "trigger_id")
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, errors.New("trigger_id is required")
+	}
+	return id, nil
+}
+
+// gttRow is a GTT in a GTT table.
+type gttRow struct {
+	ID                 int         `json:"id"`
+	Type               string      `json:"type"`
+	Status             string      `json:"status"`
+	Exchange           string      `json:"exchange"`
+	Tradingsymbol      string      `json:"tradingsymbol"`
+	TransactionType    string      `json:"transaction_type"`
+	Product            string      `json:"product"`
+	Quantity           int         `json:"quantity"`
+	TriggerValues      []float64   `json:"trigger_values"`
+	LimitPrices        []float64   `json:"limit_prices"`
+	ConditionLastPrice float64     `json:"condition_last_price"`
+	CreatedAt          models.Time `json:"created_at"`
+	UpdatedAt          models.Time `json:"updated_at"`
+	ExpiresAt          models.Time `json:"expires_at"`
+	RejectionReason    string      `json:"rejection_reason"`
+}
+
+func newGTTRow(gtt kiteconnect.GTT) gttRow {
+	g := gttFromKite(gtt)
+	row := gttRow{
+		ID:                 gtt.ID,
+		Type:               g.Type,
+		Status:             gtt.Status,
+		Exchange:           g.Exchange,
+		Tradingsymbol:      g.Tradingsymbol,
+		TransactionType:    g.TransactionType,
+		Product:            g.Product,
+		Quantity:           g.Quantity,
+		TriggerValues:      gtt.Condition.TriggerValues,
+		LimitPrices:        make([]float64, len(gtt.Orders)),
+		ConditionLastPrice: gtt.Condition.LastPrice,
+		CreatedAt:          gtt.CreatedAt,
+		UpdatedAt:          gtt.UpdatedAt,
+		ExpiresAt:          gtt.ExpiresAt,
+		RejectionReason:    gtt.Meta.RejectionReason,
+	}
+	for i, order := range gtt.Orders {
+		row.LimitPrices[i] = order.Price
+	}
+	return row
+}
+
+func (z *ZerodhaMcpServer) GTTs() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		filter, err := parseOrderFilter(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		gtts, err := z.client(ctx).GetGTTs()
+		if err != nil {
+			return nil, err
+		}
+		rows := make([]gttRow, 0, len(gtts))
+		active := 0
+		for _, gtt := range gtts {
+			if filter.matchStatus(strings.ToUpper(gtt.Status)) && filter.matchSymbol(gtt.Condition.Exchange, gtt.Condition.Tradingsymbol) {
+				rows = append(rows, newGTTRow(gtt))
+				if gtt.Status == gttStatusActive {
+					active++
+				}
+			}
+		}
+		return z.listResult(request, fmt.Sprintf("%s, %d active.", countSummary(len(rows), "GTT"), active), rows)
+	}
+}
+
+func (z *ZerodhaMcpServer) GTT() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, err := triggerIDArg(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		gtt, err := z.client(ctx).GetGTT(id)
+		if err != nil {
+			return nil, err
+		}
+		summary := fmt.Sprintf("GTT %d, %s, status %s.", gtt.ID, gttFromKite(gtt).describe(), gtt.Status)
+		if gtt.Meta.RejectionReason != "" {
+			summary += fmt.Sprintf(" Rejected: %s.", strings.TrimSuffix(gtt.Meta.RejectionReason, "."))
+		}
+		return jsonResult(summary, gtt)
+	}
+}
+
+func (z *ZerodhaMcpServer) CreateGTT() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if result := z.refuseReadOnly(); result != nil {
+			return result, nil
+		}
+		args := request.Params.Arguments
+		kc := z.client(ctx)
+
+		symbol, _ := args["instrument"].(string)
+		if strings.TrimSpace(symbol) == "" {
+			return mcp.NewToolResultError("instrument is required"), nil
+		}
+		instrument, err := z.resolveInstrument(kc, symbol)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if instrument.Tradingsymbol == "" {
+			return mcp.NewToolResultError(fmt.Sprintf("instrument %q is not in the instrument master, GTTs need an exchange:tradingsymbol", symbol)), nil
+		}
+
+		g, err := parseGTTArgs(args, gttRequest{
+			Type:          GTTSingle,
+			Exchange:      instrument.Exchange,
+			Tradingsymbol: instrument.Tradingsymbol,
+			Product:       kiteconnect.ProductCNC,
+		})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		lastPrice, err := gttLastPrice(kc, g)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkGTT(g, instrument, lastPrice); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if !confirming(request) {
+			if err := z.checkGTTRisk(kc, "place", g, false); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return z.gttPreviewResult(ctx, request, previewGTT(kc, "create", g, instrument, lastPrice), "create "+g.describe())
+		}
+		if result := z.consumeConfirmation(ctx, request); result != nil {
+			return result, nil
+		}
+		if err := z.checkGTTRisk(kc, "place", g, true); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		response, err := kc.PlaceGTT(g.params(lastPrice))
+		if err != nil {
+			return nil, err
+		}
+		account := z.accountFor(ctx).Name
+		slog.Info("GTT created", "account", account, "trigger_id", response.TriggerID, "gtt", g.describe())
+		return jsonResult(fmt.Sprintf("Created %s, trigger ID %d.", g.describe(), response.TriggerID),
+			gttResult{Action: "create", Account: account, TriggerID: response.TriggerID})
+	}
+}
+
+func gttChanges(before, after gttRequest) []orderChange {
+	var changes []orderChange
+	add := func(field string, from, to any) {
+		if from != to {
+			changes = append(changes, orderChange{Field: field, From: from, To: to})
+		}
+	}
+	add("type", before.Type, after.Type)
+	add("transaction_type", before.TransactionType, after.TransactionType)
+	add("product", before.Product, after.Product)
+	add("quantity", before.Quantity, after.Quantity)
+	add("trigger_price", before.TriggerPrice, after.TriggerPrice)
+	add("price", before.Price, after.Price)
+	add("lower_trigger", before.LowerTrigger, after.LowerTrigger)
+	add("lower_price", before.LowerPrice, after.LowerPrice)
+	add("upper_trigger", before.UpperTrigger, after.UpperTrigger)
+	add("upper_price", before.UpperPrice, after.UpperPrice)
+	return changes
+}
+
+func (z *ZerodhaMcpServer) ModifyGTT() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if result := z.refuseReadOnly(); result != nil {
+			return result, nil
+		}
+		args := request.Params.Arguments
+		kc := z.client(ctx)
+
+		id, err := triggerIDArg(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		gtt, err := kc.GetGTT(id)
+		if err != nil {
+			return nil, err
+		}
+		if gtt.Status != gttStatusActive {
+			return mcp.NewToolResultError(fmt.Sprintf("GTT %d is %s and can no longer be modified", id, gtt.Status)), nil
+		}
+
+		before := gttFromKite(gtt)
+		g, err := parseGTTArgs(args, before)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		changes := gttChanges(before, g)
+		if len(changes) == 0 {
+			return mcp.NewToolResultError("nothing to change, give a new type, quantity, trigger or price"), nil
+		}
+
+		instrument, err := z.orderInstrument(kc, g.legs()[0])
+		if err != nil {
+			return nil, err
+		}
+		lastPrice, err := gttLastPrice(kc, g)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkGTT(g, instrument, lastPrice); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if !confirming(request) {
+			if err := z.checkGTTRisk(kc, "modify", g, false); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			preview := previewGTT(kc, "modify", g, instrument, lastPrice)
+			preview.TriggerID, preview.Changes = id, changes
+			return z.gttPreviewResult(ctx, request, preview, fmt.Sprintf("modify GTT %d to %s", id, g.describe()))
+		}
+		if result := z.consumeConfirmation(ctx, request); result != nil {
+			return result, nil
+		}
+		if err := z.checkGTTRisk(kc, "modify", g, true); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		response, err := kc.ModifyGTT(id, g.params(lastPrice))
+		if err != nil {
+			return nil, err
+		}
+		account := z.accountFor(ctx).Name
+		slog.Info("GTT modified", "account", account, "trigger_id", response.TriggerID, "gtt", g.describe())
+		return jsonResult(fmt.Sprintf("Modified GTT %d to %s.", response.TriggerID, g.describe()),
+			gttResult{Action: "modify", Account: account, TriggerID: response.TriggerID})
+	}
+}
+
+func (z *ZerodhaMcpServer) DeleteGTT() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if result := z.refuseReadOnly(); result != nil {
+			return result, nil
+		}
+		kc := z.client(ctx)
+
+		id, err := triggerIDArg(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		gtt, err := kc.GetGTT(id)
+		if err != nil {
+			return nil, err
+		}
+		g := gttFromKite(gtt)
+
+		if !confirming(request) {
+			if err := z.checkGTTRisk(kc, "cancel", g, false); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			instrument, err := z.orderInstrument(kc, g.legs()[0])
+			if err != nil {
+				return nil, err
+			}
+			preview := GTTPreview{
+				Action:          "delete",
+				TriggerID:       id,
+				GTT:             g,
+				Name:            instrument.Name,
+				InstrumentToken: instrument.InstrumentToken,
+				LotSize:         instrument.LotSize,
+				TickSize:        instrument.TickSize,
+				Warnings:        []string{},
+			}
+			if gtt.Status == gttStatusActive && g.TransactionType == kiteconnect.TransactionTypeSell {
+				preview.Warnings = append(preview.Warnings, "the position loses the protection of this GTT")
+			}
+			return z.gttPreviewResult(ctx, request, preview, fmt.Sprintf("delete GTT %d, %s, status %s", id, g.describe(), gtt.Status))
+		}
+		if result := z.consumeConfirmation(ctx, request); result != nil {
+			return result, nil
+		}
+		if err := z.checkGTTRisk(kc, "cancel", g, true); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		response, err := kc.DeleteGTT(id)
+		if err != nil {
+			return nil, err
+		}
+		account := z.accountFor(ctx).Name
+		slog.Info("GTT deleted", "account", account, "trigger_id", response.TriggerID)
+		return jsonResult(fmt.Sprintf("Deleted GTT %d, %s.", response.TriggerID, g.describe()),
+			gttResult{Action: "delete", Account: account, TriggerID: response.TriggerID})
+	}
+}
+
+// GTTProposal is an OCO GTT proposed for a holding. Its first fields are the create_gtt arguments.
+type GTTProposal struct {
+	Instrument      string  `json:"instrument"`
+	Type            string  `json:"type"`
+	TransactionType string  `json:"transaction_type"`
+	Product         string  `json:"product"`
+	Quantity        int     `json:"quantity"`
+	LowerTrigger    float64 `json:"lower_trigger"`
+	LowerPrice      float64 `json:"lower_price"`
+	UpperTrigger    float64 `json:"upper_trigger"`
+	UpperPrice      float64 `json:"upper_price"`
+	LastPrice       float64 `json:"last_price"`
+	AveragePrice    float64 `json:"average_price"`
+	ATR             float64 `json:"atr"`
+	StoplossPct     float64 `json:"stoploss_pct"`
+	TargetPct       float64 `json:"target_pct"`
+	PnLAtStoploss   float64 `json:"pnl_at_stoploss"`
+	PnLAtTarget     float64 `json:"pnl_at_target"`
+}
+
+type skippedHolding struct {
+	Instrument string `json:"instrument"`
+	Reason     string `json:"reason"`
+}
+
+type gttProposals struct {
+	Rule      string           `json:"rule"`
+	Proposals []GTTProposal    `json:"proposals"`
+	Skipped   []skippedHolding `json:"skipped"`
+}
+
+// gttRule places the stop-loss and target of a proposal.
+type gttRule struct {
+	name                   string
+	stoplossPct, targetPct float64
+	atrPeriod              int
+	stoplossATR, targetATR float64
+	limitOffsetPct         float64
+}
+
+func parseGTTRule(args map[string]any) (gttRule, error) {
+	r := gttRule{
+		stoplossPct:    defaultStoplossPct,
+		targetPct:      defaultTargetPct,
+		atrPeriod:      defaultATRPeriod,
+		stoplossATR:    defaultStoplossATR,
+		targetATR:      defaultTargetATR,
+		limitOffsetPct: defaultLimitOffsetPct,
+	}
+	var err error
+	if r.name, err = enumArg(args, "rule", GTTRulePercent, GTTRules); err != nil {
+		return r, err
+	}
+	for name, target := range map[string]*float64{
+		"stoploss_pct":     &r.stoplossPct,
+		"target_pct":       &r.targetPct,
+		"stoploss_atr":     &r.stoplossATR,
+		"target_atr":       &r.targetATR,
+		"limit_offset_pct": &r.limitOffsetPct,
+	} {
+		if _, ok := args[name]; ok {
+			if *target, err = floatArg(args, name); err != nil {
+				return r, err
+			}
+		}
+	}
+	if _, ok := args["atr_period"]; ok {
+		if r.atrPeriod, err = intArg(args, "atr_period"); err != nil {
+			return r, err
+		}
+	}
+
+	switch {
+	case r.stoplossPct <= 0 || r.stoplossPct >= 100:
+		return r, errors.New("stoploss_pct must be between 0 and 100")
+	case r.targetPct <= 0:
+		return r, errors.New("target_pct must be positive")
+	case r.stoplossATR <= 0 || r.targetATR <= 0:
+		return r, errors.New("stoploss_atr and target_atr must be positive")
+	case r.atrPeriod < 1:
+		return r, errors.New("atr_period must be at least 1")
+	case r.limitOffsetPct >= 100:
+		return r, errors.New("limit_offset_pct must be below 100")
+	}
+	return r, nil
+}
+
+func (r gttRule) String() string {
+	if r.name == GTTRuleATR {
+		return fmt.Sprintf("stop-loss %g and target %g times the %d day ATR from the last price", r.stoplossATR, r.targetATR, r.atrPeriod)
+	}
+	return fmt.Sprintf("stop-loss %g%% below and target %g%% above the last price", r.stoplossPct, r.targetPct)
+}
+
+// floorTick and ceilTick round a price down or up to the tick size.
+func floorTick(price, tick float64) float64 {
+	if tick <= 0 {
+		return price
+	}
+	return math.Round(math.Floor(price/tick+1e-9)*tick*1e4) / 1e4
+}
+
+func ceilTick(price, tick float64) float64 {
+	if tick <= 0 {
+		return price
+	}
+	return math.Round(math.Ceil(price/tick-1e-9)*tick*1e4) / 1e4
+}
+
+// holdingATR returns the latest average true range of daily candles.
+func (z *ZerodhaMcpServer) holdingATR(ctx context.Context, kc *kiteconnect.Client, instrument kiteconnect.Instrument, period int) (float64, error) {
+	to := time.Now().In(istLocation)
+	candles, _, err := z.candles.Candles(ctx, kc, candleRequest{
+		Token:    instrument.InstrumentToken,
+		Interval: "day",
+		From:     lookbackStart("day", period*3, to),
+		To:       to,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(candles) <= period {
+		return 0, fmt.Errorf("only %d daily candles, the ATR needs more than %d", len(candles), period)
+	}
+	series := atr(candles, period)
+	return series[len(series)-1], nil
+}
+
+// stopLossGTT returns the first of the active GTTs with a SELL leg that triggers below lastPrice,
+// which protects a holding. A target-only GTT above the price does not.
+func stopLossGTT(gtts []kiteconnect.GTT, lastPrice float64) (int, bool) {
+	for _, gtt := range gtts {
+		for i, order := range gtt.Orders {
+			if order.TransactionType != kiteconnect.TransactionTypeSell {
+				continue
+			}
+			trigger := order.Price
+			if i < len(gtt.Condition.TriggerValues) {
+				trigger = gtt.Condition.TriggerValues[i]
+			}
+			if trigger < lastPrice {
+				return gtt.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (z *ZerodhaMcpServer) ProposeGTTs() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.Params.Arguments
+		rule, err := parseGTTRule(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		filter, err := parseOrderFilter(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		kc := z.client(ctx)
+		holdings, err := kc.GetHoldings()
+		if err != nil {
+			return nil, err
+		}
+		gtts, err := kc.GetGTTs()
+		if err != nil {
+			return nil, err
+		}
+		active := map[string][]kiteconnect.GTT{}
+		for _, gtt := range gtts {
+			if gtt.Status == gttStatusActive {
+				symbol := gtt.Condition.Exchange + ":" + gtt.Condition.Tradingsymbol
+				active[symbol] = append(active[symbol], gtt)
+			}
+		}
+
+		result := gttProposals{Rule: rule.name, Proposals: []GTTProposal{}, Skipped: []skippedHolding{}}
+		for _, holding := range holdings {
+			symbol := holding.Exchange + ":" + holding.Tradingsymbol
+			quantity := holding.Quantity + holding.T1Quantity
+			if quantity <= 0 || !filter.matchSymbol(holding.Exchange, holding.Tradingsymbol) {
+				continue
+			}
+			skip := func(format string, args ...any) {
+				result.Skipped = append(result.Skipped, skippedHolding{Instrument: symbol, Reason: fmt.Sprintf(format, args...)})
+			}
+			if holding.LastPrice <= 0 {
+				skip("no last price")
+				continue
+			}
+			if id, ok := stopLossGTT(active[symbol], holding.LastPrice); ok {
+				skip("has active stop-loss GTT %d", id)
+				continue
+			}
+			instrument, err := z.resolveInstrument(kc, symbol)
+			if err != nil {
+				skip("%v", err)
+				continue
+			}
+
+			lastPrice := holding.LastPrice
+			stopDistance, targetDistance := lastPrice*rule.stoplossPct/100, lastPrice*rule.targetPct/100
+			atrValue := math.NaN()
+			if rule.name == GTTRuleATR {
+				if atrValue, err = z.holdingATR(ctx, kc, instrument, rule.atrPeriod); err != nil {
+					skip("ATR unavailable: %v", err)
+					continue
+				}
+				stopDistance, targetDistance = atrValue*rule.stoplossATR, atrValue*rule.targetATR
+			}
+			lowerTrigger := floorTick(lastPrice-stopDistance, instrument.TickSize)
+			if lowerTrigger <= 0 {
+				skip("the stop-loss of %.2f below the last price %g leaves no trigger", stopDistance, lastPrice)
+				continue
+			}
+			upperTrigger := ceilTick(lastPrice+targetDistance, instrument.TickSize)
+			lowerPrice := floorTick(lowerTrigger*(1-rule.limitOffsetPct/100), instrument.TickSize)
+
+			result.Proposals = append(result.Proposals, GTTProposal{
+				Instrument:      symbol,
+				Type:            GTTOCO,
+				TransactionType: kiteconnect.TransactionTypeSell,
+				Product:         kiteconnect.ProductCNC,
+				Quantity:        quantity,
+				LowerTrigger:    lowerTrigger,
+				LowerPrice:      lowerPrice,
+				UpperTrigger:    upperTrigger,
+				UpperPrice:      upperTrigger,
+				LastPrice:       lastPrice,
+				AveragePrice:    holding.AveragePrice,
+				ATR:             atrValue,
+				StoplossPct:     (1 - lowerTrigger/lastPrice) * 100,
+				TargetPct:       (upperTrigger/lastPrice - 1) * 100,
+				PnLAtStoploss:   (lowerPrice - holding.AveragePrice) * float64(quantity),
+				PnLAtTarget:     (upperTrigger - holding.AveragePrice) * float64(quantity),
+			})
+		}
+
+		summary := fmt.Sprintf("Proposed %s for holdings without an active stop-loss GTT, %s; skipped %d. Nothing was created. Show these to the user, then call create_gtt with the arguments of each approved proposal, which returns a preview to confirm.",
+			countSummary(len(result.Proposals), "OCO GTT"), rule, len(result.Skipped))
+		return z.formattedResult(request, summary, result, result.Proposals)
+	}
+}
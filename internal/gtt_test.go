@@ -0,0 +1,313 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+func TestParseGTTArgs(t *testing.T) {
+	defaults := gttRequest{Type: GTTSingle, Exchange: "NSE", Tradingsymbol: "INFY", Product: kiteconnect.ProductCNC}
+	oco := gttRequest{Type: GTTOCO, Exchange: "NSE", Tradingsymbol: "INFY", TransactionType: "SELL", Product: kiteconnect.ProductCNC, Quantity: 10,
+		LowerTrigger: 1400, LowerPrice: 1393, UpperTrigger: 1700, UpperPrice: 1700}
+	tests := []struct {
+		name    string
+		args    map[string]any
+		g       gttRequest
+		want    gttRequest
+		wantErr string
+	}{
+		{
+			name: "single",
+			args: map[string]any{"transaction_type": "buy", "quantity": float64(5), "trigger_price": float64(1400), "price": "1401.5"},
+			g:    defaults,
+			want: gttRequest{Type: GTTSingle, Exchange: "NSE", Tradingsymbol: "INFY", TransactionType: "BUY", Product: "CNC", Quantity: 5, TriggerPrice: 1400, Price: 1401.5},
+		},
+		{
+			name: "oco drops the single leg prices",
+			args: map[string]any{"type": "OCO", "transaction_type": "SELL", "product": "nrml", "quantity": float64(10),
+				"trigger_price": float64(1), "lower_trigger": float64(1400), "lower_price": float64(1393), "upper_trigger": float64(1700), "upper_price": float64(1700)},
+			g:    defaults,
+			want: gttRequest{Type: GTTOCO, Exchange: "NSE", Tradingsymbol: "INFY", TransactionType: "SELL", Product: "NRML", Quantity: 10, LowerTrigger: 1400, LowerPrice: 1393, UpperTrigger: 1700, UpperPrice: 1700},
+		},
+		{
+			name: "modify keeps what is not given",
+			args: map[string]any{"upper_trigger": float64(1800)},
+			g:    oco,
+			want: gttRequest{Type: GTTOCO, Exchange: "NSE", Tradingsymbol: "INFY", TransactionType: "SELL", Product: "CNC", Quantity: 10, LowerTrigger: 1400, LowerPrice: 1393, UpperTrigger: 1800, UpperPrice: 1700},
+		},
+		{
+			name: "modify to single drops the oco legs",
+			args: map[string]any{"type": "single", "trigger_price": float64(1400), "price": float64(1393)},
+			g:    oco,
+			want: gttRequest{Type: GTTSingle, Exchange: "NSE", Tradingsymbol: "INFY", TransactionType: "SELL", Product: "CNC", Quantity: 10, TriggerPrice: 1400, Price: 1393},
+		},
+		{name: "no transaction type", args: map[string]any{"quantity": float64(5)}, g: defaults, wantErr: "transaction_type is required"},
+		{name: "unknown type", args: map[string]any{"type": "bracket", "transaction_type": "BUY"}, g: defaults, wantErr: "type \"bracket\" must be one of"},
+		{name: "intraday product", args: map[string]any{"transaction_type": "BUY", "product": "MIS"}, g: defaults, wantErr: "product \"MIS\" must be one of"},
+		{name: "fractional quantity", args: map[string]any{"transaction_type": "BUY", "quantity": 2.5}, g: defaults, wantErr: "quantity must be a non-negative integer"},
+		{name: "negative price", args: map[string]any{"transaction_type": "BUY", "price": float64(-1)}, g: defaults, wantErr: "price must be a non-negative number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGTTArgs(tt.args, tt.g)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckGTT(t *testing.T) {
+	infy := testInstruments[0]
+	future := testInstruments[4]
+	single := gttRequest{Type: GTTSingle, Exchange: "NSE", Tradingsymbol: "INFY", TransactionType: "BUY", Product: "CNC", Quantity: 10, TriggerPrice: 1400, Price: 1401}
+	oco := gttRequest{Type: GTTOCO, Exchange: "NSE", Tradingsymbol: "INFY", TransactionType: "SELL", Product: "CNC", Quantity: 10,
+		LowerTrigger: 1400, LowerPrice: 1393, UpperTrigger: 1700, UpperPrice: 1700}
+	with := func(g gttRequest, change func(*gttRequest)) gttRequest {
+		change(&g)
+		return g
+	}
+
+	tests := []struct {
+		name       string
+		g          gttRequest
+		instrument kiteconnect.Instrument
+		lastPrice  float64
+		wantErr    string
+	}{
+		{name: "single", g: single, instrument: infy, lastPrice: 1500},
+		{name: "oco", g: oco, instrument: infy, lastPrice: 1500},
+		{name: "without a last price", g: oco, instrument: infy},
+		{name: "no quantity", g: with(single, func(g *gttRequest) { g.Quantity = 0 }), instrument: infy, lastPrice: 1500, wantErr: "quantity must be at least 1"},
+		{name: "whole lots", g: with(oco, func(g *gttRequest) { g.Exchange, g.Tradingsymbol, g.Quantity = "NFO", "NIFTY26OCTFUT", 150 }), instrument: future, lastPrice: 1500},
+		{name: "part of a lot", g: with(oco, func(g *gttRequest) { g.Exchange, g.Tradingsymbol, g.Quantity = "NFO", "NIFTY26OCTFUT", 100 }), instrument: future, lastPrice: 1500,
+			wantErr: "not a multiple of the lot size 75"},
+		{name: "single without a price", g: with(single, func(g *gttRequest) { g.Price = 0 }), instrument: infy, lastPrice: 1500, wantErr: "SINGLE GTTs need price"},
+		{name: "oco without an upper trigger", g: with(oco, func(g *gttRequest) { g.UpperTrigger = 0 }), instrument: infy, lastPrice: 1500, wantErr: "OCO GTTs need upper_trigger"},
+		{name: "off tick", g: with(oco, func(g *gttRequest) { g.LowerPrice = 1393.02 }), instrument: infy, lastPrice: 1500, wantErr: "lower_price 1393.02 is not a multiple of the tick size 0.05"},
+		{name: "legs swapped", g: with(oco, func(g *gttRequest) { g.LowerTrigger, g.UpperTrigger = 1700, 1400 }), instrument: infy, lastPrice: 1500, wantErr: "lower_trigger must be below upper_trigger"},
+		{name: "price below both legs", g: oco, instrument: infy, lastPrice: 1300, wantErr: "must lie between lower_trigger 1400 and upper_trigger 1700"},
+		{name: "price on the upper leg", g: oco, instrument: infy, lastPrice: 1700, wantErr: "must lie between"},
+		{name: "trigger at the last price", g: single, instrument: infy, lastPrice: 1400, wantErr: "trigger_price 1400 must differ from the last price"},
+	}
+	for _, tt := range tests {
+		err := checkGTT(tt.g, tt.instrument, tt.lastPrice)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func testGTT(id int, gttType kiteconnect.GTTType, triggers []float64, legs ...kiteconnect.Order) kiteconnect.GTT {
+	return kiteconnect.GTT{
+		ID:        id,
+		Type:      gttType,
+		Status:    gttStatusActive,
+		Condition: kiteconnect.GTTCondition{Exchange: "NSE", Tradingsymbol: "INFY", TriggerValues: triggers},
+		Orders:    legs,
+	}
+}
+
+func gttLeg(transactionType string, price float64) kiteconnect.Order {
+	return kiteconnect.Order{TransactionType: transactionType, Quantity: 10, Price: price, Product: kiteconnect.ProductCNC}
+}
+
+func TestStopLossGTT(t *testing.T) {
+	tests := []struct {
+		name   string
+		gtts   []kiteconnect.GTT
+		wantID int
+	}{
+		{name: "none"},
+		{name: "oco", gtts: []kiteconnect.GTT{testGTT(1, kiteconnect.GTTTypeOCO, []float64{1400, 1700}, gttLeg("SELL", 1393), gttLeg("SELL", 1700))}, wantID: 1},
+		{name: "single stop-loss", gtts: []kiteconnect.GTT{testGTT(2, kiteconnect.GTTTypeSingle, []float64{1400}, gttLeg("SELL", 1393))}, wantID: 2},
+		{name: "target only", gtts: []kiteconnect.GTT{testGTT(3, kiteconnect.GTTTypeSingle, []float64{1700}, gttLeg("SELL", 1700))}},
+		{name: "buy below the price", gtts: []kiteconnect.GTT{testGTT(4, kiteconnect.GTTTypeSingle, []float64{1400}, gttLeg("BUY", 1401))}},
+		{name: "trigger taken from the limit price", gtts: []kiteconnect.GTT{testGTT(5, kiteconnect.GTTTypeSingle, nil, gttLeg("SELL", 1393))}, wantID: 5},
+		{
+			name: "first protecting GTT",
+			gtts: []kiteconnect.GTT{
+				testGTT(6, kiteconnect.GTTTypeSingle, []float64{1700}, gttLeg("SELL", 1700)),
+				testGTT(7, kiteconnect.GTTTypeSingle, []float64{1400}, gttLeg("SELL", 1393)),
+				testGTT(8, kiteconnect.GTTTypeSingle, []float64{1300}, gttLeg("SELL", 1293)),
+			},
+			wantID: 7,
+		},
+	}
+	for _, tt := range tests {
+		id, ok := stopLossGTT(tt.gtts, 1500)
+		if id != tt.wantID || ok != (tt.wantID != 0) {
+			t.Errorf("%s: got %d, %t; want %d", tt.name, id, ok, tt.wantID)
+		}
+	}
+}
+
+func TestTickRounding(t *testing.T) {
+	tests := []struct {
+		price, tick float64
+		floor, ceil float64
+	}{
+		{price: 1417.875, tick: 0.05, floor: 1417.85, ceil: 1417.9},
+		{price: 1425, tick: 0.05, floor: 1425, ceil: 1425},
+		{price: 0.3, tick: 0.1, floor: 0.3, ceil: 0.3},
+		{price: 1650.01, tick: 0.1, floor: 1650, ceil: 1650.1},
+		{price: 99.99, tick: 1, floor: 99, ceil: 100},
+		{price: 12.34, tick: 0, floor: 12.34, ceil: 12.34},
+	}
+	for _, tt := range tests {
+		if got := floorTick(tt.price, tt.tick); got != tt.floor {
+			t.Errorf("floorTick(%g, %g) = %g, want %g", tt.price, tt.tick, got, tt.floor)
+		}
+		if got := ceilTick(tt.price, tt.tick); got != tt.ceil {
+			t.Errorf("ceilTick(%g, %g) = %g, want %g", tt.price, tt.tick, got, tt.ceil)
+		}
+	}
+}
+
+// dailyCandles serves the last days of daily candles with a high and low 5 either side of a
+// close of 1000, so the true range and ATR are 10.
+func dailyCandles(days int) func(*http.Request) any {
+	return func(*http.Request) any {
+		today := time.Now().In(istLocation)
+		candles := make([][]any, 0, days)
+		for i := days; i > 0; i-- {
+			date := today.AddDate(0, 0, -i).Format("2006-01-02") + "T00:00:00+0530"
+			candles = append(candles, []any{date, 1000, 1005, 995, 1000, 1000})
+		}
+		return map[string]any{"candles": candles}
+	}
+}
+
+func TestProposeGTTs(t *testing.T) {
+	holdings := []map[string]any{
+		{"exchange": "NSE", "tradingsymbol": "INFY", "quantity": 8, "t1_quantity": 2, "average_price": 1400, "last_price": 1500},
+		{"exchange": "NSE", "tradingsymbol": "TCS", "quantity": 5, "average_price": 3500, "last_price": 4000},
+		{"exchange": "BSE", "tradingsymbol": "INFY", "quantity": 1, "average_price": 1400, "last_price": 0},
+		{"exchange": "NSE", "tradingsymbol": "NOPE", "quantity": 1, "average_price": 10, "last_price": 12},
+		{"exchange": "NSE", "tradingsymbol": "SOLD", "quantity": 0, "average_price": 10, "last_price": 12},
+	}
+	gtts := []map[string]any{{
+		"id": 42, "type": "single", "status": "active",
+		"condition": map[string]any{"exchange": "NSE", "tradingsymbol": "TCS", "trigger_values": []float64{3800}},
+		"orders":    []map[string]any{{"transaction_type": "SELL", "quantity": 5, "price": 3790, "product": "CNC"}},
+	}}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want GTTProposal
+	}{
+		{
+			name: "percent",
+			args: map[string]any{},
+			want: GTTProposal{LowerTrigger: 1425, LowerPrice: 1417.85, UpperTrigger: 1650, UpperPrice: 1650, StoplossPct: 5, TargetPct: 10,
+				PnLAtStoploss: 178.5, PnLAtTarget: 2500},
+		},
+		{
+			name: "percent with a wider stop",
+			args: map[string]any{"stoploss_pct": float64(8), "target_pct": float64(4), "limit_offset_pct": float64(0)},
+			want: GTTProposal{LowerTrigger: 1380, LowerPrice: 1380, UpperTrigger: 1560, UpperPrice: 1560, StoplossPct: 8, TargetPct: 4,
+				PnLAtStoploss: -200, PnLAtTarget: 1600},
+		},
+		{
+			name: "atr",
+			args: map[string]any{"rule": "atr"},
+			want: GTTProposal{LowerTrigger: 1480, LowerPrice: 1472.6, UpperTrigger: 1540, UpperPrice: 1540, ATR: 10,
+				StoplossPct: 1.3333, TargetPct: 2.6667, PnLAtStoploss: 726, PnLAtTarget: 1400},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := newTestServer(t, kiteRoutes{
+				kiteconnect.URIGetHoldings:                               holdings,
+				kiteconnect.URIGetGTTs:                                   gtts,
+				fmt.Sprintf(kiteconnect.URIGetHistorical, 408065, "day"): dailyCandles(30),
+			})
+			z.instruments = newTestInstrumentStore(testInstruments)
+			z.candles = NewCandleStore("")
+
+			result, err := z.ProposeGTTs()(context.Background(), toolRequest("propose_gtts", tt.args))
+			_, text := resultText(t, result, err)
+			var got gttProposals
+			if err := json.Unmarshal([]byte(text), &got); err != nil {
+				t.Fatalf("%v\n%s", err, text)
+			}
+
+			skipped := make([]string, 0, len(got.Skipped))
+			for _, skip := range got.Skipped {
+				skipped = append(skipped, skip.Instrument+": "+skip.Reason)
+			}
+			wantSkipped := []string{"NSE:TCS: has active stop-loss GTT 42", "BSE:INFY: no last price", `NSE:NOPE: unknown instrument "NSE:NOPE"`}
+			for i, want := range wantSkipped {
+				if i >= len(skipped) || !strings.HasPrefix(skipped[i], want) {
+					t.Errorf("skipped %q, want %q", skipped, wantSkipped)
+					break
+				}
+			}
+
+			if len(got.Proposals) != 1 {
+				t.Fatalf("got %d proposals, want 1: %s", len(got.Proposals), text)
+			}
+			p := got.Proposals[0]
+			if p.Instrument != "NSE:INFY" || p.Type != GTTOCO || p.TransactionType != "SELL" || p.Product != "CNC" || p.Quantity != 10 {
+				t.Errorf("proposal for %s %s %s %s %d, want an OCO SELL of the 10 NSE:INFY held", p.Instrument, p.Type, p.TransactionType, p.Product, p.Quantity)
+			}
+			for _, v := range []struct {
+				field     string
+				got, want float64
+			}{
+				{"lower_trigger", p.LowerTrigger, tt.want.LowerTrigger},
+				{"lower_price", p.LowerPrice, tt.want.LowerPrice},
+				{"upper_trigger", p.UpperTrigger, tt.want.UpperTrigger},
+				{"upper_price", p.UpperPrice, tt.want.UpperPrice},
+				{"stoploss_pct", p.StoplossPct, tt.want.StoplossPct},
+				{"target_pct", p.TargetPct, tt.want.TargetPct},
+				{"pnl_at_stoploss", p.PnLAtStoploss, tt.want.PnLAtStoploss},
+				{"pnl_at_target", p.PnLAtTarget, tt.want.PnLAtTarget},
+			} {
+				if math.Abs(v.got-v.want) > 1e-3 {
+					t.Errorf("%s = %g, want %g", v.field, v.got, v.want)
+				}
+			}
+			if tt.want.ATR != 0 && math.Abs(p.ATR-tt.want.ATR) > 1e-9 {
+				t.Errorf("atr = %g, want %g", p.ATR, tt.want.ATR)
+			}
+		})
+	}
+}
+
+func TestParseGTTRule(t *testing.T) {
+	tests := []struct {
+		args    map[string]any
+		wantErr string
+	}{
+		{args: map[string]any{}},
+		{args: map[string]any{"rule": "ATR", "atr_period": float64(20), "stoploss_atr": 1.5}},
+		{args: map[string]any{"rule": "trailing"}, wantErr: "must be one of"},
+		{args: map[string]any{"stoploss_pct": float64(100)}, wantErr: "stoploss_pct must be between 0 and 100"},
+		{args: map[string]any{"target_pct": float64(0)}, wantErr: "target_pct must be positive"},
+		{args: map[string]any{"stoploss_atr": float64(0)}, wantErr: "stoploss_atr and target_atr must be positive"},
+		{args: map[string]any{"atr_period": float64(0)}, wantErr: "atr_period must be at least 1"},
+		{args: map[string]any{"limit_offset_pct": float64(100)}, wantErr: "limit_offset_pct must be below 100"},
+	}
+	for _, tt := range tests {
+		_, err := parseGTTRule(tt.args)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("parseGTTRule(%v) = %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// historicalIntervals maps each Kite candle interval to the longest range, in days, that one
+// historical data request may cover.
+var historicalIntervals = map[string]int{
+	"minute":   60,
+	"3minute":  100,
+	"5minute":  100,
+	"10minute": 100,
+	"15minute": 200,
+	"30minute": 200,
+	"60minute": 400,
+	"day":      2000,
+}
+
+// HistoricalIntervals lists the candle intervals in increasing order, for tool schemas.
+var HistoricalIntervals = []string{"minute", "3minute", "5minute", "10minute", "15minute", "30minute", "60minute", "day"}
+
+// historicalRequestGap keeps chunked requests under Kite's rate limit of 3 historical requests a second.
+const historicalRequestGap = 350 * time.Millisecond
+
+var historicalDateLayouts = []string{time.DateOnly, time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04"}
+
+// parseHistoricalTime reads a date or date and time in IST, or an RFC 3339 time.
+func parseHistoricalTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(istLocation), nil
+	}
+	for _, layout := range historicalDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, istLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date such as 2026-10-16 or 2026-10-16 09:15:00", value)
+}
+
+// resolveInstrument accepts an exchange:tradingsymbol such as NSE:INFY or an instrument token,
+// given as a number or a string, and resolves it with the instrument master.
+func (z *ZerodhaMcpServer) resolveInstrument(kc *kiteconnect.Client, value any) (kiteconnect.Instrument, error) {
+	var token int
+	switch v := value.(type) {
+	case float64:
+		if v < 0 || v > math.MaxUint32 || v != math.Trunc(v) {
+			return kiteconnect.Instrument{}, fmt.Errorf("instrument token %v must be a whole number", v)
+		}
+		token = int(v)
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return kiteconnect.Instrument{}, errors.New("instrument is required")
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			index, err := z.instruments.Index(kc)
+			if err != nil {
+				return kiteconnect.Instrument{}, err
+			}
+			instrument, ok := index.BySymbol(v)
+			if !ok {
+				return kiteconnect.Instrument{}, fmt.Errorf("unknown instrument %q, use search_instruments to find its exchange:tradingsymbol", v)
+			}
+			return instrument, nil
+		}
+		token = int(n)
+	default:
+		return kiteconnect.Instrument{}, errors.New("instrument must be an exchange:tradingsymbol or an instrument token")
+	}
+
+	index, err := z.instruments.Index(kc)
+	if err != nil {
+		return kiteconnect.Instrument{}, err
+	}
+	if instrument, ok := index.ByToken(token); ok {
+		return instrument, nil
+	}
+	// Tokens of expired contracts are no longer in the instrument master, but Kite still has their candles
+	return kiteconnect.Instrument{InstrumentToken: token}, nil
+}
+
+func instrumentLabel(instrument kiteconnect.Instrument) string {
+	if instrument.Tradingsymbol == "" {
+		return strconv.Itoa(instrument.InstrumentToken)
+	}
+	return instrument.Exchange + ":" + instrument.Tradingsymbol
+}
+
+// candleRequest describes a range of candles of one instrument.
+type candleRequest struct {
+	Token      int
+	Interval   string
+	From       time.Time
+	To         time.Time
+	Continuous bool
+	OI         bool
+}
+
+// fetchCandles downloads the candles of a range, split into as many requests as the interval's
+// range limit needs. The chunks are merged in time order with duplicate candles removed.
+func fetchCandles(ctx context.Context, kc *kiteconnect.Client, req candleRequest) ([]kiteconnect.HistoricalData, int, error) {
+	maxDays, ok := historicalIntervals[req.Interval]
+	if !ok {
+		return nil, 0, fmt.Errorf("interval %q must be one of %s", req.Interval, strings.Join(HistoricalIntervals, ", "))
+	}
+
+	var candles []kiteconnect.HistoricalData
+	requests := 0
+	for start := req.From; !start.After(req.To); {
+		end := start.AddDate(0, 0, maxDays).Add(-time.Second)
+		if end.After(req.To) {
+			end = req.To
+		}
+
+		if requests > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, requests, ctx.Err()
+			case <-time.After(historicalRequestGap):
+			}
+		}
+		chunk, err := kc.GetHistoricalData(req.Token, req.Interval, start, end, req.Continuous, req.OI)
+		requests++
+		if err != nil {
+			return nil, requests, err
+		}
+		candles = append(candles, chunk...)
+		start = end.Add(time.Second)
+	}
+	return mergeCandles(candles), requests, nil
+}
+
+// mergeCandles sorts candles by time and drops repeated candles, keeping the last one seen.
+func mergeCandles(candles []kiteconnect.HistoricalData) []kiteconnect.HistoricalData {
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].Date.Before(candles[j].Date.Time)
+	})
+
+	merged := make([]kiteconnect.HistoricalData, 0, len(candles))
+	for _, candle := range candles {
+		if n := len(merged); n > 0 && merged[n-1].Date.Equal(candle.Date.Time) {
+			merged[n-1] = candle
+			continue
+		}
+		merged = append(merged, candle)
+	}
+	return merged
+}
+
+// parseCandleRequest reads the instrument, interval, range and flags shared by the candle tools.
+// With a lookback, from is optional and defaults to far enough back for that many candles.
+func (z *ZerodhaMcpServer) parseCandleRequest(kc *kiteconnect.Client, request mcp.CallToolRequest, lookback int) (kiteconnect.Instrument, candleRequest, error) {
+	args := request.Params.Arguments
+
+	instrument, err := z.resolveInstrument(kc, args["instrument"])
+	if err != nil {
+		return kiteconnect.Instrument{}, candleRequest{}, err
+	}
+
+	interval, _ := args["interval"].(string)
+	if interval == "" {
+		interval = "day"
+	}
+	if _, ok := historicalIntervals[interval]; !ok {
+		return kiteconnect.Instrument{}, candleRequest{}, fmt.Errorf("interval %q must be one of %s", interval, strings.Join(HistoricalIntervals, ", "))
+	}
+
+	to := time.Now().In(istLocation)
+	if toArg, _ := args["to"].(string); toArg != "" {
+		if to, err = parseHistoricalTime(toArg); err != nil {
+			return kiteconnect.Instrument{}, candleRequest{}, fmt.Errorf("to: %w", err)
+		}
+		if len(strings.TrimSpace(toArg)) == len(time.DateOnly) {
+			// A bare end date includes the candles of that whole day
+			to = to.AddDate(0, 0, 1).Add(-time.Second)
+		}
+	}
+
+	var from time.Time
+	if fromArg, _ := args["from"].(string); fromArg != "" {
+		if from, err = parseHistoricalTime(fromArg); err != nil {
+			return kiteconnect.Instrument{}, candleRequest{}, fmt.Errorf("from: %w", err)
+		}
+	} else if lookback > 0 {
+		from = lookbackStart(interval, lookback, to)
+	} else {
+		return kiteconnect.Instrument{}, candleRequest{}, errors.New("from is required")
+	}
+	if to.Before(from) {
+		return kiteconnect.Instrument{}, candleRequest{}, errors.New("to must not be before from")
+	}
+
+	continuous, _ := args["continuous"].(bool)
+	oi, _ := args["oi"].(bool)
+	return instrument, candleRequest{
+		Token:      instrument.InstrumentToken,
+		Interval:   interval,
+		From:       from,
+		To:         to,
+		Continuous: continuous,
+		OI:         oi,
+	}, nil
+}
+
+// lookbackStart returns a start time that leaves at least candles candles of interval before to,
+// allowing for weekends and holidays. An NSE session has 375 one minute candles.
+func lookbackStart(interval string, candles int, to time.Time) time.Time {
+	days := candles
+	if minutes := intervalMinutes(interval); minutes > 0 {
+		days = (candles*minutes+374)/375 + 1
+	}
+	start := to.AddDate(0, 0, -(days*7/5 + 10))
+	return time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, istLocation)
+}
+
+func (z *ZerodhaMcpServer) HistoricalData() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.Params.Arguments
+		kc := z.client(ctx)
+		instrument, req, err := z.parseCandleRequest(kc, request, 0)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		interval := req.Interval
+		resample, _ := args["resample"].(string)
+		if resample != "" {
+			if err := validateResample(req.Interval, resample); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			interval = resample
+		}
+		sample := defaultCandleSample
+		if _, ok := args["sample"]; ok {
+			if sample, err = intArg(args, "sample"); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+
+		candles, requests, err := z.candles.Candles(ctx, kc, req)
+		if err != nil {
+			return nil, err
+		}
+		if resample != "" {
+			candles = resampleCandles(candles, resample)
+		}
+
+		label := instrumentLabel(instrument)
+		if summarize, _ := args["summary"].(bool); summarize {
+			s := summarizeCandles(label, interval, candles, sample)
+			text := fmt.Sprintf("No %s candles of %s in the range.", interval, label)
+			if len(candles) > 0 {
+				text = fmt.Sprintf("%s over %s, %+.2f%%, max drawdown %.2f%%, annualized volatility %.2f%%.",
+					label, countSummary(len(candles), interval+" candle"), s.ReturnPercent, s.MaxDrawdownPercent, s.AnnualizedVolatilityPct)
+			}
+			return jsonResult(text, s)
+		}
+
+		summary := fmt.Sprintf("%s of %s from %s to %s, %s to Kite.",
+			countSummary(len(candles), interval+" candle"), label,
+			req.From.Format(time.DateTime), req.To.Format(time.DateTime), countSummary(requests, "request"))
+		return z.listResult(request, summary, candles)
+	}
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// candleAt returns a candle at an IST time such as "2026-10-16 09:15" with the OHLC spread around price.
+func candleAt(t *testing.T, at string, price float64, volume int) kiteconnect.HistoricalData {
+	t.Helper()
+	date, err := time.ParseInLocation("2006-01-02 15:04", at, istLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kiteconnect.HistoricalData{
+		Date:   models.Time{Time: date},
+		Open:   price,
+		High:   price + 1,
+		Low:    price - 1,
+		Close:  price + 0.5,
+		Volume: volume,
+	}
+}
+
+func TestResolveInstrument(t *testing.T) {
+	z := &ZerodhaMcpServer{instruments: newTestInstrumentStore(testInstruments)}
+	tests := []struct {
+		name      string
+		value     any
+		wantToken int
+		wantLabel string
+		wantErr   string
+	}{
+		{name: "token", value: float64(408065), wantToken: 408065, wantLabel: "NSE:INFY"},
+		{name: "token string", value: " 2953217 ", wantToken: 2953217, wantLabel: "NSE:TCS"},
+		{name: "symbol", value: "bse:infy", wantToken: 128053508, wantLabel: "BSE:INFY"},
+		{name: "expired contract", value: float64(12345), wantToken: 12345, wantLabel: "12345"},
+		{name: "fractional token", value: 12.7, wantErr: "must be a whole number"},
+		{name: "negative token", value: float64(-1), wantErr: "must be a whole number"},
+		{name: "token out of range", value: float64(1 << 40), wantErr: "must be a whole number"},
+		{name: "negative token string", value: "-1", wantErr: "unknown instrument"},
+		{name: "fractional token string", value: "12.7", wantErr: "unknown instrument"},
+		{name: "unknown symbol", value: "NSE:NOPE", wantErr: "unknown instrument"},
+		{name: "empty", value: " ", wantErr: "is required"},
+		{name: "missing", value: nil, wantErr: "exchange:tradingsymbol or an instrument token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instrument, err := z.resolveInstrument(nil, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %d, %v; want error %q", instrument.InstrumentToken, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || instrument.InstrumentToken != tt.wantToken || instrumentLabel(instrument) != tt.wantLabel {
+				t.Errorf("got %d %s, %v; want %d %s", instrument.InstrumentToken, instrumentLabel(instrument), err, tt.wantToken, tt.wantLabel)
+			}
+		})
+	}
+}
+
+// historicalRoute answers historical data requests with one daily candle at the start of each
+// requested range, and records the ranges.
+type historicalRoute struct {
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (h *historicalRoute) serve(r *http.Request) any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	h.ranges = append(h.ranges, from+" - "+to)
+	date := strings.Replace(from, " ", "T", 1) + "+0530"
+	return map[string]any{"candles": [][]any{{date, 100, 101, 99, 100.5, 1000}}}
+}
+
+func TestFetchCandlesChunks(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, istLocation)
+	for _, interval := range HistoricalIntervals {
+		maxDays := historicalIntervals[interval]
+		t.Run(interval, func(t *testing.T) {
+			t.Parallel()
+			tests := []struct {
+				name string
+				to   time.Time
+				want []string
+			}{
+				{
+					name: "one day",
+					to:   from.AddDate(0, 0, 1).Add(-time.Second),
+					want: []string{"2026-01-01 00:00:00 - 2026-01-01 23:59:59"},
+				},
+				{
+					name: "exactly the limit",
+					to:   from.AddDate(0, 0, maxDays).Add(-time.Second),
+					want: []string{"2026-01-01 00:00:00 - " + from.AddDate(0, 0, maxDays).Add(-time.Second).Format(time.DateTime)},
+				},
+				{
+					name: "one second over the limit",
+					to:   from.AddDate(0, 0, maxDays),
+					want: []string{
+						"2026-01-01 00:00:00 - " + from.AddDate(0, 0, maxDays).Add(-time.Second).Format(time.DateTime),
+						from.AddDate(0, 0, maxDays).Format(time.DateTime) + " - " + from.AddDate(0, 0, maxDays).Format(time.DateTime),
+					},
+				},
+			}
+			for _, tt := range tests {
+				route := &historicalRoute{}
+				kc := newKiteClient(t, kiteRoutes{fmt.Sprintf(kiteconnect.URIGetHistorical, 408065, interval): route.serve})
+
+				candles, requests, err := fetchCandles(context.Background(), kc, candleRequest{Token: 408065, Interval: interval, From: from, To: tt.to})
+				if err != nil {
+					t.Fatalf("%s: %v", tt.name, err)
+				}
+				if requests != len(tt.want) || strings.Join(route.ranges, ", ") != strings.Join(tt.want, ", ") {
+					t.Errorf("%s: %d requests for %q, want %q", tt.name, requests, route.ranges, tt.want)
+				}
+				if len(candles) != len(tt.want) {
+					t.Errorf("%s: got %d candles, want one per request", tt.name, len(candles))
+				}
+			}
+		})
+	}
+}
+
+func TestFetchCandlesErrors(t *testing.T) {
+	kc := newKiteClient(t, kiteRoutes{})
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, istLocation)
+	if _, _, err := fetchCandles(context.Background(), kc, candleRequest{Token: 408065, Interval: "2minute", From: from, To: from}); err == nil || !strings.Contains(err.Error(), "must be one of") {
+		t.Errorf("unknown interval: got %v", err)
+	}
+	if _, requests, err := fetchCandles(context.Background(), kc, candleRequest{Token: 408065, Interval: "day", From: from, To: from}); err == nil || requests != 1 {
+		t.Errorf("failing request: got %d requests, %v", requests, err)
+	}
+}
+
+func TestMergeCandles(t *testing.T) {
+	first := candleAt(t, "2026-10-16 09:15", 100, 1)
+	second := candleAt(t, "2026-10-16 09:16", 101, 1)
+	third := candleAt(t, "2026-10-16 09:17", 102, 1)
+	revised := candleAt(t, "2026-10-16 09:16", 105, 2)
+
+	tests := []struct {
+		name    string
+		candles []kiteconnect.HistoricalData
+		want    []float64
+	}{
+		{name: "empty", candles: nil, want: nil},
+		{name: "in order", candles: []kiteconnect.HistoricalData{first, second, third}, want: []float64{100, 101, 102}},
+		{name: "out of order", candles: []kiteconnect.HistoricalData{third, first, second}, want: []float64{100, 101, 102}},
+		{name: "overlapping chunks", candles: []kiteconnect.HistoricalData{first, second, second, third}, want: []float64{100, 101, 102}},
+		{name: "the last copy wins", candles: []kiteconnect.HistoricalData{first, second, third, revised}, want: []float64{100, 105, 102}},
+	}
+	for _, tt := range tests {
+		got := mergeCandles(tt.candles)
+		opens := make([]float64, 0, len(got))
+		for _, candle := range got {
+			opens = append(opens, candle.Open)
+		}
+		if fmt.Sprint(opens) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got opens %v, want %v", tt.name, opens, tt.want)
+		}
+	}
+}
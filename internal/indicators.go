@@ -0,0 +1,438 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+const (
+	defaultIndicatorPoints = 5
+	maxIndicatorPoints     = 200
+	minIndicatorCandles    = 100
+
+	// maxIndicatorPeriod bounds every parameter that counts candles, so a request cannot make
+	// get_indicators fetch years of history. maxIndicatorMultiplier bounds the band widths.
+	maxIndicatorPeriod     = 500
+	maxIndicatorMultiplier = 10
+)
+
+// indicatorDefaults holds the parameters used when an indicator is requested by name only.
+var indicatorDefaults = map[string][]float64{
+	"sma":        {20},
+	"ema":        {20},
+	"rsi":        {14},
+	"macd":       {12, 26, 9},
+	"bollinger":  {20, 2},
+	"atr":        {14},
+	"vwap":       {},
+	"supertrend": {10, 3},
+}
+
+// Indicators lists the indicator names in the order they are reported, for tool schemas.
+var Indicators = []string{"sma", "ema", "rsi", "macd", "bollinger", "atr", "vwap", "supertrend"}
+
+var indicatorAliases = map[string]string{"bb": "bollinger", "bbands": "bollinger", "st": "supertrend"}
+
+// indicatorSpec is one requested indicator, named like its columns, e.g. "ema_50" or "macd_12_26_9".
+type indicatorSpec struct {
+	name   string
+	params []float64
+}
+
+func parseIndicatorSpec(text string) (indicatorSpec, error) {
+	parts := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return r == '_' || r == ':' || r == ' '
+	})
+	if len(parts) == 0 {
+		return indicatorSpec{}, fmt.Errorf("unknown indicator %q, use one of %s", text, strings.Join(Indicators, ", "))
+	}
+	name, parts := parts[0], parts[1:]
+	if alias, ok := indicatorAliases[name]; ok {
+		name = alias
+	}
+	defaults, ok := indicatorDefaults[name]
+	if !ok {
+		return indicatorSpec{}, fmt.Errorf("unknown indicator %q, use one of %s", text, strings.Join(Indicators, ", "))
+	}
+
+	spec := indicatorSpec{name: name, params: append([]float64(nil), defaults...)}
+	if len(parts) > len(defaults) {
+		return indicatorSpec{}, fmt.Errorf("indicator %q takes at most %d parameters", text, len(defaults))
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n <= 0 {
+			return indicatorSpec{}, fmt.Errorf("indicator %q has an invalid parameter %q", text, part)
+		}
+		// Everything but the band multipliers counts candles
+		if i == 1 && (name == "bollinger" || name == "supertrend") {
+			if n > maxIndicatorMultiplier {
+				return indicatorSpec{}, fmt.Errorf("indicator %q has a multiplier above %d", text, maxIndicatorMultiplier)
+			}
+		} else {
+			if n != math.Trunc(n) {
+				return indicatorSpec{}, fmt.Errorf("indicator %q needs a whole number of candles, not %q", text, part)
+			}
+			if n > maxIndicatorPeriod {
+				return indicatorSpec{}, fmt.Errorf("indicator %q has a period above %d candles", text, maxIndicatorPeriod)
+			}
+		}
+		spec.params[i] = n
+	}
+	if name == "macd" && spec.params[0] >= spec.params[1] {
+		return indicatorSpec{}, fmt.Errorf("indicator %q needs a fast period below the slow period", text)
+	}
+	return spec, nil
+}
+
+// label names the columns of the indicator, e.g. ema_50 or macd_12_26_9.
+func (s indicatorSpec) label() string {
+	label := s.name
+	for _, p := range s.params {
+		label += "_" + strconv.FormatFloat(p, 'f', -1, 64)
+	}
+	return label
+}
+
+// warmup is roughly how many candles the indicator needs before its values settle. Smoothed
+// indicators depend on every earlier candle, so they get three times their period.
+func (s indicatorSpec) warmup() int {
+	switch s.name {
+	case "sma", "bollinger":
+		return int(s.params[0])
+	case "macd":
+		return 3*int(s.params[1]) + int(s.params[2])
+	case "vwap":
+		return 0
+	default:
+		return 3 * int(s.params[0])
+	}
+}
+
+type indicatorColumn struct {
+	key    string
+	values []float64
+}
+
+// compute returns the columns of the indicator, one value per candle, NaN until there is enough history.
+func (s indicatorSpec) compute(candles []kiteconnect.HistoricalData) []indicatorColumn {
+	closes := make([]float64, len(candles))
+	for i, candle := range candles {
+		closes[i] = candle.Close
+	}
+	label := s.label()
+
+	switch s.name {
+	case "sma":
+		return []indicatorColumn{{label, sma(closes, int(s.params[0]))}}
+	case "ema":
+		return []indicatorColumn{{label, ema(closes, int(s.params[0]))}}
+	case "rsi":
+		return []indicatorColumn{{label, rsi(closes, int(s.params[0]))}}
+	case "macd":
+		line, signal, histogram := macd(closes, int(s.params[0]), int(s.params[1]), int(s.params[2]))
+		return []indicatorColumn{{label, line}, {label + "_signal", signal}, {label + "_histogram", histogram}}
+	case "bollinger":
+		upper, middle, lower := bollinger(closes, int(s.params[0]), s.params[1])
+		return []indicatorColumn{{label + "_upper", upper}, {label + "_middle", middle}, {label + "_lower", lower}}
+	case "atr":
+		return []indicatorColumn{{label, atr(candles, int(s.params[0]))}}
+	case "vwap":
+		return []indicatorColumn{{label, vwap(candles)}}
+	case "supertrend":
+		line, direction := supertrend(candles, int(s.params[0]), s.params[1])
+		return []indicatorColumn{{label, line}, {label + "_direction", direction}}
+	}
+	return nil
+}
+
+func nanSeries(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	return values
+}
+
+func sma(values []float64, period int) []float64 {
+	out := nanSeries(len(values))
+	var sum float64
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// ema is seeded with the simple average of the first period values. Leading NaNs, such as the
+// warmup of another indicator, are skipped.
+func ema(values []float64, period int) []float64 {
+	return smooth(values, period, 2/float64(period+1))
+}
+
+// rma is Wilder's moving average, used by RSI and ATR.
+func rma(values []float64, period int) []float64 {
+	return smooth(values, period, 1/float64(period))
+}
+
+func smooth(values []float64, period int, alpha float64) []float64 {
+	out := nanSeries(len(values))
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+	if len(values)-start < period {
+		return out
+	}
+
+	var sum float64
+	for _, v := range values[start : start+period] {
+		sum += v
+	}
+	prev := sum / float64(period)
+	out[start+period-1] = prev
+	for i := start + period; i < len(values); i++ {
+		prev += alpha * (values[i] - prev)
+		out[i] = prev
+	}
+	return out
+}
+
+func rsi(closes []float64, period int) []float64 {
+	out := nanSeries(len(closes))
+	if len(closes) <= period {
+		return out
+	}
+	gains := make([]float64, len(closes))
+	losses := make([]float64, len(closes))
+	gains[0], losses[0] = math.NaN(), math.NaN()
+	for i := 1; i < len(closes); i++ {
+		change := closes[i] - closes[i-1]
+		gains[i] = math.Max(change, 0)
+		losses[i] = math.Max(-change, 0)
+	}
+	avgGain, avgLoss := rma(gains, period), rma(losses, period)
+	for i := range closes {
+		switch {
+		case math.IsNaN(avgGain[i]):
+		case avgLoss[i] == 0 && avgGain[i] == 0:
+			out[i] = 50
+		case avgLoss[i] == 0:
+			out[i] = 100
+		default:
+			out[i] = 100 - 100/(1+avgGain[i]/avgLoss[i])
+		}
+	}
+	return out
+}
+
+func macd(closes []float64, fast, slow, signalPeriod int) (line, signal, histogram []float64) {
+	fastEMA, slowEMA := ema(closes, fast), ema(closes, slow)
+	line = make([]float64, len(closes))
+	for i := range closes {
+		line[i] = fastEMA[i] - slowEMA[i]
+	}
+	signal = ema(line, signalPeriod)
+	histogram = make([]float64, len(closes))
+	for i := range closes {
+		histogram[i] = line[i] - signal[i]
+	}
+	return line, signal, histogram
+}
+
+// bollinger uses the population standard deviation, as most charting platforms do.
+func bollinger(closes []float64, period int, width float64) (upper, middle, lower []float64) {
+	middle = sma(closes, period)
+	upper, lower = nanSeries(len(closes)), nanSeries(len(closes))
+	for i := period - 1; i < len(closes); i++ {
+		var variance float64
+		for _, v := range closes[i-period+1 : i+1] {
+			variance += (v - middle[i]) * (v - middle[i])
+		}
+		band := width * math.Sqrt(variance/float64(period))
+		upper[i], lower[i] = middle[i]+band, middle[i]-band
+	}
+	return upper, middle, lower
+}
+
+func trueRange(candles []kiteconnect.HistoricalData) []float64 {
+	ranges := make([]float64, len(candles))
+	for i, candle := range candles {
+		ranges[i] = candle.High - candle.Low
+		if i > 0 {
+			prevClose := candles[i-1].Close
+			ranges[i] = math.Max(ranges[i], math.Max(math.Abs(candle.High-prevClose), math.Abs(candle.Low-prevClose)))
+		}
+	}
+	return ranges
+}
+
+func atr(candles []kiteconnect.HistoricalData, period int) []float64 {
+	return rma(trueRange(candles), period)
+}
+
+// vwap restarts every session, so it only means something for intraday candles. Instruments
+// without volume, such as indices, have no VWAP.
+func vwap(candles []kiteconnect.HistoricalData) []float64 {
+	out := nanSeries(len(candles))
+	var session time.Time
+	var priceVolume, volume float64
+	for i, candle := range candles {
+		t := candle.Date.In(istLocation)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, istLocation)
+		if !day.Equal(session) {
+			session, priceVolume, volume = day, 0, 0
+		}
+		typical := (candle.High + candle.Low + candle.Close) / 3
+		priceVolume += typical * float64(candle.Volume)
+		volume += float64(candle.Volume)
+		if volume > 0 {
+			out[i] = priceVolume / volume
+		}
+	}
+	return out
+}
+
+// supertrend returns the SuperTrend line and its direction, 1 while the trend is up and -1 while it is down.
+func supertrend(candles []kiteconnect.HistoricalData, period int, multiplier float64) (line, direction []float64) {
+	line, direction = nanSeries(len(candles)), nanSeries(len(candles))
+	ranges := atr(candles, period)
+
+	var upper, lower, trend float64
+	started := false
+	for i, candle := range candles {
+		if math.IsNaN(ranges[i]) {
+			continue
+		}
+		mid := (candle.High + candle.Low) / 2
+		basicUpper, basicLower := mid+multiplier*ranges[i], mid-multiplier*ranges[i]
+
+		if !started {
+			upper, lower, trend, started = basicUpper, basicLower, 1, true
+		} else {
+			prevClose := candles[i-1].Close
+			if basicUpper < upper || prevClose > upper {
+				upper = basicUpper
+			}
+			if basicLower > lower || prevClose < lower {
+				lower = basicLower
+			}
+			if trend == 1 && candle.Close < lower {
+				trend = -1
+			} else if trend == -1 && candle.Close > upper {
+				trend = 1
+			}
+		}
+
+		direction[i] = trend
+		if trend == 1 {
+			line[i] = lower
+		} else {
+			line[i] = upper
+		}
+	}
+	return line, direction
+}
+
+// IndicatorReport holds the latest indicator values of an instrument and their recent series.
+type IndicatorReport struct {
+	Instrument string   `json:"instrument"`
+	Interval   string   `json:"interval"`
+	Candles    int      `json:"candles"`
+	Latest     object   `json:"latest"`
+	Series     []object `json:"series"`
+}
+
+func (z *ZerodhaMcpServer) Indicators() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.Params.Arguments
+
+		names := stringListArg(args["indicators"])
+		if len(names) == 0 {
+			names = Indicators
+		}
+		specs := make([]indicatorSpec, 0, len(names))
+		lookback := minIndicatorCandles
+		for _, name := range names {
+			spec, err := parseIndicatorSpec(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			specs = append(specs, spec)
+			lookback = max(lookback, spec.warmup())
+		}
+
+		points, err := intArg(args, "points")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if points == 0 {
+			points = defaultIndicatorPoints
+		}
+		points = min(points, maxIndicatorPoints)
+
+		kc := z.client(ctx)
+		instrument, req, err := z.parseCandleRequest(kc, request, lookback+points)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		candles, _, err := z.candles.Candles(ctx, kc, req)
+		if err != nil {
+			return nil, err
+		}
+
+		var columns []indicatorColumn
+		for _, spec := range specs {
+			columns = append(columns, spec.compute(candles)...)
+		}
+
+		report := IndicatorReport{
+			Instrument: instrumentLabel(instrument),
+			Interval:   req.Interval,
+			Candles:    len(candles),
+			Series:     []object{},
+		}
+		for i := max(0, len(candles)-points); i < len(candles); i++ {
+			row := object{
+				{Key: "date", Value: formatTime(candles[i].Date.Time)},
+				{Key: "close", Value: candles[i].Close},
+			}
+			for _, column := range columns {
+				row = append(row, member{Key: column.key, Value: normalize(column.values[i])})
+			}
+			report.Series = append(report.Series, row)
+		}
+		if len(report.Series) == 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("no %s candles of %s in the range", req.Interval, report.Instrument)), nil
+		}
+		report.Latest = report.Series[len(report.Series)-1]
+
+		values := make([]string, 0, len(report.Latest))
+		missing := false
+		for _, m := range report.Latest[1:] {
+			if v, ok := m.Value.(float64); ok {
+				values = append(values, fmt.Sprintf("%s %s", m.Key, strconv.FormatFloat(v, 'f', 2, 64)))
+			} else {
+				missing = true
+			}
+		}
+		summary := fmt.Sprintf("%s on %s candles as of %v: %s.", report.Instrument, req.Interval, report.Latest[0].Value, strings.Join(values, ", "))
+		if missing {
+			summary += fmt.Sprintf(" Some indicators have no value yet; %s may not be enough history, or the instrument has no volume.", countSummary(len(candles), "candle"))
+		}
+		return jsonResult(summary, report)
+	}
+}
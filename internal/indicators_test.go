@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+var nan = math.NaN()
+
+// assertSeries compares a computed series with the expected one to 3 decimals, NaN matching NaN.
+func assertSeries(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d values, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(got[i]) || !math.IsNaN(want[i]) && math.Abs(got[i]-want[i]) > 1e-3 {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+// hlc builds candles from high, low, close triples.
+func hlc(values ...[3]float64) []kiteconnect.HistoricalData {
+	candles := make([]kiteconnect.HistoricalData, len(values))
+	for i, v := range values {
+		candles[i] = kiteconnect.HistoricalData{Open: v[2], High: v[0], Low: v[1], Close: v[2]}
+	}
+	return candles
+}
+
+func TestMovingAverages(t *testing.T) {
+	closes := []float64{2, 4, 6, 8, 12, 14}
+	tests := []struct {
+		name string
+		got  []float64
+		want []float64
+	}{
+		{"sma 3", sma(closes, 3), []float64{nan, nan, 4, 6, 8.6667, 11.3333}},
+		{"ema 3", ema(closes, 3), []float64{nan, nan, 4, 6, 9, 11.5}},
+		{"ema skips leading NaN", ema([]float64{nan, 2, 4, 6, 8}, 2), []float64{nan, nan, 3, 5, 7}},
+		{"rma 3", rma(closes, 3), []float64{nan, nan, 4, 5.3333, 7.5556, 9.7037}},
+		{"too short", ema(closes[:2], 3), []float64{nan, nan}},
+	}
+	for _, tt := range tests {
+		assertSeries(t, tt.name, tt.got, tt.want)
+	}
+}
+
+func TestRSI(t *testing.T) {
+	// The 14 period example from Wilder as published by StockCharts
+	closes := []float64{44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08, 45.89, 46.03, 45.61, 46.28,
+		46.28, 46.00, 46.03, 46.41, 46.22, 45.64}
+	want := append(nanSeries(14), 70.4641, 66.2496, 66.4809, 69.3469, 66.2947, 57.9150)
+	assertSeries(t, "rsi 14", rsi(closes, 14), want)
+
+	assertSeries(t, "rsi without losses", rsi([]float64{1, 2, 3, 4}, 2), []float64{nan, nan, 100, 100})
+	assertSeries(t, "rsi of a flat series", rsi([]float64{5, 5, 5}, 2), []float64{nan, nan, 50})
+}
+
+func TestMACD(t *testing.T) {
+	line, signal, histogram := macd([]float64{2, 4, 6, 8, 12, 14}, 2, 3, 2)
+	assertSeries(t, "line", line, []float64{nan, nan, 1, 1, 1.3333, 1.2778})
+	assertSeries(t, "signal", signal, []float64{nan, nan, nan, 1, 1.2222, 1.2593})
+	assertSeries(t, "histogram", histogram, []float64{nan, nan, nan, 0, 0.1111, 0.0185})
+}
+
+func TestBollinger(t *testing.T) {
+	upper, middle, lower := bollinger([]float64{1, 2, 3, 4, 5, 6}, 5, 2)
+	assertSeries(t, "upper", upper, []float64{nan, nan, nan, nan, 5.8284, 6.8284})
+	assertSeries(t, "middle", middle, []float64{nan, nan, nan, nan, 3, 4})
+	assertSeries(t, "lower", lower, []float64{nan, nan, nan, nan, 0.1716, 1.1716})
+}
+
+func TestATR(t *testing.T) {
+	candles := hlc([3]float64{10, 8, 9}, [3]float64{11, 9, 10}, [3]float64{12, 9, 11}, [3]float64{11, 10, 10.5}, [3]float64{13, 11, 12})
+	assertSeries(t, "true range", trueRange(candles), []float64{2, 2, 3, 1, 2.5})
+	assertSeries(t, "atr 3", atr(candles, 3), []float64{nan, nan, 2.3333, 1.8889, 2.0926})
+}
+
+func TestVWAP(t *testing.T) {
+	candles := []kiteconnect.HistoricalData{
+		candleAt(t, "2026-10-15 09:15", 0, 100),
+		candleAt(t, "2026-10-15 09:16", 0, 300),
+		candleAt(t, "2026-10-16 09:15", 0, 0),
+		candleAt(t, "2026-10-16 09:16", 0, 50),
+	}
+	// Typical prices of 10, 12, 15 and 20
+	for i, close := range []float64{10, 12, 15, 20} {
+		candles[i].High, candles[i].Low, candles[i].Close = close+1, close-1, close
+	}
+	assertSeries(t, "vwap", vwap(candles), []float64{10, 11.5, nan, 20})
+}
+
+func TestSupertrend(t *testing.T) {
+	candles := hlc(
+		[3]float64{101, 99, 100}, [3]float64{102, 100, 101}, [3]float64{103, 101, 102},
+		[3]float64{104, 102, 103}, [3]float64{105, 103, 104},
+		[3]float64{96, 88, 90}, [3]float64{91, 87, 88},
+		[3]float64{99, 92, 98}, [3]float64{104, 98, 103},
+	)
+	line, direction := supertrend(candles, 2, 1)
+	assertSeries(t, "direction", direction, []float64{nan, 1, 1, 1, 1, -1, -1, 1, 1})
+	for i := range candles {
+		if math.IsNaN(line[i]) {
+			continue
+		}
+		// The line trails below the close in an uptrend and above it in a downtrend
+		if direction[i] == 1 && line[i] > candles[i].Close || direction[i] == -1 && line[i] < candles[i].Close {
+			t.Errorf("candle %d: line %g is on the wrong side of close %g in direction %g", i, line[i], candles[i].Close, direction[i])
+		}
+	}
+}
+
+func TestParseIndicatorSpec(t *testing.T) {
+	tests := []struct {
+		text      string
+		wantLabel string
+		wantErr   string
+	}{
+		{text: "ema", wantLabel: "ema_20"},
+		{text: "EMA 50", wantLabel: "ema_50"},
+		{text: "macd:8:21:5", wantLabel: "macd_8_21_5"},
+		{text: "bb_20_2.5", wantLabel: "bollinger_20_2.5"},
+		{text: "st", wantLabel: "supertrend_10_3"},
+		{text: "vwap", wantLabel: "vwap"},
+		{text: "stoch", wantErr: "unknown indicator"},
+		{text: "", wantErr: "unknown indicator"},
+		{text: "rsi_14_2", wantErr: "at most 1 parameters"},
+		{text: "sma_0", wantErr: "invalid parameter"},
+		{text: "sma_2.5", wantErr: "whole number of candles"},
+		{text: "macd_26_12", wantErr: "fast period below the slow period"},
+		{text: "sma_500", wantLabel: "sma_500"},
+		{text: "sma_501", wantErr: "period above 500 candles"},
+		{text: "sma_100000000", wantErr: "period above 500 candles"},
+		{text: "ema_1e12", wantErr: "period above 500 candles"},
+		{text: "macd_12_26_1000", wantErr: "period above 500 candles"},
+		{text: "bollinger_1000_2", wantErr: "period above 500 candles"},
+		{text: "bollinger_20_10", wantLabel: "bollinger_20_10"},
+		{text: "bollinger_20_11", wantErr: "multiplier above 10"},
+		{text: "supertrend_10_1e9", wantErr: "multiplier above 10"},
+	}
+	for _, tt := range tests {
+		spec, err := parseIndicatorSpec(tt.text)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseIndicatorSpec(%q) = %v, want error %q", tt.text, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || spec.label() != tt.wantLabel {
+			t.Errorf("parseIndicatorSpec(%q) = %q, %v; want %q", tt.text, spec.label(), err, tt.wantLabel)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+const instrumentCacheFile = "instruments.gob"
+
+// Kite publishes the instrument dump once a day before the market opens.
+const (
+	instrumentDumpHour   = 8
+	instrumentDumpMinute = 30
+)
+
+// DefaultInstrumentCachePath returns the instrument cache location under the user config dir.
+func DefaultInstrumentCachePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, tokenStoreDir, instrumentCacheFile), nil
+}
+
+// instrumentCache is the on-disk form of the instrument store.
+type instrumentCache struct {
+	FetchedAt   time.Time
+	Instruments kiteconnect.Instruments
+	ISINs       map[string]string
+}
+
+// InstrumentStore keeps the Kite instrument master on disk and in memory. It is filled on first
+// use and refreshed on the first use after Kite publishes the next dump. The instrument master
+// is the same for every account, so one store is shared by all of them.
+type InstrumentStore struct {
+	path string
+
+	mu    sync.Mutex
+	index *InstrumentIndex
+	isins map[string]string
+	// refresh is the download in progress, which callers needing a fresh index wait for
+	refresh *instrumentRefresh
+}
+
+// instrumentRefresh is one download of the instrument master; done is closed when it ends.
+type instrumentRefresh struct {
+	done  chan struct{}
+	index *InstrumentIndex
+	err   error
+}
+
+// NewInstrumentStore returns a store that persists to path, or only keeps the instruments in
+// memory when path is empty.
+func NewInstrumentStore(path string) *InstrumentStore {
+	return &InstrumentStore{path: path, isins: map[string]string{}}
+}
+
+// InstrumentIndex is an immutable snapshot of the instrument master with lookup indexes.
+type InstrumentIndex struct {
+	FetchedAt   time.Time
+	Instruments kiteconnect.Instruments
+
+	byToken  map[int]int
+	bySymbol map[string]int
+	byISIN   map[string]string
+}
+
+func newInstrumentIndex(fetchedAt time.Time, instruments kiteconnect.Instruments, isins map[string]string) *InstrumentIndex {
+	index := &InstrumentIndex{
+		FetchedAt:   fetchedAt,
+		Instruments: instruments,
+		byToken:     make(map[int]int, len(instruments)),
+		bySymbol:    make(map[string]int, len(instruments)),
+		byISIN:      make(map[string]string, len(isins)),
+	}
+	for i, instrument := range instruments {
+		index.byToken[instrument.InstrumentToken] = i
+		index.bySymbol[instrumentKey(instrument.Exchange, instrument.Tradingsymbol)] = i
+	}
+	for isin, key := range isins {
+		index.byISIN[isin] = key
+	}
+	return index
+}
+
+func instrumentKey(exchange, tradingsymbol string) string {
+	return strings.ToUpper(exchange) + ":" + strings.ToUpper(tradingsymbol)
+}
+
+// ByToken returns the instrument with the given instrument token.
+func (x *InstrumentIndex) ByToken(token int) (kiteconnect.Instrument, bool) {
+	i, ok := x.byToken[token]
+	if !ok {
+		return kiteconnect.Instrument{}, false
+	}
+	return x.Instruments[i], true
+}
+
+// BySymbol returns the instrument for an exchange:tradingsymbol such as NSE:INFY.
+func (x *InstrumentIndex) BySymbol(symbol string) (kiteconnect.Instrument, bool) {
+	exchange, tradingsymbol, ok := strings.Cut(symbol, ":")
+	if !ok {
+		return kiteconnect.Instrument{}, false
+	}
+	i, ok := x.bySymbol[instrumentKey(exchange, tradingsymbol)]
+	if !ok {
+		return kiteconnect.Instrument{}, false
+	}
+	return x.Instruments[i], true
+}
+
+// ByISIN returns the instrument listed under an ISIN. The Kite instrument dump has no ISINs, so
+// they are learned from holdings; only ISINs seen in a holdings response can be resolved.
+func (x *InstrumentIndex) ByISIN(isin string) (kiteconnect.Instrument, bool) {
+	key, ok := x.byISIN[strings.ToUpper(isin)]
+	if !ok {
+		return kiteconnect.Instrument{}, false
+	}
+	return x.BySymbol(key)
+}
+
+// Exchange returns the instruments listed on an exchange.
+func (x *InstrumentIndex) Exchange(exchange string) kiteconnect.Instruments {
+	instruments := kiteconnect.Instruments{}
+	for _, instrument := range x.Instruments {
+		if strings.EqualFold(instrument.Exchange, exchange) {
+			instruments = append(instruments, instrument)
+		}
+	}
+	return instruments
+}
+
+// lastInstrumentDump returns when the most recent instrument dump was published, skipping weekends.
+func lastInstrumentDump(now time.Time) time.Time {
+	now = now.In(istLocation)
+	dump := time.Date(now.Year(), now.Month(), now.Day(), instrumentDumpHour, instrumentDumpMinute, 0, 0, istLocation)
+	if now.Before(dump) {
+		dump = dump.AddDate(0, 0, -1)
+	}
+	for dump.Weekday() == time.Saturday || dump.Weekday() == time.Sunday {
+		dump = dump.AddDate(0, 0, -1)
+	}
+	return dump
+}
+
+// Index returns the instrument master, loading it from disk or downloading it with kc when the
+// cached copy predates the latest dump. If the download fails, a stale copy is still returned.
+// The download runs outside the lock, and concurrent callers share it rather than starting
+// their own.
+func (s *InstrumentStore) Index(kc *kiteconnect.Client) (*InstrumentIndex, error) {
+	for {
+		s.mu.Lock()
+		if s.index == nil {
+			s.loadLocked()
+		}
+		if s.index != nil && !s.index.FetchedAt.Before(lastInstrumentDump(time.Now())) {
+			index := s.index
+			s.mu.Unlock()
+			return index, nil
+		}
+		if refresh := s.refresh; refresh != nil {
+			s.mu.Unlock()
+			<-refresh.done
+			// Another account's expired session says nothing about this one, so try again with kc
+			if isTokenError(refresh.err) {
+				continue
+			}
+			return refresh.index, refresh.err
+		}
+		refresh := &instrumentRefresh{done: make(chan struct{})}
+		s.refresh = refresh
+		s.mu.Unlock()
+
+		refresh.index, refresh.err = s.download(kc)
+		close(refresh.done)
+		return refresh.index, refresh.err
+	}
+}
+
+// download fetches the instrument master and installs it as the current index.
+func (s *InstrumentStore) download(kc *kiteconnect.Client) (*InstrumentIndex, error) {
+	instruments, err := kc.GetInstruments()
+	if err == nil && len(instruments) == 0 {
+		// The client reads any response as CSV, so an error page parses as an empty dump
+		err = errors.New("the instrument dump is empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh = nil
+	if err != nil {
+		if s.index != nil && !isTokenError(err) {
+			slog.Warn("Unable to refresh instruments, using cached copy", "fetched_at", s.index.FetchedAt, "error", err)
+			return s.index, nil
+		}
+		return nil, err
+	}
+
+	s.index = newInstrumentIndex(time.Now(), instruments, s.isins)
+	s.saveLocked()
+	slog.Info("Refreshed instrument master", "instruments", len(instruments))
+	return s.index, nil
+}
+
+// LearnISINs records the exchange:tradingsymbol of every holding's ISIN.
+func (s *InstrumentStore) LearnISINs(holdings kiteconnect.Holdings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, holding := range holdings {
+		if holding.ISIN == "" {
+			continue
+		}
+		isin := strings.ToUpper(holding.ISIN)
+		key := instrumentKey(holding.Exchange, holding.Tradingsymbol)
+		if s.isins[isin] != key {
+			s.isins[isin] = key
+			changed = true
+		}
+	}
+	if !changed || s.index == nil {
+		return
+	}
+	s.index = newInstrumentIndex(s.index.FetchedAt, s.index.Instruments, s.isins)
+	s.saveLocked()
+}
+
+func (s *InstrumentStore) loadLocked() {
+	if s.path == "" {
+		return
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Unable to read instrument cache", "path", s.path, "error", err)
+		}
+		return
+	}
+	defer f.Close()
+
+	var cache instrumentCache
+	if err := gob.NewDecoder(f).Decode(&cache); err != nil {
+		slog.Warn("Ignoring unreadable instrument cache", "path", s.path, "error", err)
+		return
+	}
+	for isin, key := range cache.ISINs {
+		if _, ok := s.isins[isin]; !ok {
+			s.isins[isin] = key
+		}
+	}
+	s.index = newInstrumentIndex(cache.FetchedAt, cache.Instruments, s.isins)
+}
+
+func (s *InstrumentStore) saveLocked() {
+	if s.path == "" {
+		return
+	}
+	if err := s.writeCache(instrumentCache{FetchedAt: s.index.FetchedAt, Instruments: s.index.Instruments, ISINs: s.isins}); err != nil {
+		slog.Warn("Unable to write instrument cache", "path", s.path, "error", err)
+	}
+}
+
+// writeCache replaces the cache file atomically, like the token store.
+func (s *InstrumentStore) writeCache(cache instrumentCache) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, instrumentCacheFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(cache); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encode instrument cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
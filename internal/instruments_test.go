@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// testInstruments is a small instrument master with equities, an index, futures and options.
+var testInstruments = kiteconnect.Instruments{
+	{InstrumentToken: 408065, Exchange: "NSE", Tradingsymbol: "INFY", Name: "INFOSYS", Segment: "NSE", InstrumentType: "EQ", TickSize: 0.05, LotSize: 1},
+	{InstrumentToken: 128053508, Exchange: "BSE", Tradingsymbol: "INFY", Name: "INFOSYS", Segment: "BSE", InstrumentType: "EQ", TickSize: 0.05, LotSize: 1},
+	{InstrumentToken: 2953217, Exchange: "NSE", Tradingsymbol: "TCS", Name: "TATA CONSULTANCY SERV LT", Segment: "NSE", InstrumentType: "EQ", TickSize: 0.1, LotSize: 1},
+	{InstrumentToken: 256265, Exchange: "NSE", Tradingsymbol: "NIFTY 50", Name: "NIFTY 50", Segment: "INDICES", InstrumentType: "EQ"},
+	{InstrumentToken: 13238786, Exchange: "NFO", Tradingsymbol: "NIFTY26OCTFUT", Name: "NIFTY", Segment: "NFO-FUT", InstrumentType: "FUT", Expiry: testExpiry("2026-10-27"), TickSize: 0.1, LotSize: 75},
+	{InstrumentToken: 13239042, Exchange: "NFO", Tradingsymbol: "NIFTY26OCT25000CE", Name: "NIFTY", Segment: "NFO-OPT", InstrumentType: "CE", StrikePrice: 25000, Expiry: testExpiry("2026-10-27"), TickSize: 0.05, LotSize: 75},
+	{InstrumentToken: 13239298, Exchange: "NFO", Tradingsymbol: "NIFTY26OCT25000PE", Name: "NIFTY", Segment: "NFO-OPT", InstrumentType: "PE", StrikePrice: 25000, Expiry: testExpiry("2026-10-27"), TickSize: 0.05, LotSize: 75},
+	{InstrumentToken: 13295106, Exchange: "NFO", Tradingsymbol: "NIFTY26NOV25000CE", Name: "NIFTY", Segment: "NFO-OPT", InstrumentType: "CE", StrikePrice: 25000, Expiry: testExpiry("2026-11-24"), TickSize: 0.05, LotSize: 75},
+}
+
+func testExpiry(date string) models.Time {
+	expiry, err := time.ParseInLocation(time.DateOnly, date, istLocation)
+	if err != nil {
+		panic(err)
+	}
+	return models.Time{Time: expiry}
+}
+
+// newTestInstrumentStore returns an in-memory store holding a fresh copy of instruments.
+func newTestInstrumentStore(instruments kiteconnect.Instruments) *InstrumentStore {
+	s := NewInstrumentStore("")
+	s.index = newInstrumentIndex(time.Now(), instruments, s.isins)
+	return s
+}
+
+func TestInstrumentIndex(t *testing.T) {
+	index := newTestInstrumentStore(testInstruments).index
+	if instrument, ok := index.ByToken(2953217); !ok || instrument.Tradingsymbol != "TCS" {
+		t.Errorf("ByToken(2953217) = %s, %t", instrument.Tradingsymbol, ok)
+	}
+	if instrument, ok := index.BySymbol("bse:infy"); !ok || instrument.InstrumentToken != 128053508 {
+		t.Errorf("BySymbol(bse:infy) = %d, %t", instrument.InstrumentToken, ok)
+	}
+	if _, ok := index.BySymbol("INFY"); ok {
+		t.Error("BySymbol found a symbol without an exchange")
+	}
+	if got := len(index.Exchange("nfo")); got != 4 {
+		t.Errorf("Exchange(nfo) has %d instruments, want 4", got)
+	}
+}
+
+func TestLastInstrumentDump(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{name: "after the dump", now: istTime(t, "2026-10-16 09:00:00"), want: "2026-10-16 08:30:00"},
+		{name: "at the dump", now: istTime(t, "2026-10-16 08:30:00"), want: "2026-10-16 08:30:00"},
+		{name: "before the dump", now: istTime(t, "2026-10-16 08:29:59"), want: "2026-10-15 08:30:00"},
+		{name: "saturday", now: istTime(t, "2026-10-17 12:00:00"), want: "2026-10-16 08:30:00"},
+		{name: "sunday", now: istTime(t, "2026-10-18 23:00:00"), want: "2026-10-16 08:30:00"},
+		{name: "monday before the dump", now: istTime(t, "2026-10-19 08:00:00"), want: "2026-10-16 08:30:00"},
+		{name: "monday after the dump", now: istTime(t, "2026-10-19 08:30:00"), want: "2026-10-19 08:30:00"},
+		{name: "time in UTC", now: time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC), want: "2026-10-16 08:30:00"},
+	}
+	for _, tt := range tests {
+		if got := lastInstrumentDump(tt.now); !got.Equal(istTime(t, tt.want)) {
+			t.Errorf("%s: got %s, want %s", tt.name, got.In(istLocation).Format(time.DateTime), tt.want)
+		}
+	}
+}
+
+const instrumentsCSV = `instrument_token,exchange_token,tradingsymbol,name,last_price,expiry,strike,tick_size,lot_size,instrument_type,segment,exchange
+408065,1594,INFY,INFOSYS,0,,0,0.05,1,EQ,NSE,NSE
+2953217,11532,TCS,TATA CONSULTANCY SERV LT,0,,0,0.1,1,EQ,NSE,NSE
+`
+
+// instrumentsRoute serves the instrument dump, or body when it is set, counting downloads. A
+// download waits for release when it is set.
+type instrumentsRoute struct {
+	downloads atomic.Int32
+	started   chan struct{}
+	release   chan struct{}
+	body      string
+}
+
+func (r *instrumentsRoute) serve(w http.ResponseWriter, _ *http.Request) {
+	if r.downloads.Add(1) == 1 && r.started != nil {
+		close(r.started)
+	}
+	if r.release != nil {
+		<-r.release
+	}
+	if r.body != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, r.body)
+		return
+	}
+	fmt.Fprint(w, instrumentsCSV)
+}
+
+func TestInstrumentStoreRefresh(t *testing.T) {
+	const kiteError = `{"status": "error", "error_type": "NetworkException", "message": "unavailable"}`
+	lastDump := lastInstrumentDump(time.Now())
+	stored := func(fetchedAt time.Time) *InstrumentStore {
+		s := NewInstrumentStore("")
+		s.index = newInstrumentIndex(fetchedAt, testInstruments, s.isins)
+		return s
+	}
+
+	tests := []struct {
+		name          string
+		store         *InstrumentStore
+		body          string
+		wantDownloads int32
+		wantCount     int
+		wantErr       bool
+	}{
+		{name: "fetched after the last dump", store: stored(lastDump), wantCount: len(testInstruments)},
+		{name: "fetched before the last dump", store: stored(lastDump.Add(-time.Second)), wantDownloads: 1, wantCount: 2},
+		{name: "nothing stored", store: NewInstrumentStore(""), wantDownloads: 1, wantCount: 2},
+		{name: "failed download keeps the stale copy", store: stored(lastDump.Add(-time.Hour)), body: kiteError, wantDownloads: 1, wantCount: len(testInstruments)},
+		{name: "failed download without a copy", store: NewInstrumentStore(""), body: kiteError, wantDownloads: 1, wantErr: true},
+		{name: "empty dump keeps the stale copy", store: stored(lastDump.Add(-time.Hour)), body: "Service Unavailable", wantDownloads: 1, wantCount: len(testInstruments)},
+		{name: "empty dump without a copy", store: NewInstrumentStore(""), body: "Service Unavailable", wantDownloads: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		route := &instrumentsRoute{body: tt.body}
+		kc := newKiteClient(t, kiteRoutes{"/instruments": http.HandlerFunc(route.serve)})
+
+		index, err := tt.store.Index(kc)
+		if got := route.downloads.Load(); got != tt.wantDownloads {
+			t.Errorf("%s: %d downloads, want %d", tt.name, got, tt.wantDownloads)
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %d instruments, want an error", tt.name, len(index.Instruments))
+			}
+			continue
+		}
+		if err != nil || len(index.Instruments) != tt.wantCount {
+			t.Errorf("%s: got %v, want %d instruments", tt.name, err, tt.wantCount)
+		}
+	}
+}
+
+func TestInstrumentStoreConcurrentIndex(t *testing.T) {
+	route := &instrumentsRoute{started: make(chan struct{}), release: make(chan struct{})}
+	kc := newKiteClient(t, kiteRoutes{"/instruments": http.HandlerFunc(route.serve)})
+	store := NewInstrumentStore("")
+
+	const callers = 8
+	indexes := make([]*InstrumentIndex, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if indexes[i], err = store.Index(kc); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// The store stays usable while the download is in flight
+	<-route.started
+	store.LearnISINs(kiteconnect.Holdings{{ISIN: "INE009A01021", Exchange: "NSE", Tradingsymbol: "INFY"}})
+	time.Sleep(50 * time.Millisecond)
+	close(route.release)
+	wg.Wait()
+
+	if got := route.downloads.Load(); got != 1 {
+		t.Errorf("%d callers made %d downloads, want 1", callers, got)
+	}
+	for i, index := range indexes {
+		if index != indexes[0] {
+			t.Errorf("caller %d got another index", i)
+		}
+	}
+	if instrument, ok := indexes[0].ByISIN("INE009A01021"); !ok || instrument.InstrumentToken != 408065 {
+		t.Errorf("an ISIN learned during the download was lost: %d, %t", instrument.InstrumentToken, ok)
+	}
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// kiteRoutes maps a Kite API path to its response. Data is wrapped in a success envelope, a
+// func(*http.Request) any answers per request, an http.HandlerFunc writes the raw response and a
+// missing or nil entry fails the call.
+type kiteRoutes map[string]any
+
+func newKiteServer(t *testing.T, routes kiteRoutes) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := routes[r.URL.Path]
+		switch route := data.(type) {
+		case http.HandlerFunc:
+			route(w, r)
+			return
+		case func(*http.Request) any:
+			data = route(r)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if data == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]any{"status": "error", "error_type": "NetworkException", "message": "unavailable"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": "success", "data": data})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func newKiteClient(t *testing.T, routes kiteRoutes) *kiteconnect.Client {
+	t.Helper()
+	kc := kiteconnect.New("test")
+	kc.SetBaseURI(newKiteServer(t, routes))
+	return kc
+}
+
+// newTestServer returns a server with one account, main, whose Kite client is served by routes.
+func newTestServer(t *testing.T, routes kiteRoutes) *ZerodhaMcpServer {
+	t.Helper()
+	account := NewAccount(AccountConfig{Name: "main"})
+	account.SetKc(newKiteClient(t, routes))
+	return &ZerodhaMcpServer{accounts: []*Account{account}, defaultAccount: account}
+}
+
+// kiteTime returns an exchange time as the Kite client reads it: without a zone, so in UTC.
+func kiteTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.DateTime, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
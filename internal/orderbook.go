@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// StatusOpen selects every order that can still be modified or cancelled, whatever its exact state.
+const StatusOpen = "open"
+
+// maxRejectedInSummary caps the rejection reasons repeated in the get_orders summary.
+const maxRejectedInSummary = 5
+
+var orderClockLayouts = []string{"15:04", "15:04:05"}
+
+// orderFilter selects orders and trades of the day by status, symbol, side and time.
+type orderFilter struct {
+	statuses        []string
+	symbols         []string
+	transactionType string
+	from, to        time.Time
+}
+
+func parseOrderFilter(args map[string]any) (orderFilter, error) {
+	var f orderFilter
+	for _, status := range stringListArg(args["status"]) {
+		f.statuses = append(f.statuses, strings.ToUpper(status))
+	}
+	for _, symbol := range stringListArg(args["symbol"]) {
+		f.symbols = append(f.symbols, strings.ToUpper(symbol))
+	}
+
+	var err error
+	if f.transactionType, err = enumArg(args, "transaction_type", "", TransactionTypes); err != nil {
+		return orderFilter{}, err
+	}
+	for name, t := range map[string]*time.Time{"from": &f.from, "to": &f.to} {
+		value, _ := args[name].(string)
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if *t, err = parseOrderTime(value); err != nil {
+			return orderFilter{}, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if !f.from.IsZero() && !f.to.IsZero() && f.to.Before(f.from) {
+		return orderFilter{}, errors.New("to must not be before from")
+	}
+	return f, nil
+}
+
+// parseOrderTime reads a time of day such as 09:30 as today in IST, or a full date and time.
+func parseOrderTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range orderClockLayouts {
+		if clock, err := time.ParseInLocation(layout, value, istLocation); err == nil {
+			now := time.Now().In(istLocation)
+			return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, istLocation), nil
+		}
+	}
+	return parseHistoricalTime(value)
+}
+
+func (f orderFilter) matchStatus(status string) bool {
+	if len(f.statuses) == 0 {
+		return true
+	}
+	for _, want := range f.statuses {
+		if want == status || want == strings.ToUpper(StatusOpen) && openOrderStatuses[status] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSymbol accepts a bare tradingsymbol or exchange:tradingsymbol.
+func (f orderFilter) matchSymbol(exchange, tradingsymbol string) bool {
+	if len(f.symbols) == 0 {
+		return true
+	}
+	for _, want := range f.symbols {
+		if want == tradingsymbol || want == exchange+":"+tradingsymbol {
+			return true
+		}
+	}
+	return false
+}
+
+func (f orderFilter) matchTime(t time.Time) bool {
+	if t.IsZero() {
+		return f.from.IsZero() && f.to.IsZero()
+	}
+	t = exchangeTime(t)
+	return !t.Before(f.from) && (f.to.IsZero() || !t.After(f.to))
+}
+
+func (f orderFilter) matchOrder(order kiteconnect.Order) bool {
+	return f.matchStatus(order.Status) &&
+		f.matchSymbol(order.Exchange, order.TradingSymbol) &&
+		(f.transactionType == "" || f.transactionType == order.TransactionType) &&
+		f.matchTime(order.OrderTimestamp.Time)
+}
+
+func (f orderFilter) matchTrade(trade kiteconnect.Trade) bool {
+	return f.matchSymbol(trade.Exchange, trade.TradingSymbol) &&
+		(f.transactionType == "" || f.transactionType == trade.TransactionType) &&
+		f.matchTime(tradeTime(trade))
+}
+
+func tradeTime(trade kiteconnect.Trade) time.Time {
+	if !trade.FillTimestamp.IsZero() {
+		return trade.FillTimestamp.Time
+	}
+	return trade.ExchangeTimestamp.Time
+}
+
+// ordersSummary counts orders by status and repeats why orders were rejected.
+func ordersSummary(orders []kiteconnect.Order, total int) string {
+	if len(orders) == 0 {
+		if total == 0 {
+			return "No orders today."
+		}
+		return fmt.Sprintf("None of the %s today match.", countSummary(total, "order"))
+	}
+
+	counts := map[string]int{}
+	var rejected []string
+	for _, order := range orders {
+		counts[order.Status]++
+		if order.Status == kiteconnect.OrderStatusRejected && len(rejected) < maxRejectedInSummary {
+			rejected = append(rejected, fmt.Sprintf("%s %s %s %g %s:%s: %s", order.OrderID, order.OrderType, order.TransactionType,
+				order.Quantity, order.Exchange, order.TradingSymbol, order.StatusMessage))
+		}
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		parts[i] = fmt.Sprintf("%d %s", counts[status], status)
+	}
+
+	summary := fmt.Sprintf("%s (%s).", countSummary(len(orders), "order"), strings.Join(parts, ", "))
+	if len(orders) < total {
+		summary = fmt.Sprintf("%s of %d today (%s).", countSummary(len(orders), "order"), total, strings.Join(parts, ", "))
+	}
+	if len(rejected) > 0 {
+		summary += " Rejected: " + strings.Join(rejected, "; ") + "."
+	}
+	return summary
+}
+
+// orderHistorySummary lists the states an order went through and how it ended.
+func orderHistorySummary(orderID string, history []kiteconnect.Order) string {
+	var states []string
+	for _, order := range history {
+		if len(states) == 0 || states[len(states)-1] != order.Status {
+			states = append(states, order.Status)
+		}
+	}
+	last := history[len(history)-1]
+	summary := fmt.Sprintf("Order %s, %s %s %g %s:%s: %s.", orderID, last.OrderType, last.TransactionType, last.Quantity,
+		last.Exchange, last.TradingSymbol, strings.Join(states, " -> "))
+	if last.StatusMessage != "" {
+		summary += fmt.Sprintf(" Last message: %s.", strings.TrimSuffix(last.StatusMessage, "."))
+	}
+	if last.FilledQuantity > 0 {
+		summary += fmt.Sprintf(" Filled %g at an average of %.2f.", last.FilledQuantity, last.AveragePrice)
+	}
+	return summary
+}
+
+// tradesSummary totals the quantity and value bought and sold.
+func tradesSummary(trades []kiteconnect.Trade) string {
+	var bought, sold float64
+	for _, trade := range trades {
+		if trade.TransactionType == kiteconnect.TransactionTypeSell {
+			sold += trade.Quantity * trade.AveragePrice
+		} else {
+			bought += trade.Quantity * trade.AveragePrice
+		}
+	}
+	return fmt.Sprintf("%s, bought %.2f, sold %.2f.", countSummary(len(trades), "trade"), bought, sold)
+}
+
+func (z *ZerodhaMcpServer) Orders() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		filter, err := parseOrderFilter(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		orders, err := z.client(ctx).GetOrders()
+		if err != nil {
+			return nil, err
+		}
+		matched := make([]kiteconnect.Order, 0, len(orders))
+		for _, order := range orders {
+			if filter.matchOrder(order) {
+				matched = append(matched, order)
+			}
+		}
+		return z.listResult(request, ordersSummary(matched, len(orders)), matched)
+	}
+}
+
+func (z *ZerodhaMcpServer) OrderHistory() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		orderID, _ := request.Params.Arguments["order_id"].(string)
+		if orderID = strings.TrimSpace(orderID); orderID == "" {
+			return mcp.NewToolResultError("order_id is required"), nil
+		}
+
+		history, err := z.client(ctx).GetOrderHistory(orderID)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) == 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("order %s has no history", orderID)), nil
+		}
+		return z.listResult(request, orderHistorySummary(orderID, history), history)
+	}
+}
+
+func (z *ZerodhaMcpServer) Trades() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		filter, err := parseOrderFilter(request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		trades, err := z.client(ctx).GetTrades()
+		if err != nil {
+			return nil, err
+		}
+		matched := make([]kiteconnect.Trade, 0, len(trades))
+		for _, trade := range trades {
+			if filter.matchTrade(trade) {
+				matched = append(matched, trade)
+			}
+		}
+		return z.listResult(request, tradesSummary(matched), matched)
+	}
+}
+
+func (z *ZerodhaMcpServer) OrderTrades() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		orderID, _ := request.Params.Arguments["order_id"].(string)
+		if orderID = strings.TrimSpace(orderID); orderID == "" {
+			return mcp.NewToolResultError("order_id is required"), nil
+		}
+
+		trades, err := z.client(ctx).GetOrderTrades(orderID)
+		if err != nil {
+			return nil, err
+		}
+		if len(trades) == 0 {
+			return z.listResult(request, fmt.Sprintf("Order %s has no trades; use get_order_history to see its state.", orderID), trades)
+		}
+		var quantity, value float64
+		for _, trade := range trades {
+			quantity += trade.Quantity
+			value += trade.Quantity * trade.AveragePrice
+		}
+		summary := fmt.Sprintf("%s filled order %s, quantity %g at an average of %.2f.", countSummary(len(trades), "trade"), orderID, quantity, value/quantity)
+		return z.listResult(request, summary, trades)
+	}
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+func TestParseOrderFilter(t *testing.T) {
+	now := time.Now().In(istLocation)
+	today := func(hour, min, sec int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day(), hour, min, sec, 0, istLocation)
+	}
+
+	f, err := parseOrderFilter(map[string]any{
+		"status":           "open, complete",
+		"symbol":           []any{"infy", "nse:tcs"},
+		"transaction_type": "sell",
+		"from":             "09:30",
+		"to":               "15:10:30",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(f.statuses, ",") != "OPEN,COMPLETE" || strings.Join(f.symbols, ",") != "INFY,NSE:TCS" || f.transactionType != "SELL" {
+		t.Errorf("got statuses %q, symbols %q and transaction type %q", f.statuses, f.symbols, f.transactionType)
+	}
+	if !f.from.Equal(today(9, 30, 0)) || !f.to.Equal(today(15, 10, 30)) {
+		t.Errorf("a time of day is today in IST: got %s to %s", f.from, f.to)
+	}
+
+	f, err = parseOrderFilter(map[string]any{"from": "2026-10-15 09:15:00"})
+	if err != nil || !f.from.Equal(istTime(t, "2026-10-15 09:15:00")) || !f.to.IsZero() {
+		t.Errorf("a full date and time: got %s to %s, %v", f.from, f.to, err)
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]any
+		wantErr string
+	}{
+		{name: "transaction type", args: map[string]any{"transaction_type": "short"}, wantErr: `transaction_type "short" must be one of BUY, SELL`},
+		{name: "time", args: map[string]any{"from": "9.30"}, wantErr: `from: "9.30" is not a date`},
+		{name: "to before from", args: map[string]any{"from": "14:00", "to": "10:00"}, wantErr: "to must not be before from"},
+	}
+	for _, tt := range tests {
+		if _, err := parseOrderFilter(tt.args); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatchStatus(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		status   string
+		want     bool
+	}{
+		{nil, kiteconnect.OrderStatusRejected, true},
+		{[]string{"OPEN"}, "OPEN", true},
+		{[]string{"OPEN"}, "TRIGGER PENDING", true},
+		{[]string{"OPEN"}, "AMO REQ RECEIVED", true},
+		{[]string{"OPEN"}, kiteconnect.OrderStatusComplete, false},
+		{[]string{"OPEN"}, kiteconnect.OrderStatusCancelled, false},
+		{[]string{"TRIGGER PENDING"}, "OPEN", false},
+		{[]string{"OPEN", "COMPLETE"}, kiteconnect.OrderStatusComplete, true},
+		{[]string{"REJECTED"}, kiteconnect.OrderStatusComplete, false},
+	}
+	for _, tt := range tests {
+		if got := (orderFilter{statuses: tt.statuses}).matchStatus(tt.status); got != tt.want {
+			t.Errorf("statuses %q, order %s: got %v, want %v", tt.statuses, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTime(t *testing.T) {
+	window := orderFilter{from: istTime(t, "2026-10-16 09:30:00"), to: istTime(t, "2026-10-16 10:00:00")}
+	tests := []struct {
+		name   string
+		filter orderFilter
+		at     time.Time
+		want   bool
+	}{
+		{name: "inside", filter: window, at: kiteTime(t, "2026-10-16 09:45:00"), want: true},
+		{name: "at from", filter: window, at: kiteTime(t, "2026-10-16 09:30:00"), want: true},
+		{name: "at to", filter: window, at: kiteTime(t, "2026-10-16 10:00:00"), want: true},
+		{name: "before", filter: window, at: kiteTime(t, "2026-10-16 09:29:59"), want: false},
+		{name: "after", filter: window, at: kiteTime(t, "2026-10-16 10:00:01"), want: false},
+		{name: "exchange time is IST", filter: window, at: kiteTime(t, "2026-10-16 04:15:00"), want: false},
+		{name: "zoned time", filter: window, at: istTime(t, "2026-10-16 09:45:00").UTC(), want: false},
+		{name: "from only", filter: orderFilter{from: window.from}, at: kiteTime(t, "2026-10-16 15:00:00"), want: true},
+		{name: "no timestamp without a window", filter: orderFilter{}, want: true},
+		{name: "no timestamp with a window", filter: window, want: false},
+		{name: "no timestamp with from only", filter: orderFilter{from: window.from}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.matchTime(tt.at); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrders(t *testing.T) {
+	// Kite sends order timestamps as exchange times without a zone, or null before the exchange has the order
+	order := func(id, status, symbol, side, at string) map[string]any {
+		o := map[string]any{"order_id": id, "status": status, "exchange": "NSE", "tradingsymbol": symbol, "transaction_type": side,
+			"order_type": kiteconnect.OrderTypeLimit, "quantity": 10, "order_timestamp": nil}
+		if at != "" {
+			o["order_timestamp"] = "2026-10-16 " + at
+		}
+		if status == kiteconnect.OrderStatusRejected {
+			o["status_message"] = "Insufficient funds"
+		}
+		return o
+	}
+	orders := []map[string]any{
+		order("1", "OPEN", "INFY", "BUY", "09:20:00"),
+		order("2", "TRIGGER PENDING", "TCS", "SELL", "09:40:00"),
+		order("3", kiteconnect.OrderStatusComplete, "INFY", "SELL", "10:05:00"),
+		order("4", kiteconnect.OrderStatusRejected, "INFY", "BUY", "11:00:00"),
+		order("5", "AMO REQ RECEIVED", "INFY", "BUY", ""),
+	}
+	z := newTestServer(t, kiteRoutes{kiteconnect.URIGetOrders: orders})
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{name: "all", args: map[string]any{}, want: "5 orders (1 AMO REQ RECEIVED, 1 COMPLETE, 1 OPEN, 1 REJECTED, 1 TRIGGER PENDING). Rejected: 4 LIMIT BUY 10 NSE:INFY: Insufficient funds."},
+		{name: "open", args: map[string]any{"status": "open"}, want: "3 orders of 5 today (1 AMO REQ RECEIVED, 1 OPEN, 1 TRIGGER PENDING)."},
+		{name: "symbol and side", args: map[string]any{"symbol": "NSE:INFY", "transaction_type": "buy"}, want: "3 orders of 5 today (1 AMO REQ RECEIVED, 1 OPEN, 1 REJECTED). Rejected: 4 LIMIT BUY 10 NSE:INFY: Insufficient funds."},
+		{name: "window", args: map[string]any{"from": "2026-10-16 09:30:00", "to": "2026-10-16 10:30:00"}, want: "2 orders of 5 today (1 COMPLETE, 1 TRIGGER PENDING)."},
+		{name: "nothing", args: map[string]any{"symbol": "WIPRO"}, want: "None of the 5 orders today match."},
+	}
+	for _, tt := range tests {
+		result, err := z.Orders()(context.Background(), callRequest(tt.args))
+		summary, _ := resultText(t, result, err)
+		if summary != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, summary, tt.want)
+		}
+	}
+}
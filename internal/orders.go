@@ -0,0 +1,698 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// OrderVarieties are the order varieties the order tools accept.
+var OrderVarieties = []string{kiteconnect.VarietyRegular, kiteconnect.VarietyAMO, kiteconnect.VarietyCO, kiteconnect.VarietyIceberg}
+
+var (
+	TransactionTypes = []string{kiteconnect.TransactionTypeBuy, kiteconnect.TransactionTypeSell}
+	OrderProducts    = []string{kiteconnect.ProductCNC, kiteconnect.ProductMIS, kiteconnect.ProductNRML, kiteconnect.ProductMTF}
+	OrderTypes       = []string{kiteconnect.OrderTypeMarket, kiteconnect.OrderTypeLimit, kiteconnect.OrderTypeSL, kiteconnect.OrderTypeSLM}
+	OrderValidities  = []string{kiteconnect.ValidityDay, kiteconnect.ValidityIOC, kiteconnect.ValidityTTL}
+)
+
+// Kite splits an iceberg order into 2 to 50 legs.
+const (
+	minIcebergLegs = 2
+	maxIcebergLegs = 50
+)
+
+// openOrderStatuses are the states in which an order can still be modified or cancelled.
+var openOrderStatuses = map[string]bool{
+	"OPEN":                      true,
+	"TRIGGER PENDING":           true,
+	"AMO REQ RECEIVED":          true,
+	"OPEN PENDING":              true,
+	"VALIDATION PENDING":        true,
+	"PUT ORDER REQ RECEIVED":    true,
+	"MODIFY PENDING":            true,
+	"MODIFY VALIDATION PENDING": true,
+}
+
+// orderRequest is a new order as given to place_order.
+type orderRequest struct {
+	Variety           string  `json:"variety"`
+	Exchange          string  `json:"exchange"`
+	Tradingsymbol     string  `json:"tradingsymbol"`
+	TransactionType   string  `json:"transaction_type"`
+	Quantity          int     `json:"quantity"`
+	Product           string  `json:"product"`
+	OrderType         string  `json:"order_type"`
+	Price             float64 `json:"price"`
+	TriggerPrice      float64 `json:"trigger_price"`
+	Validity          string  `json:"validity"`
+	ValidityTTL       int     `json:"validity_ttl"`
+	DisclosedQuantity int     `json:"disclosed_quantity"`
+	IcebergLegs       int     `json:"iceberg_legs"`
+	IcebergQuantity   int     `json:"iceberg_quantity"`
+	Tag               string  `json:"tag"`
+}
+
+func (o orderRequest) instrument() string {
+	return o.Exchange + ":" + o.Tradingsymbol
+}
+
+func (o orderRequest) params() kiteconnect.OrderParams {
+	return kiteconnect.OrderParams{
+		Exchange:          o.Exchange,
+		Tradingsymbol:     o.Tradingsymbol,
+		Validity:          o.Validity,
+		ValidityTTL:       o.ValidityTTL,
+		Product:           o.Product,
+		OrderType:         o.OrderType,
+		TransactionType:   o.TransactionType,
+		Quantity:          o.Quantity,
+		DisclosedQuantity: o.DisclosedQuantity,
+		Price:             o.Price,
+		TriggerPrice:      o.TriggerPrice,
+		IcebergLegs:       o.IcebergLegs,
+		IcebergQty:        o.IcebergQuantity,
+		Tag:               o.Tag,
+	}
+}
+
+func (o orderRequest) marginParam() kiteconnect.OrderMarginParam {
+	return kiteconnect.OrderMarginParam{
+		Exchange:        o.Exchange,
+		Tradingsymbol:   o.Tradingsymbol,
+		TransactionType: o.TransactionType,
+		Variety:         o.Variety,
+		Product:         o.Product,
+		OrderType:       o.OrderType,
+		Quantity:        float64(o.Quantity),
+		Price:           o.Price,
+		TriggerPrice:    o.TriggerPrice,
+	}
+}
+
+// describe returns a one line description such as "BUY 10 NSE:INFY CNC LIMIT at 1500".
+func (o orderRequest) describe() string {
+	text := fmt.Sprintf("%s %d %s %s %s", o.TransactionType, o.Quantity, o.instrument(), o.Product, o.OrderType)
+	if o.Variety != kiteconnect.VarietyRegular {
+		text = strings.ToUpper(o.Variety) + " " + text
+	}
+	if o.Price > 0 {
+		text += fmt.Sprintf(" at %g", o.Price)
+	}
+	if o.TriggerPrice > 0 {
+		text += fmt.Sprintf(" trigger %g", o.TriggerPrice)
+	}
+	return text
+}
+
+// enumArg reads an optional string argument that must be one of values, ignoring case.
+func enumArg(args map[string]any, name, fallback string, values []string) (string, error) {
+	v, _ := args[name].(string)
+	if v = strings.TrimSpace(v); v == "" {
+		return fallback, nil
+	}
+	for _, value := range values {
+		if strings.EqualFold(v, value) {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%s %q must be one of %s", name, v, strings.Join(values, ", "))
+}
+
+// parseOrderRequest reads and checks the arguments of place_order against the instrument's lot
+// and tick size, so that mistakes are caught in the preview rather than by the exchange.
+func (z *ZerodhaMcpServer) parseOrderRequest(kc *kiteconnect.Client, args map[string]any) (orderRequest, kiteconnect.Instrument, error) {
+	var o orderRequest
+	var err error
+
+	symbol, _ := args["instrument"].(string)
+	if strings.TrimSpace(symbol) == "" {
+		return o, kiteconnect.Instrument{}, errors.New("instrument is required")
+	}
+	instrument, err := z.resolveInstrument(kc, symbol)
+	if err != nil {
+		return o, kiteconnect.Instrument{}, err
+	}
+	if instrument.Tradingsymbol == "" {
+		return o, instrument, fmt.Errorf("instrument %q is not in the instrument master, orders need an exchange:tradingsymbol", symbol)
+	}
+	o.Exchange, o.Tradingsymbol = instrument.Exchange, instrument.Tradingsymbol
+
+	if o.Variety, err = enumArg(args, "variety", kiteconnect.VarietyRegular, OrderVarieties); err != nil {
+		return o, instrument, err
+	}
+	if o.TransactionType, err = enumArg(args, "transaction_type", "", TransactionTypes); err != nil {
+		return o, instrument, err
+	}
+	if o.TransactionType == "" {
+		return o, instrument, errors.New("transaction_type is required")
+	}
+	if o.Product, err = enumArg(args, "product", "", OrderProducts); err != nil {
+		return o, instrument, err
+	}
+	if o.Product == "" {
+		return o, instrument, errors.New("product is required")
+	}
+	if o.OrderType, err = enumArg(args, "order_type", kiteconnect.OrderTypeMarket, OrderTypes); err != nil {
+		return o, instrument, err
+	}
+	if o.Validity, err = enumArg(args, "validity", kiteconnect.ValidityDay, OrderValidities); err != nil {
+		return o, instrument, err
+	}
+
+	for name, target := range map[string]*int{
+		"quantity":           &o.Quantity,
+		"validity_ttl":       &o.ValidityTTL,
+		"disclosed_quantity": &o.DisclosedQuantity,
+		"iceberg_legs":       &o.IcebergLegs,
+		"iceberg_quantity":   &o.IcebergQuantity,
+	} {
+		if *target, err = intArg(args, name); err != nil {
+			return o, instrument, err
+		}
+	}
+	if o.Price, err = floatArg(args, "price"); err != nil {
+		return o, instrument, err
+	}
+	if o.TriggerPrice, err = floatArg(args, "trigger_price"); err != nil {
+		return o, instrument, err
+	}
+	o.Tag, _ = args["tag"].(string)
+
+	if err := checkOrder(o, instrument); err != nil {
+		return o, instrument, err
+	}
+	return o, instrument, nil
+}
+
+// checkOrder applies the rules Kite would reject an order for.
+func checkOrder(o orderRequest, instrument kiteconnect.Instrument) error {
+	if o.Quantity <= 0 {
+		return errors.New("quantity must be at least 1")
+	}
+	if lot := int(instrument.LotSize); lot > 1 && o.Quantity%lot != 0 {
+		return fmt.Errorf("quantity %d is not a multiple of the lot size %d of %s", o.Quantity, lot, o.instrument())
+	}
+
+	switch o.OrderType {
+	case kiteconnect.OrderTypeMarket:
+		if o.Price > 0 {
+			return errors.New("a MARKET order takes no price, use a LIMIT order to set one")
+		}
+	case kiteconnect.OrderTypeLimit:
+		if o.Price <= 0 {
+			return errors.New("a LIMIT order needs a price")
+		}
+	case kiteconnect.OrderTypeSL:
+		if o.Price <= 0 || o.TriggerPrice <= 0 {
+			return errors.New("an SL order needs a price and a trigger_price")
+		}
+	case kiteconnect.OrderTypeSLM:
+		if o.TriggerPrice <= 0 {
+			return errors.New("an SL-M order needs a trigger_price")
+		}
+	}
+	if o.OrderType != kiteconnect.OrderTypeSL && o.OrderType != kiteconnect.OrderTypeSLM && o.TriggerPrice > 0 && o.Variety != kiteconnect.VarietyCO {
+		return fmt.Errorf("trigger_price only applies to SL and SL-M orders and cover orders, not %s", o.OrderType)
+	}
+	for name, price := range map[string]float64{"price": o.Price, "trigger_price": o.TriggerPrice} {
+		if price > 0 && !onTick(price, instrument.TickSize) {
+			return fmt.Errorf("%s %g is not a multiple of the tick size %g of %s", name, price, instrument.TickSize, o.instrument())
+		}
+	}
+
+	if o.Validity == kiteconnect.ValidityTTL && o.ValidityTTL <= 0 {
+		return errors.New("TTL validity needs validity_ttl in minutes")
+	}
+	if o.DisclosedQuantity > o.Quantity {
+		return errors.New("disclosed_quantity cannot exceed quantity")
+	}
+
+	switch o.Variety {
+	case kiteconnect.VarietyCO:
+		if o.TriggerPrice <= 0 {
+			return errors.New("a cover order needs a stop loss trigger_price")
+		}
+		if o.OrderType != kiteconnect.OrderTypeMarket && o.OrderType != kiteconnect.OrderTypeLimit {
+			return errors.New("a cover order must be a MARKET or LIMIT order")
+		}
+	case kiteconnect.VarietyIceberg:
+		if o.IcebergLegs < minIcebergLegs || o.IcebergLegs > maxIcebergLegs {
+			return fmt.Errorf("an iceberg order needs iceberg_legs between %d and %d", minIcebergLegs, maxIcebergLegs)
+		}
+		if o.IcebergQuantity <= 0 || o.IcebergQuantity*o.IcebergLegs < o.Quantity {
+			return errors.New("an iceberg order needs an iceberg_quantity that covers quantity over its legs")
+		}
+	default:
+		if o.IcebergLegs > 0 || o.IcebergQuantity > 0 {
+			return errors.New("iceberg_legs and iceberg_quantity need the iceberg variety")
+		}
+	}
+	return nil
+}
+
+func onTick(price, tick float64) bool {
+	if tick <= 0 {
+		return true
+	}
+	steps := price / tick
+	return math.Abs(steps-math.Round(steps)) < 1e-6
+}
+
+// OrderPreview is what an order would do, returned before anything is sent to the exchange.
+type OrderPreview struct {
+	Action                    string                    `json:"action"`
+	Account                   string                    `json:"account"`
+	OrderID                   string                    `json:"order_id"`
+	Order                     orderRequest              `json:"order"`
+	Changes                   []orderChange             `json:"changes"`
+	Name                      string                    `json:"name"`
+	InstrumentToken           int                       `json:"instrument_token"`
+	LotSize                   float64                   `json:"lot_size"`
+	TickSize                  float64                   `json:"tick_size"`
+	LastPrice                 float64                   `json:"last_price"`
+	EstimatedPrice            float64                   `json:"estimated_price"`
+	EstimatedValue            float64                   `json:"estimated_value"`
+	Margin                    *kiteconnect.OrderMargins `json:"margin"`
+	PositionQuantity          int                       `json:"position_quantity"`
+	ResultingPositionQuantity int                       `json:"resulting_position_quantity"`
+	HoldingQuantity           int                       `json:"holding_quantity"`
+	Warnings                  []string                  `json:"warnings"`
+	ConfirmationToken         string                    `json:"confirmation_token"`
+	ExpiresAt                 time.Time                 `json:"expires_at"`
+}
+
+type orderChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// estimatedPrice is the price an order is expected to fill at: its limit price, the last price
+// for market orders, else the higher of the trigger and the last price.
+func estimatedPrice(o orderRequest, lastPrice float64) float64 {
+	switch {
+	case o.Price > 0:
+		return o.Price
+	case o.OrderType == kiteconnect.OrderTypeMarket:
+		return lastPrice
+	default:
+		return math.Max(o.TriggerPrice, lastPrice)
+	}
+}
+
+// previewOrder fills in the price, value, margin and charges and position effect of an order.
+// Lookups that fail become warnings, the preview is still useful without them.
+func previewOrder(kc *kiteconnect.Client, action string, o orderRequest, instrument kiteconnect.Instrument) OrderPreview {
+	preview := OrderPreview{
+		Action:          action,
+		Order:           o,
+		Name:            instrument.Name,
+		InstrumentToken: instrument.InstrumentToken,
+		LotSize:         instrument.LotSize,
+		TickSize:        instrument.TickSize,
+		Warnings:        []string{},
+	}
+
+	if ltp, err := kc.GetLTP(o.instrument()); err != nil {
+		preview.Warnings = append(preview.Warnings, "last price unavailable: "+err.Error())
+	} else {
+		preview.LastPrice = ltp[o.instrument()].LastPrice
+	}
+	preview.EstimatedPrice = estimatedPrice(o, preview.LastPrice)
+	preview.EstimatedValue = preview.EstimatedPrice * float64(o.Quantity)
+
+	if margins, err := kc.GetOrderMargins(kiteconnect.GetMarginParams{OrderParams: []kiteconnect.OrderMarginParam{o.marginParam()}}); err != nil {
+		preview.Warnings = append(preview.Warnings, "margin and charges unavailable: "+err.Error())
+	} else if len(margins) > 0 {
+		preview.Margin = &margins[0]
+	}
+
+	if positions, err := kc.GetPositions(); err != nil {
+		preview.Warnings = append(preview.Warnings, "positions unavailable: "+err.Error())
+	} else {
+		for _, position := range positions.Net {
+			if position.Exchange == o.Exchange && position.Tradingsymbol == o.Tradingsymbol && position.Product == o.Product {
+				preview.PositionQuantity += position.Quantity
+			}
+		}
+	}
+	preview.ResultingPositionQuantity = preview.PositionQuantity + o.Quantity
+	if o.TransactionType == kiteconnect.TransactionTypeSell {
+		preview.ResultingPositionQuantity = preview.PositionQuantity - o.Quantity
+	}
+
+	if o.Product == kiteconnect.ProductCNC {
+		if holdings, err := kc.GetHoldings(); err != nil {
+			preview.Warnings = append(preview.Warnings, "holdings unavailable: "+err.Error())
+		} else {
+			for _, holding := range holdings {
+				if holding.Exchange == o.Exchange && holding.Tradingsymbol == o.Tradingsymbol {
+					preview.HoldingQuantity += holding.Quantity + holding.T1Quantity
+				}
+			}
+		}
+		if o.TransactionType == kiteconnect.TransactionTypeSell && o.Quantity > preview.HoldingQuantity+max(preview.PositionQuantity, 0) {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("selling %d with CNC but only %d are held", o.Quantity, preview.HoldingQuantity+max(preview.PositionQuantity, 0)))
+		}
+	}
+	if preview.LastPrice > 0 && o.Price > 0 && math.Abs(o.Price/preview.LastPrice-1) > 0.05 {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("price %g is more than 5%% away from the last price %g", o.Price, preview.LastPrice))
+	}
+	return preview
+}
+
+// issueConfirmation issues a token for the previewed call and returns the account it is bound
+// to, the token and when it expires, in IST.
+func (z *ZerodhaMcpServer) issueConfirmation(ctx context.Context, request mcp.CallToolRequest) (string, string, time.Time, error) {
+	account := z.accountFor(ctx)
+	token, expires, err := z.confirmations.Issue(account.Name, request)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return account.Name, token, expires.In(istLocation), nil
+}
+
+// confirmationPrompt ends the summary of a preview with how to confirm it.
+func confirmationPrompt(request mcp.CallToolRequest, token string, expires time.Time) string {
+	return fmt.Sprintf(" Show this to the user. Only if they approve, call %s again with exactly the same arguments plus confirmation_token %q before %s.",
+		request.Params.Name, token, expires.Format(time.TimeOnly))
+}
+
+// previewResult issues a confirmation token for the previewed call and returns the preview.
+func (z *ZerodhaMcpServer) previewResult(ctx context.Context, request mcp.CallToolRequest, preview OrderPreview, description string) (*mcp.CallToolResult, error) {
+	var err error
+	preview.Account, preview.ConfirmationToken, preview.ExpiresAt, err = z.issueConfirmation(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("Preview only, nothing was sent: %s.", description)
+	if preview.EstimatedValue > 0 {
+		summary += fmt.Sprintf(" Value about %.2f.", preview.EstimatedValue)
+	}
+	if preview.Margin != nil {
+		summary += fmt.Sprintf(" Margin %.2f, charges %.2f.", preview.Margin.Total, preview.Margin.Charges.Total)
+	}
+	if len(preview.Warnings) > 0 {
+		summary += " Warnings: " + strings.Join(preview.Warnings, "; ") + "."
+	}
+	summary += confirmationPrompt(request, preview.ConfirmationToken, preview.ExpiresAt)
+	return jsonResult(summary, preview)
+}
+
+// ErrReadOnly refuses tools that change orders on a read-only server.
+var ErrReadOnly = errors.New("the server runs in read-only mode, orders and GTTs cannot be changed")
+
+// refuseReadOnly returns an error result when the server is read-only. Mutation tools are not
+// registered then, so this only guards against them being reached some other way.
+func (z *ZerodhaMcpServer) refuseReadOnly() *mcp.CallToolResult {
+	if z.readOnly {
+		return mcp.NewToolResultError(ErrReadOnly.Error())
+	}
+	return nil
+}
+
+// consumeConfirmation checks the confirmation token of a call, returning an error result when it is not valid.
+func (z *ZerodhaMcpServer) consumeConfirmation(ctx context.Context, request mcp.CallToolRequest) *mcp.CallToolResult {
+	if err := z.confirmations.Consume(z.accountFor(ctx).Name, request); err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	return nil
+}
+
+type orderResult struct {
+	Action  string `json:"action"`
+	Account string `json:"account"`
+	OrderID string `json:"order_id"`
+	Variety string `json:"variety"`
+}
+
+func (z *ZerodhaMcpServer) PlaceOrder() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if result := z.refuseReadOnly(); result != nil {
+			return result, nil
+		}
+		kc := z.client(ctx)
+		o, instrument, err := z.parseOrderRequest(kc, request.Params.Arguments)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if !confirming(request) {
+			if err := z.risk.Check(kc, "place", o, 0, false); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return z.previewResult(ctx, request, previewOrder(kc, "place", o, instrument), o.describe())
+		}
+		if result := z.consumeConfirmation(ctx, request); result != nil {
+			return result, nil
+		}
+		if err := z.risk.Check(kc, "place", o, 0, true); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		response, err := kc.PlaceOrder(o.Variety, o.params())
+		if err != nil {
+			return nil, err
+		}
+		account := z.accountFor(ctx).Name
+		slog.Info("Order placed", "account", account, "order_id", response.OrderID, "order", o.describe())
+		return jsonResult(fmt.Sprintf("Placed %s, order ID %s. Use get_order_history to follow it.", o.describe(), response.OrderID),
+			orderResult{Action: "place", Account: account, OrderID: response.OrderID, Variety: o.Variety})
+	}
+}
+
+// currentOrder returns the latest state of an order from its history.
+func currentOrder(kc *kiteconnect.Client, orderID string) (kiteconnect.Order, error) {
+	if strings.TrimSpace(orderID) == "" {
+		return kiteconnect.Order{}, errors.New("order_id is required")
+	}
+	history, err := kc.GetOrderHistory(orderID)
+	if err != nil {
+		return kiteconnect.Order{}, err
+	}
+	if len(history) == 0 {
+		return kiteconnect.Order{}, fmt.Errorf("order %s has no history", orderID)
+	}
+	return history[len(history)-1], nil
+}
+
+// orderFromKite describes an existing order in the same form as a new one.
+func orderFromKite(order kiteconnect.Order) orderRequest {
+	return orderRequest{
+		Variety:           order.Variety,
+		Exchange:          order.Exchange,
+		Tradingsymbol:     order.TradingSymbol,
+		TransactionType:   order.TransactionType,
+		Quantity:          int(order.Quantity),
+		Product:           order.Product,
+		OrderType:         order.OrderType,
+		Price:             order.Price,
+		TriggerPrice:      order.TriggerPrice,
+		Validity:          order.Validity,
+		ValidityTTL:       order.ValidityTTL,
+		DisclosedQuantity: int(order.DisclosedQuantity),
+		Tag:               order.Tag,
+	}
+}
+
+// orderInstrument looks up the instrument of an existing order for its lot and tick size.
+func (z *ZerodhaMcpServer) orderInstrument(kc *kiteconnect.Client, o orderRequest) (kiteconnect.Instrument, error) {
+	index, err := z.instruments.Index(kc)
+	if err != nil {
+		return kiteconnect.Instrument{}, err
+	}
+	instrument, ok := index.BySymbol(o.instrument())
+	if !ok {
+		return kiteconnect.Instrument{Exchange: o.Exchange, Tradingsymbol: o.Tradingsymbol}, nil
+	}
+	return instrument, nil
+}
+
+func (z *ZerodhaMcpServer) ModifyOrder() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if result := z.refuseReadOnly(); result != nil {
+			return result, nil
+		}
+		args := request.Params.Arguments
+		kc := z.client(ctx)
+
+		orderID, _ := args["order_id"].(string)
+		order, err := currentOrder(kc, orderID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if !openOrderStatuses[order.Status] {
+			return mcp.NewToolResultError(fmt.Sprintf("order %s is %s and can no longer be modified", orderID, order.Status)), nil
+		}
+
+		before := orderFromKite(order)
+		o := before
+		if o.OrderType, err = enumArg(args, "order_type", o.OrderType, OrderTypes); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if o.Validity, err = enumArg(args, "validity", o.Validity, OrderValidities); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		for name, target := range map[string]*int{"quantity": &o.Quantity, "disclosed_quantity": &o.DisclosedQuantity, "validity_ttl": &o.ValidityTTL} {
+			if _, ok := args[name]; ok {
+				if *target, err = intArg(args, name); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+			}
+		}
+		for name, target := range map[string]*float64{"price": &o.Price, "trigger_price": &o.TriggerPrice} {
+			if _, ok := args[name]; ok {
+				if *target, err = floatArg(args, name); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+			}
+		}
+		if o.OrderType == kiteconnect.OrderTypeMarket {
+			o.Price = 0
+		}
+		if o.OrderType == kiteconnect.OrderTypeMarket || o.OrderType == kiteconnect.OrderTypeLimit {
+			if o.Variety != kiteconnect.VarietyCO {
+				o.TriggerPrice = 0
+			}
+		}
+
+		changes := orderChanges(before, o)
+		if len(changes) == 0 {
+			return mcp.NewToolResultError("nothing to change, give a new quantity, price, trigger_price, order_type, validity or disclosed_quantity"), nil
+		}
+
+		instrument, err := z.orderInstrument(kc, o)
+		if err != nil {
+			return nil, err
+		}
+		if o.Variety != kiteconnect.VarietyIceberg {
+			if err := checkOrder(o, instrument); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+
+		if !confirming(request) {
+			if err := z.risk.Check(kc, "modify", o, before.Quantity, false); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			preview := previewOrder(kc, "modify", o, instrument)
+			preview.OrderID, preview.Changes = orderID, changes
+			// A modification replaces the pending order, it does not add to the position
+			preview.ResultingPositionQuantity = preview.PositionQuantity
+			return z.previewResult(ctx, request, preview, fmt.Sprintf("modify order %s to %s", orderID, o.describe()))
+		}
+		if result := z.consumeConfirmation(ctx, request); result != nil {
+			return result, nil
+		}
+		if err := z.risk.Check(kc, "modify", o, before.Quantity, true); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		response, err := kc.ModifyOrder(o.Variety, orderID, kiteconnect.OrderParams{
+			Quantity:          o.Quantity,
+			Price:             o.Price,
+			TriggerPrice:      o.TriggerPrice,
+			OrderType:         o.OrderType,
+			Validity:          o.Validity,
+			ValidityTTL:       o.ValidityTTL,
+			DisclosedQuantity: o.DisclosedQuantity,
+		})
+		if err != nil {
+			return nil, err
+		}
+		account := z.accountFor(ctx).Name
+		slog.Info("Order modified", "account", account, "order_id", response.OrderID, "order", o.describe())
+		return jsonResult(fmt.Sprintf("Modified order %s to %s.", response.OrderID, o.describe()),
+			orderResult{Action: "modify", Account: account, OrderID: response.OrderID, Variety: o.Variety})
+	}
+}
+
+func orderChanges(before, after orderRequest) []orderChange {
+	var changes []orderChange
+	add := func(field string, from, to any) {
+		if from != to {
+			changes = append(changes, orderChange{Field: field, From: from, To: to})
+		}
+	}
+	add("quantity", before.Quantity, after.Quantity)
+	add("order_type", before.OrderType, after.OrderType)
+	add("price", before.Price, after.Price)
+	add("trigger_price", before.TriggerPrice, after.TriggerPrice)
+	add("validity", before.Validity, after.Validity)
+	add("validity_ttl", before.ValidityTTL, after.ValidityTTL)
+	add("disclosed_quantity", before.DisclosedQuantity, after.DisclosedQuantity)
+	return changes
+}
+
+func (z *ZerodhaMcpServer) CancelOrder() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if result := z.refuseReadOnly(); result != nil {
+			return result, nil
+		}
+		args := request.Params.Arguments
+		kc := z.client(ctx)
+
+		orderID, _ := args["order_id"].(string)
+		order, err := currentOrder(kc, orderID)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if !openOrderStatuses[order.Status] {
+			return mcp.NewToolResultError(fmt.Sprintf("order %s is %s and can no longer be cancelled", orderID, order.Status)), nil
+		}
+		o := orderFromKite(order)
+
+		if !confirming(request) {
+			if err := z.risk.Check(kc, "cancel", o, 0, false); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			instrument, err := z.orderInstrument(kc, o)
+			if err != nil {
+				return nil, err
+			}
+			preview := OrderPreview{
+				Action:          "cancel",
+				OrderID:         orderID,
+				Order:           o,
+				Name:            instrument.Name,
+				InstrumentToken: int(order.InstrumentToken),
+				LotSize:         instrument.LotSize,
+				TickSize:        instrument.TickSize,
+				Warnings:        []string{},
+			}
+			if order.FilledQuantity > 0 {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("%g of %g are already filled, only the pending %g are cancelled", order.FilledQuantity, order.Quantity, order.PendingQuantity))
+			}
+			return z.previewResult(ctx, request, preview, fmt.Sprintf("cancel order %s, %s, status %s", orderID, o.describe(), order.Status))
+		}
+		if result := z.consumeConfirmation(ctx, request); result != nil {
+			return result, nil
+		}
+		if err := z.risk.Check(kc, "cancel", o, 0, true); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		var parentOrderID *string
+		if order.ParentOrderID != "" {
+			parentOrderID = &order.ParentOrderID
+		}
+		response, err := kc.CancelOrder(o.Variety, orderID, parentOrderID)
+		if err != nil {
+			return nil, err
+		}
+		account := z.accountFor(ctx).Name
+		slog.Info("Order cancelled", "account", account, "order_id", response.OrderID)
+		return jsonResult(fmt.Sprintf("Cancelled order %s, %s.", response.OrderID, o.describe()),
+			orderResult{Action: "cancel", Account: account, OrderID: response.OrderID, Variety: o.Variety})
+	}
+}
@@ -0,0 +1,342 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	fieldsArg = "fields"
+	filterArg = "filter"
+	sortByArg = "sort_by"
+	limitArg  = "limit"
+	offsetArg = "offset"
+)
+
+// queryOperators are matched longest first so that <= is not read as <.
+var queryOperators = []string{"!=", "<=", ">=", "!~", "=", "<", ">", "~"}
+
+// Query narrows a list result: filter rows, sort them, page through them and project fields.
+type Query struct {
+	Fields     []string
+	Filters    []Predicate
+	SortBy     string
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+// Predicate compares one field of a row with a value, e.g. segment=NFO-OPT or pnl<0.
+// Numbers compare numerically, everything else as text, so ISO dates compare by date;
+// = and != ignore case, and ~ and !~ test whether the field contains the value.
+type Predicate struct {
+	Field string
+	Op    string
+	Value string
+}
+
+func (q Query) IsZero() bool {
+	return len(q.Fields) == 0 && len(q.Filters) == 0 && q.SortBy == "" && q.Limit == 0 && q.Offset == 0
+}
+
+func parseQuery(request mcp.CallToolRequest) (Query, error) {
+	args := request.Params.Arguments
+	var query Query
+
+	query.Fields = stringListArg(args[fieldsArg])
+
+	for _, filter := range stringListArg(args[filterArg]) {
+		predicate, err := parsePredicate(filter)
+		if err != nil {
+			return Query{}, err
+		}
+		query.Filters = append(query.Filters, predicate)
+	}
+
+	if sortBy, _ := args[sortByArg].(string); sortBy != "" {
+		query.SortBy, query.Descending = strings.CutPrefix(strings.TrimSpace(sortBy), "-")
+	}
+
+	var err error
+	if query.Limit, err = intArg(args, limitArg); err != nil {
+		return Query{}, err
+	}
+	if query.Offset, err = intArg(args, offsetArg); err != nil {
+		return Query{}, err
+	}
+	return query, nil
+}
+
+// stringListArg accepts either a JSON array of strings or a single comma separated string.
+func stringListArg(v any) []string {
+	var items []string
+	switch v := v.(type) {
+	case string:
+		items = strings.Split(v, ",")
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func intArg(args map[string]any, name string) (int, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v < 0 || v != float64(int(v)) {
+			return 0, fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+}
+
+func floatArg(args map[string]any, name string) (float64, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, fmt.Errorf("%s must be a non-negative number", name)
+		}
+		return v, nil
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0, fmt.Errorf("%s must be a non-negative number", name)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%s must be a non-negative number", name)
+	}
+}
+
+func parsePredicate(filter string) (Predicate, error) {
+	for i := range filter {
+		for _, op := range queryOperators {
+			if strings.HasPrefix(filter[i:], op) {
+				predicate := Predicate{
+					Field: strings.TrimSpace(filter[:i]),
+					Op:    op,
+					Value: strings.TrimSpace(filter[i+len(op):]),
+				}
+				if predicate.Field == "" {
+					return Predicate{}, fmt.Errorf("filter %q has no field", filter)
+				}
+				return predicate, nil
+			}
+		}
+	}
+	return Predicate{}, fmt.Errorf("filter %q must look like field=value, using one of %s", filter, strings.Join(queryOperators, " "))
+}
+
+// Match reports whether a row value satisfies the predicate.
+func (p Predicate) Match(v any) bool {
+	switch p.Op {
+	case "~":
+		return strings.Contains(strings.ToLower(tableCell(v)), strings.ToLower(p.Value))
+	case "!~":
+		return !strings.Contains(strings.ToLower(tableCell(v)), strings.ToLower(p.Value))
+	}
+
+	if v == nil && p.Op != "=" && p.Op != "!=" {
+		// Missing values, e.g. the expiry of an equity, are neither before nor after anything
+		return false
+	}
+
+	var cmp int
+	if n, ok := toFloat(v); ok {
+		want, err := strconv.ParseFloat(p.Value, 64)
+		if err != nil {
+			return p.Op == "!="
+		}
+		cmp = compareFloats(n, want)
+	} else if p.Op == "=" || p.Op == "!=" {
+		if !strings.EqualFold(tableCell(v), p.Value) {
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(tableCell(v), p.Value)
+	}
+
+	switch p.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareValues orders row values for sort_by. Empty values sort last.
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		default:
+			return -1
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return compareFloats(x, y)
+		}
+	}
+	return strings.Compare(tableCell(a), tableCell(b))
+}
+
+// Apply filters, sorts, pages and projects the rows. It also returns how many rows matched
+// the filters before paging.
+func (q Query) Apply(set rowSet) (rowSet, int, error) {
+	index := make(map[string]int, len(set.columns))
+	for i, column := range set.columns {
+		index[column] = i
+	}
+	lookup := func(field string) (int, error) {
+		i, ok := index[field]
+		if !ok {
+			return 0, fmt.Errorf("unknown field %q, available fields: %s", field, strings.Join(set.columns, ", "))
+		}
+		return i, nil
+	}
+
+	filters := make([]int, len(q.Filters))
+	for i, filter := range q.Filters {
+		column, err := lookup(filter.Field)
+		if err != nil {
+			return rowSet{}, 0, err
+		}
+		filters[i] = column
+	}
+
+	rows := make([]object, 0, len(set.rows))
+	for _, row := range set.rows {
+		matches := true
+		for i, filter := range q.Filters {
+			if !filter.Match(row[filters[i]].Value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			rows = append(rows, row)
+		}
+	}
+	matched := len(rows)
+
+	if q.SortBy != "" {
+		column, err := lookup(q.SortBy)
+		if err != nil {
+			return rowSet{}, 0, err
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			cmp := compareValues(rows[i][column].Value, rows[j][column].Value)
+			if q.Descending && rows[i][column].Value != nil && rows[j][column].Value != nil {
+				cmp = -cmp
+			}
+			return cmp < 0
+		})
+	}
+
+	rows = rows[min(q.Offset, len(rows)):]
+	if q.Limit > 0 && q.Limit < len(rows) {
+		rows = rows[:q.Limit]
+	}
+
+	if len(q.Fields) == 0 {
+		return rowSet{columns: set.columns, rows: rows}, matched, nil
+	}
+
+	projection := make([]int, len(q.Fields))
+	for i, field := range q.Fields {
+		column, err := lookup(field)
+		if err != nil {
+			return rowSet{}, 0, err
+		}
+		projection[i] = column
+	}
+	projected := make([]object, len(rows))
+	for i, row := range rows {
+		projected[i] = make(object, len(projection))
+		for j, column := range projection {
+			projected[i][j] = row[column]
+		}
+	}
+	return rowSet{columns: q.Fields, rows: projected}, matched, nil
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type queryRow struct {
+	Symbol  string   `json:"tradingsymbol"`
+	Segment string   `json:"segment"`
+	PnL     float64  `json:"pnl"`
+	Strike  *float64 `json:"strike"`
+}
+
+func strike(v float64) *float64 { return &v }
+
+var queryRows = []queryRow{
+	{Symbol: "INFY", Segment: "NSE", PnL: 120},
+	{Symbol: "NIFTY24NOV24000CE", Segment: "NFO-OPT", PnL: -300.5, Strike: strike(24000)},
+	{Symbol: "TCS", Segment: "NSE", PnL: -20},
+	{Symbol: "NIFTY24NOV23000PE", Segment: "NFO-OPT", PnL: 45, Strike: strike(23000)},
+	{Symbol: "NIFTY24NOVFUT", Segment: "NFO-FUT", PnL: 0},
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]any
+		want    Query
+		wantErr string
+	}{
+		{name: "empty", args: map[string]any{}, want: Query{}},
+		{
+			name: "every option",
+			args: map[string]any{
+				fieldsArg: "tradingsymbol, pnl",
+				filterArg: []any{"segment=NFO-OPT", "pnl <= -10"},
+				sortByArg: "-pnl",
+				limitArg:  float64(5),
+				offsetArg: "2",
+			},
+			want: Query{
+				Fields:     []string{"tradingsymbol", "pnl"},
+				Filters:    []Predicate{{Field: "segment", Op: "=", Value: "NFO-OPT"}, {Field: "pnl", Op: "<=", Value: "-10"}},
+				SortBy:     "pnl",
+				Descending: true,
+				Limit:      5,
+				Offset:     2,
+			},
+		},
+		{
+			name: "longest operator first",
+			args: map[string]any{filterArg: "segment!~OPT"},
+			want: Query{Filters: []Predicate{{Field: "segment", Op: "!~", Value: "OPT"}}},
+		},
+		{name: "filter without operator", args: map[string]any{filterArg: "segment"}, wantErr: "must look like field=value"},
+		{name: "filter without field", args: map[string]any{filterArg: "=NSE"}, wantErr: "has no field"},
+		{name: "negative limit", args: map[string]any{limitArg: float64(-1)}, wantErr: "limit must be a non-negative integer"},
+		{name: "fractional offset", args: map[string]any{offsetArg: 1.5}, wantErr: "offset must be a non-negative integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseQuery(callRequest(tt.args))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Fields == nil {
+				got.Fields = []string{}
+			}
+			if tt.want.Fields == nil {
+				tt.want.Fields = []string{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredicateMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		value  any
+		want   bool
+	}{
+		{"segment=nfo-opt", "NFO-OPT", true},
+		{"segment!=NSE", "NSE", false},
+		{"pnl<0", -300.5, true},
+		{"pnl<0", 0.0, false},
+		{"pnl>=45", 45.0, true},
+		{"pnl>1e2", 120.0, true},
+		{"quantity=10", 10, true},
+		{"pnl=abc", 1.0, false},
+		{"pnl!=abc", 1.0, true},
+		{"tradingsymbol~nifty", "NIFTY24NOVFUT", true},
+		{"tradingsymbol!~nifty", "NIFTY24NOVFUT", false},
+		{"expiry<2026-11-01", "2026-10-28", true},
+		{"expiry>2026-11-01", "2026-10-28", false},
+		{"expiry<2026-11-01", nil, false},
+		{"expiry>2026-11-01", nil, false},
+		{"expiry=", nil, true},
+	}
+	for _, tt := range tests {
+		predicate, err := parsePredicate(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := predicate.Match(tt.value); got != tt.want {
+			t.Errorf("%s on %v = %v, want %v", tt.filter, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestQueryApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       Query
+		wantColumns []string
+		wantSymbols []string
+		wantMatched int
+		wantErr     string
+	}{
+		{
+			name:        "no query keeps everything",
+			wantSymbols: []string{"INFY", "NIFTY24NOV24000CE", "TCS", "NIFTY24NOV23000PE", "NIFTY24NOVFUT"},
+			wantMatched: 5,
+		},
+		{
+			name:        "filters combine",
+			query:       Query{Filters: []Predicate{{Field: "segment", Op: "~", Value: "nfo"}, {Field: "pnl", Op: ">=", Value: "0"}}},
+			wantSymbols: []string{"NIFTY24NOV23000PE", "NIFTY24NOVFUT"},
+			wantMatched: 2,
+		},
+		{
+			name:        "sort ascending",
+			query:       Query{SortBy: "pnl"},
+			wantSymbols: []string{"NIFTY24NOV24000CE", "TCS", "NIFTY24NOVFUT", "NIFTY24NOV23000PE", "INFY"},
+			wantMatched: 5,
+		},
+		{
+			name:        "sort descending",
+			query:       Query{SortBy: "pnl", Descending: true},
+			wantSymbols: []string{"INFY", "NIFTY24NOV23000PE", "NIFTY24NOVFUT", "TCS", "NIFTY24NOV24000CE"},
+			wantMatched: 5,
+		},
+		{
+			name:        "missing values sort last either way",
+			query:       Query{SortBy: "strike", Descending: true},
+			wantSymbols: []string{"NIFTY24NOV24000CE", "NIFTY24NOV23000PE", "INFY", "TCS", "NIFTY24NOVFUT"},
+			wantMatched: 5,
+		},
+		{
+			name:        "offset and limit after sorting",
+			query:       Query{SortBy: "pnl", Offset: 1, Limit: 2},
+			wantSymbols: []string{"TCS", "NIFTY24NOVFUT"},
+			wantMatched: 5,
+		},
+		{
+			name:        "offset past the end",
+			query:       Query{Offset: 10},
+			wantSymbols: []string{},
+			wantMatched: 5,
+		},
+		{
+			name:        "matched counts before paging",
+			query:       Query{Filters: []Predicate{{Field: "segment", Op: "=", Value: "NSE"}}, Limit: 1},
+			wantSymbols: []string{"INFY"},
+			wantMatched: 2,
+		},
+		{
+			name:        "fields project in the given order",
+			query:       Query{Fields: []string{"pnl", "tradingsymbol"}, Limit: 1},
+			wantColumns: []string{"pnl", "tradingsymbol"},
+			wantSymbols: []string{"INFY"},
+			wantMatched: 5,
+		},
+		{name: "unknown filter field", query: Query{Filters: []Predicate{{Field: "price", Op: "=", Value: "1"}}}, wantErr: `unknown field "price"`},
+		{name: "unknown sort field", query: Query{SortBy: "price"}, wantErr: `unknown field "price"`},
+		{name: "unknown projected field", query: Query{Fields: []string{"price"}}, wantErr: `unknown field "price"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, matched, err := tt.query.Apply(newRowSet(queryRows))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matched != tt.wantMatched {
+				t.Errorf("matched %d, want %d", matched, tt.wantMatched)
+			}
+			wantColumns := tt.wantColumns
+			if wantColumns == nil {
+				wantColumns = []string{"tradingsymbol", "segment", "pnl", "strike"}
+			}
+			if !reflect.DeepEqual(set.columns, wantColumns) {
+				t.Errorf("columns %v, want %v", set.columns, wantColumns)
+			}
+
+			symbol := slices.Index(set.columns, "tradingsymbol")
+			symbols := []string{}
+			for _, row := range set.rows {
+				symbols = append(symbols, row[symbol].Value.(string))
+			}
+			if !reflect.DeepEqual(symbols, tt.wantSymbols) {
+				t.Errorf("rows %v, want %v", symbols, tt.wantSymbols)
+			}
+		})
+	}
+}
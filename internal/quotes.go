@@ -0,0 +1,270 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// Instrument sources for the quote tools. Kite Connect has no watchlist API, so watchlists are
+// passed as a list of instruments.
+const (
+	SourceHoldings  = "holdings"
+	SourcePositions = "positions"
+)
+
+// Kite accepts up to 500 instruments in a full quote request and 1000 in an LTP or OHLC request,
+// and allows one quote request a second.
+const (
+	maxQuoteBatch   = 500
+	maxLTPBatch     = 1000
+	quoteRequestGap = time.Second
+)
+
+// requestInstruments collects the instruments of a quote request from the instrument and
+// instruments arguments and the holdings or positions source, in upper case, without duplicates and in order.
+func requestInstruments(kc *kiteconnect.Client, request mcp.CallToolRequest) ([]string, error) {
+	args := request.Params.Arguments
+	instruments := append(stringListArg(args["instrument"]), stringListArg(args["instruments"])...)
+
+	switch source, _ := args["source"].(string); source {
+	case "":
+	case SourceHoldings:
+		holdings, err := kc.GetHoldings()
+		if err != nil {
+			return nil, err
+		}
+		for _, holding := range holdings {
+			instruments = append(instruments, holding.Exchange+":"+holding.Tradingsymbol)
+		}
+	case SourcePositions:
+		positions, err := kc.GetPositions()
+		if err != nil {
+			return nil, err
+		}
+		for _, position := range positions.Net {
+			if position.Quantity != 0 {
+				instruments = append(instruments, position.Exchange+":"+position.Tradingsymbol)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("source %q must be %s or %s", source, SourceHoldings, SourcePositions)
+	}
+
+	seen := map[string]bool{}
+	unique := instruments[:0]
+	for _, instrument := range instruments {
+		// Kite keys its results by the upper case exchange:tradingsymbol
+		instrument = strings.ToUpper(instrument)
+		if !seen[instrument] {
+			seen[instrument] = true
+			unique = append(unique, instrument)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, errors.New("instrument, instruments or source is required")
+	}
+	return unique, nil
+}
+
+// inBatches calls fetch with consecutive batches of at most size instruments, pausing between
+// requests to stay within the quote rate limit. It returns the number of requests made.
+func inBatches(ctx context.Context, instruments []string, size int, fetch func([]string) error) (int, error) {
+	requests := 0
+	for start := 0; start < len(instruments); start += size {
+		if requests > 0 {
+			select {
+			case <-ctx.Done():
+				return requests, ctx.Err()
+			case <-time.After(quoteRequestGap):
+			}
+		}
+		requests++
+		if err := fetch(instruments[start:min(start+size, len(instruments))]); err != nil {
+			return requests, err
+		}
+	}
+	return requests, nil
+}
+
+// quoteSummary describes a batch result, naming the instruments Kite returned nothing for.
+func quoteSummary(noun string, rows, requests int, missing []string) string {
+	summary := fmt.Sprintf("%s for %s in %s.", noun, countSummary(rows, "instrument"), countSummary(requests, "request"))
+	if len(missing) > 0 {
+		summary += fmt.Sprintf(" No data for %s, check the exchange:tradingsymbol with search_instruments.", strings.Join(missing, ", "))
+	}
+	return summary
+}
+
+// changePercent is the change of the last price from the previous close.
+func changePercent(last, close float64) float64 {
+	if close == 0 {
+		return 0
+	}
+	return (last/close - 1) * 100
+}
+
+type quoteRow struct {
+	Instrument      string  `json:"instrument"`
+	InstrumentToken int     `json:"instrument_token"`
+	LastPrice       float64 `json:"last_price"`
+	ChangePercent   float64 `json:"change_pct"`
+	models.OHLC
+	Volume            int          `json:"volume"`
+	AveragePrice      float64      `json:"average_price"`
+	LastQuantity      int          `json:"last_quantity"`
+	LastTradeTime     models.Time  `json:"last_trade_time"`
+	BuyQuantity       int          `json:"buy_quantity"`
+	SellQuantity      int          `json:"sell_quantity"`
+	NetChange         float64      `json:"net_change"`
+	OI                float64      `json:"oi"`
+	OIDayHigh         float64      `json:"oi_day_high"`
+	OIDayLow          float64      `json:"oi_day_low"`
+	LowerCircuitLimit float64      `json:"lower_circuit_limit"`
+	UpperCircuitLimit float64      `json:"upper_circuit_limit"`
+	Timestamp         models.Time  `json:"timestamp"`
+	Depth             models.Depth `json:"depth"`
+}
+
+type ltpRow struct {
+	Instrument      string  `json:"instrument"`
+	InstrumentToken int     `json:"instrument_token"`
+	LastPrice       float64 `json:"last_price"`
+}
+
+type ohlcRow struct {
+	Instrument      string  `json:"instrument"`
+	InstrumentToken int     `json:"instrument_token"`
+	LastPrice       float64 `json:"last_price"`
+	ChangePercent   float64 `json:"change_pct"`
+	models.OHLC
+}
+
+func (z *ZerodhaMcpServer) Quote() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		kc := z.client(ctx)
+		instruments, err := requestInstruments(kc, request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		rows := []quoteRow{}
+		var missing []string
+		requests, err := inBatches(ctx, instruments, maxQuoteBatch, func(batch []string) error {
+			quotes, err := kc.GetQuote(batch...)
+			if err != nil {
+				return err
+			}
+			for _, instrument := range batch {
+				quote, ok := quotes[instrument]
+				if !ok {
+					missing = append(missing, instrument)
+					continue
+				}
+				rows = append(rows, quoteRow{
+					Instrument:        instrument,
+					InstrumentToken:   quote.InstrumentToken,
+					LastPrice:         quote.LastPrice,
+					ChangePercent:     changePercent(quote.LastPrice, quote.OHLC.Close),
+					OHLC:              quote.OHLC,
+					Volume:            quote.Volume,
+					AveragePrice:      quote.AveragePrice,
+					LastQuantity:      quote.LastQuantity,
+					LastTradeTime:     quote.LastTradeTime,
+					BuyQuantity:       quote.BuyQuantity,
+					SellQuantity:      quote.SellQuantity,
+					NetChange:         quote.NetChange,
+					OI:                quote.OI,
+					OIDayHigh:         quote.OIDayHigh,
+					OIDayLow:          quote.OIDayLow,
+					LowerCircuitLimit: quote.LowerCircuitLimit,
+					UpperCircuitLimit: quote.UpperCircuitLimit,
+					Timestamp:         quote.Timestamp,
+					Depth:             quote.Depth,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return z.listResult(request, quoteSummary("Quotes", len(rows), requests, missing), rows)
+	}
+}
+
+func (z *ZerodhaMcpServer) LTP() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		kc := z.client(ctx)
+		instruments, err := requestInstruments(kc, request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		rows := []ltpRow{}
+		var missing []string
+		requests, err := inBatches(ctx, instruments, maxLTPBatch, func(batch []string) error {
+			ltps, err := kc.GetLTP(batch...)
+			if err != nil {
+				return err
+			}
+			for _, instrument := range batch {
+				ltp, ok := ltps[instrument]
+				if !ok {
+					missing = append(missing, instrument)
+					continue
+				}
+				rows = append(rows, ltpRow{Instrument: instrument, InstrumentToken: ltp.InstrumentToken, LastPrice: ltp.LastPrice})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return z.listResult(request, quoteSummary("Last traded prices", len(rows), requests, missing), rows)
+	}
+}
+
+func (z *ZerodhaMcpServer) OHLC() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		kc := z.client(ctx)
+		instruments, err := requestInstruments(kc, request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		rows := []ohlcRow{}
+		var missing []string
+		requests, err := inBatches(ctx, instruments, maxLTPBatch, func(batch []string) error {
+			quotes, err := kc.GetOHLC(batch...)
+			if err != nil {
+				return err
+			}
+			for _, instrument := range batch {
+				quote, ok := quotes[instrument]
+				if !ok {
+					missing = append(missing, instrument)
+					continue
+				}
+				rows = append(rows, ohlcRow{
+					Instrument:      instrument,
+					InstrumentToken: quote.InstrumentToken,
+					LastPrice:       quote.LastPrice,
+					ChangePercent:   changePercent(quote.LastPrice, quote.OHLC.Close),
+					OHLC:            quote.OHLC,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return z.listResult(request, quoteSummary("OHLC", len(rows), requests, missing), rows)
+	}
+}
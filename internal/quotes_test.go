@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+func TestRequestInstruments(t *testing.T) {
+	kc := newKiteClient(t, kiteRoutes{
+		kiteconnect.URIGetHoldings: []map[string]any{
+			{"exchange": "NSE", "tradingsymbol": "INFY", "quantity": 10},
+			{"exchange": "BSE", "tradingsymbol": "TCS", "quantity": 5},
+		},
+		kiteconnect.URIGetPositions: map[string]any{
+			"net": []map[string]any{
+				{"exchange": "NFO", "tradingsymbol": "NIFTY26OCTFUT", "quantity": -75},
+				{"exchange": "NSE", "tradingsymbol": "SBIN", "quantity": 0},
+			},
+			"day": []map[string]any{{"exchange": "NSE", "tradingsymbol": "WIPRO", "quantity": 1}},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		args    map[string]any
+		want    string
+		wantErr string
+	}{
+		{name: "instrument", args: map[string]any{"instrument": "nse:infy"}, want: "NSE:INFY"},
+		{name: "instruments", args: map[string]any{"instrument": "NSE:INFY", "instruments": []any{"nse:tcs", "NSE:INFY", "bse:infy"}}, want: "NSE:INFY,NSE:TCS,BSE:INFY"},
+		{name: "holdings", args: map[string]any{"source": SourceHoldings}, want: "NSE:INFY,BSE:TCS"},
+		{name: "open net positions", args: map[string]any{"source": SourcePositions}, want: "NFO:NIFTY26OCTFUT"},
+		{name: "instruments and holdings", args: map[string]any{"instruments": "NSE:SBIN, nse:infy", "source": SourceHoldings}, want: "NSE:SBIN,NSE:INFY,BSE:TCS"},
+		{name: "unknown source", args: map[string]any{"source": "watchlist"}, wantErr: `source "watchlist" must be holdings or positions`},
+		{name: "nothing", args: map[string]any{"instruments": " , "}, wantErr: "instrument, instruments or source is required"},
+	}
+	for _, tt := range tests {
+		instruments, err := requestInstruments(kc, callRequest(tt.args))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || strings.Join(instruments, ",") != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, instruments, err, tt.want)
+		}
+	}
+
+	if _, err := requestInstruments(newKiteClient(t, kiteRoutes{}), callRequest(map[string]any{"source": SourceHoldings})); err == nil {
+		t.Error("a failed holdings request was ignored")
+	}
+}
+
+// quoteRoute answers Kite quote requests for every instrument but those it leaves out, and
+// records the number of instruments in each request.
+type quoteRoute struct {
+	mu      sync.Mutex
+	batches []int
+	missing []string
+}
+
+func (q *quoteRoute) serve(r *http.Request) any {
+	instruments := r.URL.Query()["i"]
+	q.mu.Lock()
+	q.batches = append(q.batches, len(instruments))
+	q.mu.Unlock()
+
+	quotes := map[string]any{}
+	for i, instrument := range instruments {
+		if !slices.Contains(q.missing, instrument) {
+			quotes[instrument] = map[string]any{"instrument_token": i + 1, "last_price": 100, "ohlc": map[string]any{"close": 80}}
+		}
+	}
+	return quotes
+}
+
+func TestQuoteBatches(t *testing.T) {
+	instruments := func(n int) []any {
+		list := make([]any, n)
+		for i := range list {
+			list[i] = fmt.Sprintf("NSE:STOCK%d", i)
+		}
+		return list
+	}
+
+	tests := []struct {
+		name    string
+		handler func(*ZerodhaMcpServer) server.ToolHandlerFunc
+		count   int
+		want    []int
+	}{
+		{name: "quote", handler: (*ZerodhaMcpServer).Quote, count: 1001, want: []int{500, 500, 1}},
+		{name: "ltp", handler: (*ZerodhaMcpServer).LTP, count: 2000, want: []int{1000, 1000}},
+		{name: "ohlc", handler: (*ZerodhaMcpServer).OHLC, count: 1000, want: []int{1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Batches after the first wait for the quote rate limit
+			t.Parallel()
+			route := &quoteRoute{missing: []string{"NSE:STOCK7"}}
+			// The client asks for last prices and OHLC at the full quote endpoint too
+			z := newTestServer(t, kiteRoutes{kiteconnect.URIGetQuote: route.serve})
+
+			result, err := tt.handler(z)(context.Background(), callRequest(map[string]any{"instruments": instruments(tt.count)}))
+			summary, _ := resultText(t, result, err)
+			if !slices.Equal(route.batches, tt.want) {
+				t.Errorf("requested batches of %v, want %v", route.batches, tt.want)
+			}
+			if want := fmt.Sprintf("for %d instruments in %s. No data for NSE:STOCK7,", tt.count-1, countSummary(len(tt.want), "request")); !strings.Contains(summary, want) {
+				t.Errorf("got summary %q, want %q", summary, want)
+			}
+		})
+	}
+}
+
+func TestInBatchesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var sizes []int
+	requests, err := inBatches(ctx, make([]string, 2*maxQuoteBatch), maxQuoteBatch, func(batch []string) error {
+		sizes = append(sizes, len(batch))
+		cancel()
+		return nil
+	})
+	if requests != 1 || err != context.Canceled || !slices.Equal(sizes, []int{maxQuoteBatch}) {
+		t.Errorf("got %d requests of %v, %v; want the first batch only", requests, sizes, err)
+	}
+}
+
+func TestChangePercent(t *testing.T) {
+	tests := []struct{ last, close, want float64 }{
+		{110, 100, 10},
+		{90, 100, -10},
+		{100, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := changePercent(tt.last, tt.close); fmt.Sprintf("%.6f", got) != fmt.Sprintf("%.6f", tt.want) {
+			t.Errorf("changePercent(%g, %g) = %g, want %g", tt.last, tt.close, got, tt.want)
+		}
+	}
+}
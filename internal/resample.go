@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// ResampleTargets lists the intervals candles can be resampled to, for tool schemas.
+var ResampleTargets = []string{"3minute", "5minute", "10minute", "15minute", "30minute", "60minute", "day", "week", "month"}
+
+const defaultCandleSample = 10
+
+// sessionOpenHour and sessionOpenMinute are when the NSE and BSE sessions open, in IST.
+const sessionOpenHour, sessionOpenMinute = 9, 15
+
+// intervalMinutes returns the length of an intraday interval in minutes, 0 for day and longer.
+func intervalMinutes(interval string) int {
+	if interval == "minute" {
+		return 1
+	}
+	if n, ok := strings.CutSuffix(interval, "minute"); ok {
+		minutes, _ := strconv.Atoi(n)
+		return minutes
+	}
+	return 0
+}
+
+// intervalRank orders intervals from finest to coarsest.
+func intervalRank(interval string) int {
+	switch interval {
+	case "day":
+		return 1 << 20
+	case "week":
+		return 1 << 21
+	case "month":
+		return 1 << 22
+	default:
+		return intervalMinutes(interval)
+	}
+}
+
+// validateResample checks that target is coarser than interval and made of whole source candles.
+func validateResample(interval, target string) error {
+	if !slices.Contains(ResampleTargets, target) {
+		return fmt.Errorf("resample %q must be one of %s", target, strings.Join(ResampleTargets, ", "))
+	}
+	if intervalRank(target) <= intervalRank(interval) {
+		return fmt.Errorf("resample %q must be a longer interval than %q", target, interval)
+	}
+	source, dest := intervalMinutes(interval), intervalMinutes(target)
+	if source > 0 && dest > 0 && dest%source != 0 {
+		return fmt.Errorf("resample %q is not a multiple of %q", target, interval)
+	}
+	return nil
+}
+
+// resampleCandles aggregates candles into longer ones. Intraday buckets are counted from the
+// 09:15 IST session open of each day, as Kite's own candles are, so a day that starts with a
+// missing candle still lines up. Weeks start on Monday.
+func resampleCandles(candles []kiteconnect.HistoricalData, target string) []kiteconnect.HistoricalData {
+	bucketMinutes := intervalMinutes(target)
+
+	var (
+		resampled []kiteconnect.HistoricalData
+		current   time.Time
+	)
+	for _, candle := range candles {
+		t := candle.Date.In(istLocation)
+
+		var bucket time.Time
+		switch target {
+		case "day":
+			bucket = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, istLocation)
+		case "week":
+			bucket = time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, istLocation)
+		case "month":
+			bucket = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, istLocation)
+		default:
+			sessionAt := time.Date(t.Year(), t.Month(), t.Day(), sessionOpenHour, sessionOpenMinute, 0, 0, istLocation)
+			size := time.Duration(bucketMinutes) * time.Minute
+			offset := t.Sub(sessionAt) / size * size
+			if offset > t.Sub(sessionAt) {
+				// Candles before the open, e.g. on MCX, fall in the bucket that ends at or before it
+				offset -= size
+			}
+			bucket = sessionAt.Add(offset)
+		}
+
+		if n := len(resampled); n > 0 && bucket.Equal(current) {
+			last := &resampled[n-1]
+			last.High = math.Max(last.High, candle.High)
+			last.Low = math.Min(last.Low, candle.Low)
+			last.Close = candle.Close
+			last.Volume += candle.Volume
+			last.OI = candle.OI
+			continue
+		}
+		current = bucket
+		resampled = append(resampled, kiteconnect.HistoricalData{
+			Date:   models.Time{Time: bucket},
+			Open:   candle.Open,
+			High:   candle.High,
+			Low:    candle.Low,
+			Close:  candle.Close,
+			Volume: candle.Volume,
+			OI:     candle.OI,
+		})
+	}
+	return resampled
+}
+
+// CandleSummary describes a run of candles in a few numbers, for prompts that do not need every bar.
+type CandleSummary struct {
+	Instrument              string                       `json:"instrument"`
+	Interval                string                       `json:"interval"`
+	From                    models.Time                  `json:"from"`
+	To                      models.Time                  `json:"to"`
+	Candles                 int                          `json:"candles"`
+	Open                    float64                      `json:"open"`
+	Close                   float64                      `json:"close"`
+	ReturnPercent           float64                      `json:"return_pct"`
+	High                    float64                      `json:"high"`
+	HighDate                models.Time                  `json:"high_date"`
+	Low                     float64                      `json:"low"`
+	LowDate                 models.Time                  `json:"low_date"`
+	AverageVolume           float64                      `json:"average_volume"`
+	MaxDrawdownPercent      float64                      `json:"max_drawdown_pct"`
+	DrawdownPeakDate        models.Time                  `json:"drawdown_peak_date"`
+	DrawdownTroughDate      models.Time                  `json:"drawdown_trough_date"`
+	VolatilityPercent       float64                      `json:"volatility_pct"`
+	AnnualizedVolatilityPct float64                      `json:"annualized_volatility_pct"`
+	Sample                  []kiteconnect.HistoricalData `json:"sample"`
+}
+
+// barsPerYear is used to annualize volatility; an NSE session has 375 one minute bars.
+func barsPerYear(interval string) float64 {
+	switch interval {
+	case "day":
+		return 252
+	case "week":
+		return 52
+	case "month":
+		return 12
+	default:
+		return 252 * 375 / float64(intervalMinutes(interval))
+	}
+}
+
+// summarizeCandles computes the period return, extremes, average volume, maximum drawdown of the
+// closes and the volatility of close to close log returns, with an evenly spaced sample of candles.
+func summarizeCandles(label, interval string, candles []kiteconnect.HistoricalData, sampleSize int) CandleSummary {
+	summary := CandleSummary{Instrument: label, Interval: interval, Candles: len(candles), Sample: []kiteconnect.HistoricalData{}}
+	if len(candles) == 0 {
+		return summary
+	}
+
+	first, last := candles[0], candles[len(candles)-1]
+	summary.From, summary.To = first.Date, last.Date
+	summary.Open, summary.Close = first.Open, last.Close
+	if first.Open != 0 {
+		summary.ReturnPercent = (last.Close/first.Open - 1) * 100
+	}
+
+	summary.High, summary.HighDate = first.High, first.Date
+	summary.Low, summary.LowDate = first.Low, first.Date
+	var volume float64
+	peak, peakDate := first.Close, first.Date
+	var returns []float64
+	for i, candle := range candles {
+		if candle.High > summary.High {
+			summary.High, summary.HighDate = candle.High, candle.Date
+		}
+		if candle.Low < summary.Low {
+			summary.Low, summary.LowDate = candle.Low, candle.Date
+		}
+		volume += float64(candle.Volume)
+
+		if candle.Close > peak {
+			peak, peakDate = candle.Close, candle.Date
+		}
+		if peak > 0 {
+			if drawdown := (candle.Close/peak - 1) * 100; drawdown < summary.MaxDrawdownPercent {
+				summary.MaxDrawdownPercent = drawdown
+				summary.DrawdownPeakDate, summary.DrawdownTroughDate = peakDate, candle.Date
+			}
+		}
+
+		if i > 0 && candles[i-1].Close > 0 && candle.Close > 0 {
+			returns = append(returns, math.Log(candle.Close/candles[i-1].Close))
+		}
+	}
+	summary.AverageVolume = volume / float64(len(candles))
+
+	if len(returns) > 1 {
+		var mean float64
+		for _, r := range returns {
+			mean += r
+		}
+		mean /= float64(len(returns))
+		var variance float64
+		for _, r := range returns {
+			variance += (r - mean) * (r - mean)
+		}
+		stddev := math.Sqrt(variance / float64(len(returns)-1))
+		summary.VolatilityPercent = stddev * 100
+		summary.AnnualizedVolatilityPct = stddev * math.Sqrt(barsPerYear(interval)) * 100
+	}
+
+	summary.Sample = sampleCandles(candles, sampleSize)
+	return summary
+}
+
+// sampleCandles picks n evenly spaced candles, always including the first and the last.
+func sampleCandles(candles []kiteconnect.HistoricalData, n int) []kiteconnect.HistoricalData {
+	if n >= len(candles) {
+		return candles
+	}
+	if n <= 1 {
+		return candles[len(candles)-n:]
+	}
+	sample := make([]kiteconnect.HistoricalData, 0, n)
+	for i := 0; i < n; i++ {
+		sample = append(sample, candles[i*(len(candles)-1)/(n-1)])
+	}
+	return sample
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+type wantCandle struct {
+	at                     string
+	open, high, low, close float64
+	volume                 int
+}
+
+func TestResampleCandles(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		candles []kiteconnect.HistoricalData
+		want    []wantCandle
+	}{
+		{
+			name:   "15 minutes from the session open",
+			target: "15minute",
+			candles: []kiteconnect.HistoricalData{
+				candleAt(t, "2026-10-16 09:15", 100, 10),
+				candleAt(t, "2026-10-16 09:20", 102, 20),
+				candleAt(t, "2026-10-16 09:25", 98, 30),
+				candleAt(t, "2026-10-16 09:30", 101, 40),
+			},
+			want: []wantCandle{
+				{"2026-10-16 09:15", 100, 103, 97, 98.5, 60},
+				{"2026-10-16 09:30", 101, 102, 100, 101.5, 40},
+			},
+		},
+		{
+			name:   "a day without its first candle still lines up with 09:15",
+			target: "15minute",
+			candles: []kiteconnect.HistoricalData{
+				candleAt(t, "2026-10-16 09:20", 100, 10),
+				candleAt(t, "2026-10-16 09:35", 101, 20),
+			},
+			want: []wantCandle{
+				{"2026-10-16 09:15", 100, 101, 99, 100.5, 10},
+				{"2026-10-16 09:30", 101, 102, 100, 101.5, 20},
+			},
+		},
+		{
+			name:   "60 minutes restart every day",
+			target: "60minute",
+			candles: []kiteconnect.HistoricalData{
+				candleAt(t, "2026-10-15 15:15", 100, 10),
+				candleAt(t, "2026-10-15 15:29", 104, 10),
+				candleAt(t, "2026-10-16 09:15", 110, 5),
+				candleAt(t, "2026-10-16 10:14", 108, 5),
+				candleAt(t, "2026-10-16 10:15", 107, 5),
+			},
+			want: []wantCandle{
+				{"2026-10-15 15:15", 100, 105, 99, 104.5, 20},
+				{"2026-10-16 09:15", 110, 111, 107, 108.5, 10},
+				{"2026-10-16 10:15", 107, 108, 106, 107.5, 5},
+			},
+		},
+		{
+			name:   "candles before the open fall in the bucket ending at it",
+			target: "30minute",
+			candles: []kiteconnect.HistoricalData{
+				candleAt(t, "2026-10-16 09:00", 100, 1),
+				candleAt(t, "2026-10-16 09:14", 101, 1),
+				candleAt(t, "2026-10-16 09:15", 102, 1),
+			},
+			want: []wantCandle{
+				{"2026-10-16 08:45", 100, 102, 99, 101.5, 2},
+				{"2026-10-16 09:15", 102, 103, 101, 102.5, 1},
+			},
+		},
+		{
+			name:   "days",
+			target: "day",
+			candles: []kiteconnect.HistoricalData{
+				candleAt(t, "2026-10-15 09:15", 100, 1),
+				candleAt(t, "2026-10-15 15:29", 90, 1),
+				candleAt(t, "2026-10-16 09:15", 95, 1),
+			},
+			want: []wantCandle{
+				{"2026-10-15 00:00", 100, 101, 89, 90.5, 2},
+				{"2026-10-16 00:00", 95, 96, 94, 95.5, 1},
+			},
+		},
+		{
+			name:   "weeks start on Monday",
+			target: "week",
+			candles: []kiteconnect.HistoricalData{
+				candleAt(t, "2026-10-09 00:00", 100, 1), // Friday
+				candleAt(t, "2026-10-12 00:00", 101, 1), // Monday
+				candleAt(t, "2026-10-16 00:00", 99, 1),  // Friday
+			},
+			want: []wantCandle{
+				{"2026-10-05 00:00", 100, 101, 99, 100.5, 1},
+				{"2026-10-12 00:00", 101, 102, 98, 99.5, 2},
+			},
+		},
+		{
+			name:   "months",
+			target: "month",
+			candles: []kiteconnect.HistoricalData{
+				candleAt(t, "2026-09-30 00:00", 100, 1),
+				candleAt(t, "2026-10-01 00:00", 101, 1),
+				candleAt(t, "2026-10-16 00:00", 103, 1),
+			},
+			want: []wantCandle{
+				{"2026-09-01 00:00", 100, 101, 99, 100.5, 1},
+				{"2026-10-01 00:00", 101, 104, 100, 103.5, 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resampleCandles(tt.candles, tt.target)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d candles, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				c := got[i]
+				at := c.Date.In(istLocation).Format("2006-01-02 15:04")
+				if at != want.at || c.Open != want.open || c.High != want.high || c.Low != want.low || c.Close != want.close || c.Volume != want.volume {
+					t.Errorf("candle %d = %s %g/%g/%g/%g %d, want %s %g/%g/%g/%g %d", i,
+						at, c.Open, c.High, c.Low, c.Close, c.Volume,
+						want.at, want.open, want.high, want.low, want.close, want.volume)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateResample(t *testing.T) {
+	tests := []struct {
+		interval, target string
+		wantErr          string
+	}{
+		{"minute", "15minute", ""},
+		{"5minute", "15minute", ""},
+		{"minute", "day", ""},
+		{"day", "week", ""},
+		{"10minute", "15minute", "not a multiple"},
+		{"15minute", "5minute", "must be a longer interval"},
+		{"day", "day", "must be a longer interval"},
+		{"minute", "2minute", "must be one of"},
+	}
+	for _, tt := range tests {
+		err := validateResample(tt.interval, tt.target)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validateResample(%s, %s) = %v, want %q", tt.interval, tt.target, err, tt.wantErr)
+		}
+	}
+}
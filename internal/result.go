@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// jsonResult returns v as JSON text, preceded by a one line summary for humans reading the transcript.
+// Keys are snake_case, numbers stay numbers, times are ISO-8601 and map keys are sorted, so the
+// same Kite response always encodes to the same bytes.
+func jsonResult(summary string, v any) (*mcp.CallToolResult, error) {
+	body, err := json.Marshal(normalize(v))
+	if err != nil {
+		return nil, err
+	}
+	return textResult(summary, string(body)), nil
+}
+
+// object is a JSON object that keeps its keys in struct field order.
+type object []member
+
+type member struct {
+	Key   string
+	Value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var (
+	objectType     = reflect.TypeOf(object{})
+	timeType       = reflect.TypeOf(time.Time{})
+	modelsTimeType = reflect.TypeOf(models.Time{})
+)
+
+// normalize converts a Kite response into plain JSON values.
+func normalize(v any) any {
+	return normalizeValue(reflect.ValueOf(v))
+}
+
+func normalizeValue(rv reflect.Value) any {
+	if !rv.IsValid() {
+		return nil
+	}
+
+	switch rv.Type() {
+	case objectType:
+		// Already normalized, e.g. rows whose columns depend on the request
+		return rv.Interface()
+	case timeType:
+		return formatTime(rv.Interface().(time.Time))
+	case modelsTimeType:
+		return formatTime(rv.Interface().(models.Time).Time)
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalizeValue(rv.Elem())
+	case reflect.Struct:
+		return normalizeStruct(rv)
+	case reflect.Map:
+		return normalizeMap(rv)
+	case reflect.Slice, reflect.Array:
+		values := make([]any, rv.Len())
+		for i := range values {
+			values[i] = normalizeValue(rv.Index(i))
+		}
+		return values
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil
+		}
+		return f
+	default:
+		return rv.Interface()
+	}
+}
+
+func normalizeStruct(rv reflect.Value) object {
+	obj := object{}
+	typ := rv.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Type != timeType && field.Type != modelsTimeType {
+			// Like encoding/json, the exported fields of an embedded struct are inlined even when its type is unexported
+			obj = append(obj, normalizeStruct(rv.Field(i))...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		key, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+		obj = append(obj, member{Key: key, Value: normalizeValue(rv.Field(i))})
+	}
+	return obj
+}
+
+func normalizeMap(rv reflect.Value) object {
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return mapKey(keys[i]) < mapKey(keys[j])
+	})
+
+	obj := make(object, 0, len(keys))
+	for _, key := range keys {
+		obj = append(obj, member{Key: mapKey(key), Value: normalizeValue(rv.MapIndex(key))})
+	}
+	return obj
+}
+
+func mapKey(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return key.String()
+	}
+	body, _ := json.Marshal(key.Interface())
+	return strings.Trim(string(body), `"`)
+}
+
+// fieldKey prefers the json tag, then the csv tag used by the instrument dumps, then the field name.
+func fieldKey(field reflect.StructField) (string, bool) {
+	for _, tag := range []string{"json", "csv"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return snakeCase(name), true
+		}
+	}
+	return snakeCase(field.Name), true
+}
+
+// snakeCase turns Go and camelCase names into snake_case, keeping acronyms together (ISIN -> isin).
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// formatTime renders times as ISO-8601. Kite sends most timestamps without a zone; they are
+// exchange times in IST, so they are reinterpreted in IST. Bare dates such as expiries stay dates.
+func formatTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	if t.Location() == time.UTC && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format(time.DateOnly)
+	}
+	return exchangeTime(t).Format(time.RFC3339)
+}
+
+// exchangeTime reads a Kite timestamp without a zone, which models.Time parses as UTC, as IST.
+func exchangeTime(t time.Time) time.Time {
+	if t.Location() != time.UTC {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), istLocation)
+}
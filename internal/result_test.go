@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// resultText returns the summary and body of a tool result, failing the test on an error result.
+func resultText(t *testing.T, result *mcp.CallToolResult, err error) (string, string) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("error result: %s", result.Content[0].(mcp.TextContent).Text)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("got %d contents, want a summary and a body", len(result.Content))
+	}
+	return result.Content[0].(mcp.TextContent).Text, result.Content[1].(mcp.TextContent).Text
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"LastPrice", "last_price"},
+		{"ISIN", "isin"},
+		{"OHLC", "ohlc"},
+		{"OIDayHigh", "oi_day_high"},
+		{"HTTPAddr", "http_addr"},
+		{"userID", "user_id"},
+		{"instrumentToken", "instrument_token"},
+		{"Day2Change", "day2_change"},
+		{"last_price", "last_price"},
+		{"tradingsymbol", "tradingsymbol"},
+	}
+	for _, tt := range tests {
+		if got := snakeCase(tt.name); got != tt.want {
+			t.Errorf("snakeCase(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+type resultPrice struct {
+	Currency string
+	Open     float64
+	Close    float64 `json:"close_price"`
+}
+
+type resultRow struct {
+	Symbol string `csv:"tradingsymbol"`
+	ISIN   string
+	resultPrice
+	Change     float64
+	Ratio      float64
+	Skipped    string `json:"-"`
+	internal   string
+	Expiry     models.Time
+	Placed     time.Time `json:"order_timestamp,omitempty"`
+	Parent     *string
+	Tags       []string
+	Quantities map[int]float64
+}
+
+func TestNormalize(t *testing.T) {
+	row := resultRow{
+		Symbol:      "INFY",
+		ISIN:        "INE009A01021",
+		resultPrice: resultPrice{Currency: "INR", Open: 1500, Close: 1510.5},
+		Change:      math.NaN(),
+		Ratio:       math.Inf(-1),
+		Skipped:     "hidden",
+		internal:    "hidden",
+		Expiry:      models.Time{Time: time.Date(2026, 10, 27, 0, 0, 0, 0, time.UTC)},
+		Placed:      time.Date(2026, 10, 16, 9, 15, 30, 0, time.UTC),
+		Tags:        []string{"swing"},
+		Quantities:  map[int]float64{10: 2, 2: 1, 1: math.NaN()},
+	}
+	body, err := json.Marshal(normalize([]any{row, map[string]any{"b": 1, "a": nil}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields keep their order, embedded fields are inlined, NaN and infinities are null and map
+	// keys are sorted as strings
+	want := `[{"tradingsymbol":"INFY","isin":"INE009A01021","currency":"INR","open":1500,"close_price":1510.5,"change":null,"ratio":null,` +
+		`"expiry":"2026-10-27","order_timestamp":"2026-10-16T09:15:30+05:30","parent":null,"tags":["swing"],` +
+		`"quantities":{"1":null,"10":2,"2":1}},{"a":null,"b":1}]`
+	if string(body) != want {
+		t.Errorf("got  %s\nwant %s", body, want)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	ist := istTime(t, "2026-10-16 09:15:00")
+	tests := []struct {
+		name string
+		at   time.Time
+		want any
+	}{
+		{name: "zero", at: time.Time{}, want: nil},
+		{name: "exchange time", at: time.Date(2026, 10, 16, 9, 15, 0, 0, time.UTC), want: "2026-10-16T09:15:00+05:30"},
+		{name: "bare date", at: time.Date(2026, 10, 27, 0, 0, 0, 0, time.UTC), want: "2026-10-27"},
+		{name: "IST", at: ist, want: "2026-10-16T09:15:00+05:30"},
+		{name: "IST midnight", at: istTime(t, "2026-10-16 00:00:00"), want: "2026-10-16T00:00:00+05:30"},
+		{name: "zoned", at: ist.In(time.FixedZone("", 0)), want: "2026-10-16T03:45:00Z"},
+	}
+	for _, tt := range tests {
+		if got := formatTime(tt.at); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExchangeTime(t *testing.T) {
+	// A time without a zone is read as IST, the same wall clock rather than the same instant
+	got := exchangeTime(time.Date(2026, 10, 16, 9, 15, 0, 0, time.UTC))
+	if !got.Equal(istTime(t, "2026-10-16 09:15:00")) || got.Location() != istLocation {
+		t.Errorf("got %s", got)
+	}
+	zoned := istTime(t, "2026-10-16 09:15:00").In(time.FixedZone("UTC+1", 3600))
+	if got := exchangeTime(zoned); got != zoned {
+		t.Errorf("a zoned time changed to %s", got)
+	}
+}
+
+func TestJSONResultIsStable(t *testing.T) {
+	data := map[string]any{}
+	for _, key := range []string{"pnl", "quantity", "average_price", "exchange", "tradingsymbol", "last_price"} {
+		data[key] = len(key)
+	}
+	first, err := jsonResult("Stable.", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		again, err := jsonResult("Stable.", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, want := resultText(t, first, nil)
+		if _, got := resultText(t, again, nil); got != want {
+			t.Fatalf("got %s, then %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// Names of the risk rules, as they appear in the config file and in rejections.
+const (
+	RuleKillSwitch           = "kill_switch"
+	RuleMaxOrdersPerMinute   = "max_orders_per_minute"
+	RuleAllowedExchanges     = "allowed_exchanges"
+	RuleAllowedProducts      = "allowed_products"
+	RuleAllowedSymbols       = "allowed_symbols"
+	RuleMaxOrderValue        = "max_order_value"
+	RuleMISCutoff            = "mis_cutoff"
+	RuleMaxQuantityPerSymbol = "max_quantity_per_symbol"
+	RuleMaxDailyLoss         = "max_daily_loss"
+)
+
+// RiskPolicy holds the guardrails every order mutation passes, both before the preview and again
+// before it is sent. Zero values and empty lists disable a rule.
+type RiskPolicy struct {
+	// KillSwitch refuses every order mutation, including cancellations.
+	KillSwitch         bool `yaml:"kill_switch"`
+	MaxOrdersPerMinute int  `yaml:"max_orders_per_minute"`
+
+	AllowedExchanges []string `yaml:"allowed_exchanges"`
+	AllowedProducts  []string `yaml:"allowed_products"`
+	// AllowedSymbols are tradingsymbols or exchange:tradingsymbol.
+	AllowedSymbols []string `yaml:"allowed_symbols"`
+
+	MaxOrderValue float64 `yaml:"max_order_value"`
+	// MISCutoff is a time of day in IST, e.g. 15:00, after which MIS orders may only reduce positions.
+	MISCutoff string `yaml:"mis_cutoff"`
+	// MaxQuantityPerSymbol caps the net position in one instrument across products.
+	MaxQuantityPerSymbol int `yaml:"max_quantity_per_symbol"`
+	// MaxDailyLoss stops orders that add to positions once today's mark-to-market loss reaches it.
+	MaxDailyLoss float64 `yaml:"max_daily_loss"`
+}
+
+func (p RiskPolicy) validate() []error {
+	var errs []error
+	if p.MaxOrdersPerMinute < 0 {
+		errs = append(errs, fmt.Errorf("risk.%s %d must not be negative", RuleMaxOrdersPerMinute, p.MaxOrdersPerMinute))
+	}
+	if p.MaxOrderValue < 0 {
+		errs = append(errs, fmt.Errorf("risk.%s %g must not be negative", RuleMaxOrderValue, p.MaxOrderValue))
+	}
+	if p.MaxQuantityPerSymbol < 0 {
+		errs = append(errs, fmt.Errorf("risk.%s %d must not be negative", RuleMaxQuantityPerSymbol, p.MaxQuantityPerSymbol))
+	}
+	if p.MaxDailyLoss < 0 {
+		errs = append(errs, fmt.Errorf("risk.%s %g must not be negative", RuleMaxDailyLoss, p.MaxDailyLoss))
+	}
+	for _, product := range p.AllowedProducts {
+		if !slices.Contains(OrderProducts, strings.ToUpper(product)) {
+			errs = append(errs, fmt.Errorf("risk.%s: %q must be one of %s", RuleAllowedProducts, product, strings.Join(OrderProducts, ", ")))
+		}
+	}
+	if _, err := p.misCutoff(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// misCutoff returns the MIS cutoff as the time since midnight, or -1 when there is none.
+func (p RiskPolicy) misCutoff() (time.Duration, error) {
+	if p.MISCutoff == "" {
+		return -1, nil
+	}
+	t, err := time.Parse("15:04", p.MISCutoff)
+	if err != nil {
+		return -1, fmt.Errorf("risk.%s %q must be a time of day such as 15:00", RuleMISCutoff, p.MISCutoff)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// RiskViolation is the rejection of an order by a risk rule.
+type RiskViolation struct {
+	Rule   string
+	Reason string
+}
+
+func (v *RiskViolation) Error() string {
+	return fmt.Sprintf("rejected by risk rule %s: %s", v.Rule, v.Reason)
+}
+
+func violation(rule, format string, args ...any) *RiskViolation {
+	return &RiskViolation{Rule: rule, Reason: fmt.Sprintf(format, args...)}
+}
+
+// RiskEngine checks order mutations against the risk policy and counts the ones sent for the
+// per-minute limit, which applies across all accounts.
+type RiskEngine struct {
+	policy RiskPolicy
+	cutoff time.Duration
+
+	mu   sync.Mutex
+	sent []time.Time
+}
+
+func NewRiskEngine(policy RiskPolicy) *RiskEngine {
+	cutoff, _ := policy.misCutoff()
+	return &RiskEngine{policy: policy, cutoff: cutoff}
+}
+
+// Check applies the rules to a place, modify or cancel of order o. Cancellations are only held
+// back by the kill switch and the rate limit. A modification replaces an order of quantity
+// replaced, so only the difference to it counts towards positions. With commit, a passing order
+// counts against the rate limit, so it is set when the order is about to be sent rather than previewed.
+func (r *RiskEngine) Check(kc *kiteconnect.Client, action string, o orderRequest, replaced int, commit bool) error {
+	err := r.check(kc, action, o, replaced, commit)
+	var v *RiskViolation
+	if errors.As(err, &v) {
+		slog.Warn("Order rejected by risk policy", "rule", v.Rule, "reason", v.Reason, "action", action, "order", o.describe())
+	}
+	return err
+}
+
+func (r *RiskEngine) check(kc *kiteconnect.Client, action string, o orderRequest, replaced int, commit bool) error {
+	p := r.policy
+	if p.KillSwitch {
+		return violation(RuleKillSwitch, "the kill switch is on, no orders can be placed, modified or cancelled")
+	}
+
+	if action != "cancel" {
+		if err := r.checkOrder(kc, o, replaced); err != nil {
+			return err
+		}
+	}
+
+	if p.MaxOrdersPerMinute > 0 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		now := time.Now()
+		r.sent = slices.DeleteFunc(r.sent, func(t time.Time) bool { return now.Sub(t) >= time.Minute })
+		if len(r.sent) >= p.MaxOrdersPerMinute {
+			return violation(RuleMaxOrdersPerMinute, "%d order changes were sent in the last minute, the limit is %d; try again in %s",
+				len(r.sent), p.MaxOrdersPerMinute, (time.Minute - now.Sub(r.sent[0])).Round(time.Second))
+		}
+		if commit {
+			r.sent = append(r.sent, now)
+		}
+	}
+	return nil
+}
+
+func (r *RiskEngine) checkOrder(kc *kiteconnect.Client, o orderRequest, replaced int) error {
+	p := r.policy
+	if len(p.AllowedExchanges) > 0 && !containsFold(p.AllowedExchanges, o.Exchange) {
+		return violation(RuleAllowedExchanges, "exchange %s is not one of %s", o.Exchange, strings.Join(p.AllowedExchanges, ", "))
+	}
+	if len(p.AllowedProducts) > 0 && !containsFold(p.AllowedProducts, o.Product) {
+		return violation(RuleAllowedProducts, "product %s is not one of %s", o.Product, strings.Join(p.AllowedProducts, ", "))
+	}
+	if len(p.AllowedSymbols) > 0 && !containsFold(p.AllowedSymbols, o.Tradingsymbol) && !containsFold(p.AllowedSymbols, o.instrument()) {
+		return violation(RuleAllowedSymbols, "%s is not one of the allowed symbols %s", o.instrument(), strings.Join(p.AllowedSymbols, ", "))
+	}
+
+	if p.MaxOrderValue > 0 {
+		var lastPrice float64
+		if o.Price == 0 {
+			ltp, err := kc.GetLTP(o.instrument())
+			if err != nil {
+				return violation(RuleMaxOrderValue, "the order value cannot be estimated without the last price: %v", err)
+			}
+			lastPrice = ltp[o.instrument()].LastPrice
+		}
+		if value := estimatedPrice(o, lastPrice) * float64(o.Quantity); value > p.MaxOrderValue {
+			return violation(RuleMaxOrderValue, "the order value of about %.2f exceeds the limit of %.2f", value, p.MaxOrderValue)
+		}
+	}
+
+	misAfterCutoff := false
+	if r.cutoff >= 0 && o.Product == kiteconnect.ProductMIS {
+		now := time.Now().In(istLocation)
+		misAfterCutoff = time.Duration(now.Hour())*time.Hour+time.Duration(now.Minute())*time.Minute >= r.cutoff
+	}
+	if !misAfterCutoff && p.MaxQuantityPerSymbol == 0 && p.MaxDailyLoss == 0 {
+		return nil
+	}
+
+	// The remaining rules only hold back orders that open or add to a position, so that
+	// positions can always be reduced.
+	rule := RuleMaxDailyLoss
+	switch {
+	case misAfterCutoff:
+		rule = RuleMISCutoff
+	case p.MaxQuantityPerSymbol > 0:
+		rule = RuleMaxQuantityPerSymbol
+	}
+	positions, err := kc.GetPositions()
+	if err != nil {
+		return violation(rule, "positions are needed to check the order and are unavailable: %v", err)
+	}
+	var symbolQuantity, productQuantity int
+	var m2m float64
+	for _, position := range positions.Net {
+		m2m += position.M2M
+		if position.Exchange == o.Exchange && position.Tradingsymbol == o.Tradingsymbol {
+			symbolQuantity += position.Quantity
+			if position.Product == o.Product {
+				productQuantity += position.Quantity
+			}
+		}
+	}
+	// Delivery holdings are not positions, but they are part of what is held in the instrument
+	holdings, err := kc.GetHoldings()
+	if err != nil {
+		return violation(rule, "holdings are needed to check the order and are unavailable: %v", err)
+	}
+	for _, holding := range holdings {
+		if holding.Exchange == o.Exchange && holding.Tradingsymbol == o.Tradingsymbol {
+			symbolQuantity += holding.Quantity + holding.T1Quantity
+		}
+	}
+	signed := o.Quantity - replaced
+	if o.TransactionType == kiteconnect.TransactionTypeSell {
+		signed = -signed
+	}
+
+	if misAfterCutoff && abs(productQuantity+signed) > abs(productQuantity) {
+		return violation(RuleMISCutoff, "new MIS positions are not allowed after %s IST, only MIS positions can be reduced", p.MISCutoff)
+	}
+	resulting := symbolQuantity + signed
+	if p.MaxQuantityPerSymbol > 0 && abs(resulting) > abs(symbolQuantity) && abs(resulting) > p.MaxQuantityPerSymbol {
+		return violation(RuleMaxQuantityPerSymbol, "the position in %s would be %d, the limit is %d", o.instrument(), resulting, p.MaxQuantityPerSymbol)
+	}
+	if p.MaxDailyLoss > 0 && -m2m >= p.MaxDailyLoss && abs(resulting) > abs(symbolQuantity) {
+		return violation(RuleMaxDailyLoss, "today's loss of %.2f has reached the limit of %.2f, only orders that reduce positions are allowed", -m2m, p.MaxDailyLoss)
+	}
+	return nil
+}
+
+func containsFold(values []string, v string) bool {
+	return slices.ContainsFunc(values, func(value string) bool { return strings.EqualFold(value, v) })
+}
@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// fakeKite serves the portfolio and LTP endpoints the risk rules read. A nil list makes the
+// endpoint fail.
+type fakeKite struct {
+	positions []map[string]any
+	holdings  []map[string]any
+	ltp       map[string]any
+}
+
+func position(symbol, product string, quantity int, m2m float64) map[string]any {
+	return map[string]any{"exchange": "NSE", "tradingsymbol": symbol, "product": product, "quantity": quantity, "m2m": m2m}
+}
+
+func holding(symbol string, quantity, t1 int) map[string]any {
+	return map[string]any{"exchange": "NSE", "tradingsymbol": symbol, "quantity": quantity, "t1_quantity": t1}
+}
+
+func newFakeKite(t *testing.T, fake fakeKite) *kiteconnect.Client {
+	t.Helper()
+	routes := kiteRoutes{}
+	if fake.positions != nil {
+		routes[kiteconnect.URIGetPositions] = map[string]any{"net": fake.positions, "day": []any{}}
+	}
+	if fake.holdings != nil {
+		routes[kiteconnect.URIGetHoldings] = fake.holdings
+	}
+	if fake.ltp != nil {
+		// The client asks for last prices at the full quote endpoint
+		routes[kiteconnect.URIGetQuote] = fake.ltp
+	}
+	return newKiteClient(t, routes)
+}
+
+func buy(symbol, product string, quantity int) orderRequest {
+	return orderRequest{
+		Variety: kiteconnect.VarietyRegular, Exchange: "NSE", Tradingsymbol: symbol, TransactionType: kiteconnect.TransactionTypeBuy,
+		Quantity: quantity, Product: product, OrderType: kiteconnect.OrderTypeLimit, Price: 100,
+	}
+}
+
+func sell(symbol, product string, quantity int) orderRequest {
+	o := buy(symbol, product, quantity)
+	o.TransactionType = kiteconnect.TransactionTypeSell
+	return o
+}
+
+func withOrder(o orderRequest, change func(*orderRequest)) orderRequest {
+	change(&o)
+	return o
+}
+
+func TestRiskEngineCheck(t *testing.T) {
+	flat := fakeKite{positions: []map[string]any{}, holdings: []map[string]any{}}
+	tests := []struct {
+		name     string
+		policy   RiskPolicy
+		action   string
+		order    orderRequest
+		replaced int
+		kite     fakeKite
+		// afterCutoff moves the MIS cutoff to midnight, so it has always passed.
+		afterCutoff bool
+		want        string
+	}{
+		{name: "no rules", policy: RiskPolicy{}, action: "place", order: buy("INFY", "CNC", 1000)},
+
+		{name: "kill switch blocks placing", policy: RiskPolicy{KillSwitch: true}, action: "place", order: buy("INFY", "CNC", 1), want: RuleKillSwitch},
+		{name: "kill switch blocks cancelling", policy: RiskPolicy{KillSwitch: true}, action: "cancel", order: buy("INFY", "CNC", 1), want: RuleKillSwitch},
+		{name: "cancel skips the order rules", policy: RiskPolicy{AllowedExchanges: []string{"NFO"}, MaxOrderValue: 1}, action: "cancel", order: buy("INFY", "CNC", 10)},
+
+		{name: "allowed exchange ignores case", policy: RiskPolicy{AllowedExchanges: []string{"nse"}}, action: "place", order: buy("INFY", "CNC", 1)},
+		{name: "exchange not allowed", policy: RiskPolicy{AllowedExchanges: []string{"NFO"}}, action: "place", order: buy("INFY", "CNC", 1), want: RuleAllowedExchanges},
+		{name: "product not allowed", policy: RiskPolicy{AllowedProducts: []string{"CNC"}}, action: "place", order: buy("INFY", "MIS", 1), want: RuleAllowedProducts},
+		{name: "allowed tradingsymbol", policy: RiskPolicy{AllowedSymbols: []string{"INFY"}}, action: "place", order: buy("INFY", "CNC", 1)},
+		{name: "allowed exchange:tradingsymbol", policy: RiskPolicy{AllowedSymbols: []string{"nse:infy"}}, action: "place", order: buy("INFY", "CNC", 1)},
+		{name: "symbol not allowed", policy: RiskPolicy{AllowedSymbols: []string{"BSE:INFY", "TCS"}}, action: "modify", order: buy("INFY", "CNC", 1), want: RuleAllowedSymbols},
+
+		{name: "order value within limit", policy: RiskPolicy{MaxOrderValue: 1000}, action: "place", order: buy("INFY", "CNC", 10)},
+		{name: "limit order value above limit", policy: RiskPolicy{MaxOrderValue: 999}, action: "place", order: buy("INFY", "CNC", 10), want: RuleMaxOrderValue},
+		{
+			name:   "market order valued at the last price",
+			policy: RiskPolicy{MaxOrderValue: 14000},
+			action: "place",
+			order:  withOrder(buy("INFY", "CNC", 10), func(o *orderRequest) { o.OrderType, o.Price = kiteconnect.OrderTypeMarket, 0 }),
+			kite:   fakeKite{ltp: map[string]any{"NSE:INFY": map[string]any{"instrument_token": 408065, "last_price": 1500}}},
+			want:   RuleMaxOrderValue,
+		},
+		{
+			name:   "market order within limit at the last price",
+			policy: RiskPolicy{MaxOrderValue: 15000},
+			action: "place",
+			order:  withOrder(buy("INFY", "CNC", 10), func(o *orderRequest) { o.OrderType, o.Price = kiteconnect.OrderTypeMarket, 0 }),
+			kite:   fakeKite{ltp: map[string]any{"NSE:INFY": map[string]any{"instrument_token": 408065, "last_price": 1500}}},
+		},
+		{
+			name:   "stop-loss market order valued at the trigger when above the last price",
+			policy: RiskPolicy{MaxOrderValue: 15500},
+			action: "place",
+			order: withOrder(buy("INFY", "CNC", 10), func(o *orderRequest) {
+				o.OrderType, o.Price, o.TriggerPrice = kiteconnect.OrderTypeSLM, 0, 1600
+			}),
+			kite: fakeKite{ltp: map[string]any{"NSE:INFY": map[string]any{"instrument_token": 408065, "last_price": 1500}}},
+			want: RuleMaxOrderValue,
+		},
+		{
+			name:   "order value needs the last price",
+			policy: RiskPolicy{MaxOrderValue: 1e9},
+			action: "place",
+			order:  withOrder(buy("INFY", "CNC", 10), func(o *orderRequest) { o.OrderType, o.Price = kiteconnect.OrderTypeMarket, 0 }),
+			want:   RuleMaxOrderValue,
+		},
+
+		{name: "new MIS position after the cutoff", policy: RiskPolicy{MISCutoff: "15:00"}, afterCutoff: true, action: "place", order: buy("INFY", "MIS", 10), kite: flat, want: RuleMISCutoff},
+		{
+			name: "reducing an MIS position after the cutoff", policy: RiskPolicy{MISCutoff: "15:00"}, afterCutoff: true, action: "place", order: sell("INFY", "MIS", 10),
+			kite: fakeKite{positions: []map[string]any{position("INFY", "MIS", 10, 0)}, holdings: []map[string]any{}},
+		},
+		{
+			name: "reversing an MIS position after the cutoff", policy: RiskPolicy{MISCutoff: "15:00"}, afterCutoff: true, action: "place", order: sell("INFY", "MIS", 30),
+			kite: fakeKite{positions: []map[string]any{position("INFY", "MIS", 10, 0)}, holdings: []map[string]any{}},
+			want: RuleMISCutoff,
+		},
+		{
+			name: "a CNC position does not make MIS reduce-only", policy: RiskPolicy{MISCutoff: "15:00"}, afterCutoff: true, action: "place", order: sell("INFY", "MIS", 10),
+			kite: fakeKite{positions: []map[string]any{position("INFY", "CNC", 10, 0)}, holdings: []map[string]any{}},
+			want: RuleMISCutoff,
+		},
+		{name: "CNC after the MIS cutoff", policy: RiskPolicy{MISCutoff: "15:00"}, afterCutoff: true, action: "place", order: buy("INFY", "CNC", 10)},
+		{name: "MIS before the cutoff", policy: RiskPolicy{MISCutoff: "15:00"}, action: "place", order: buy("INFY", "MIS", 10)},
+
+		{name: "quantity within limit", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: buy("INFY", "CNC", 100), kite: flat},
+		{name: "quantity above limit", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: buy("INFY", "CNC", 101), kite: flat, want: RuleMaxQuantityPerSymbol},
+		{
+			name: "positions of every product and holdings with T1 count", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: buy("INFY", "MIS", 11),
+			kite: fakeKite{
+				positions: []map[string]any{position("INFY", "NRML", 20, 0), position("INFY", "MIS", 10, 0), position("TCS", "CNC", 500, 0)},
+				holdings:  []map[string]any{holding("INFY", 50, 10), holding("TCS", 500, 0)},
+			},
+			want: RuleMaxQuantityPerSymbol,
+		},
+		{
+			name: "the same holdings leave room for less", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: buy("INFY", "MIS", 10),
+			kite: fakeKite{
+				positions: []map[string]any{position("INFY", "NRML", 20, 0), position("INFY", "MIS", 10, 0)},
+				holdings:  []map[string]any{holding("INFY", 50, 10)},
+			},
+		},
+		{
+			name: "selling down a position above the limit", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: sell("INFY", "CNC", 50),
+			kite: fakeKite{positions: []map[string]any{}, holdings: []map[string]any{holding("INFY", 300, 0)}},
+		},
+		{
+			name: "adding to a short above the limit", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: sell("INFY", "NRML", 20),
+			kite: fakeKite{positions: []map[string]any{position("INFY", "NRML", -90, 0)}, holdings: []map[string]any{}},
+			want: RuleMaxQuantityPerSymbol,
+		},
+		{
+			name: "covering a short", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: buy("INFY", "NRML", 20),
+			kite: fakeKite{positions: []map[string]any{position("INFY", "NRML", -190, 0)}, holdings: []map[string]any{}},
+		},
+		{
+			name: "modify counts only the added quantity", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "modify", order: buy("INFY", "CNC", 60), replaced: 50,
+			kite: fakeKite{positions: []map[string]any{}, holdings: []map[string]any{holding("INFY", 45, 0)}},
+		},
+		{
+			name: "modify above the limit", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "modify", order: buy("INFY", "CNC", 60), replaced: 2,
+			kite: fakeKite{positions: []map[string]any{}, holdings: []map[string]any{holding("INFY", 45, 0)}},
+			want: RuleMaxQuantityPerSymbol,
+		},
+		{
+			name: "modify that lowers a pending buy", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "modify", order: buy("INFY", "CNC", 30), replaced: 50,
+			kite: fakeKite{positions: []map[string]any{}, holdings: []map[string]any{holding("INFY", 150, 0)}},
+		},
+		{name: "positions unavailable", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: buy("INFY", "CNC", 1), want: RuleMaxQuantityPerSymbol},
+		{
+			name: "holdings unavailable", policy: RiskPolicy{MaxQuantityPerSymbol: 100}, action: "place", order: buy("INFY", "CNC", 1),
+			kite: fakeKite{positions: []map[string]any{}},
+			want: RuleMaxQuantityPerSymbol,
+		},
+
+		{
+			name: "daily loss reached", policy: RiskPolicy{MaxDailyLoss: 5000}, action: "place", order: buy("INFY", "CNC", 1),
+			kite: fakeKite{positions: []map[string]any{position("TCS", "MIS", 10, -3000), position("SBIN", "MIS", -10, -2000)}, holdings: []map[string]any{}},
+			want: RuleMaxDailyLoss,
+		},
+		{
+			name: "daily loss below the limit", policy: RiskPolicy{MaxDailyLoss: 5000}, action: "place", order: buy("INFY", "CNC", 1),
+			kite: fakeKite{positions: []map[string]any{position("TCS", "MIS", 10, -3000), position("SBIN", "MIS", -10, -1999)}, holdings: []map[string]any{}},
+		},
+		{
+			name: "closing a position after the daily loss", policy: RiskPolicy{MaxDailyLoss: 5000}, action: "place", order: sell("TCS", "MIS", 10),
+			kite: fakeKite{positions: []map[string]any{position("TCS", "MIS", 10, -6000)}, holdings: []map[string]any{}},
+		},
+		{
+			name: "selling a holding after the daily loss", policy: RiskPolicy{MaxDailyLoss: 5000}, action: "place", order: sell("INFY", "CNC", 10),
+			kite: fakeKite{positions: []map[string]any{position("TCS", "MIS", 10, -6000)}, holdings: []map[string]any{holding("INFY", 10, 0)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRiskEngine(tt.policy)
+			if tt.afterCutoff {
+				r.cutoff = 0
+			} else if r.cutoff >= 0 {
+				r.cutoff = 24 * time.Hour
+			}
+
+			err := r.Check(newFakeKite(t, tt.kite), tt.action, tt.order, tt.replaced, false)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("got %v, want no violation", err)
+				}
+				return
+			}
+			var v *RiskViolation
+			if !errors.As(err, &v) || v.Rule != tt.want {
+				t.Fatalf("got %v, want a violation of %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRiskEngineRateLimit(t *testing.T) {
+	r := NewRiskEngine(RiskPolicy{MaxOrdersPerMinute: 2})
+	kc := newFakeKite(t, fakeKite{})
+	order := buy("INFY", "CNC", 1)
+
+	steps := []struct {
+		action string
+		commit bool
+		want   bool
+	}{
+		{"place", false, true},
+		{"place", true, true},
+		{"place", false, true},
+		{"cancel", true, true},
+		{"place", false, false},
+		{"cancel", false, false},
+	}
+	for i, step := range steps {
+		err := r.Check(kc, step.action, order, 0, step.commit)
+		var v *RiskViolation
+		if step.want && err != nil || !step.want && (!errors.As(err, &v) || v.Rule != RuleMaxOrdersPerMinute) {
+			t.Fatalf("step %d %s: got %v, want passing %v", i, step.action, err, step.want)
+		}
+	}
+
+	// Orders sent more than a minute ago no longer count
+	r.sent[0] = time.Now().Add(-time.Minute)
+	if err := r.Check(kc, "place", order, 0, false); err != nil {
+		t.Errorf("got %v after the oldest order aged out", err)
+	}
+}
+
+func TestRiskPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RiskPolicy
+		errs   int
+	}{
+		{name: "empty", policy: RiskPolicy{}},
+		{name: "complete", policy: RiskPolicy{MaxOrdersPerMinute: 10, AllowedProducts: []string{"cnc", "MIS"}, MISCutoff: "15:00", MaxDailyLoss: 1}},
+		{name: "negative limits", policy: RiskPolicy{MaxOrdersPerMinute: -1, MaxOrderValue: -1, MaxQuantityPerSymbol: -1, MaxDailyLoss: -1}, errs: 4},
+		{name: "unknown product", policy: RiskPolicy{AllowedProducts: []string{"CNC", "BO"}}, errs: 1},
+		{name: "bad cutoff", policy: RiskPolicy{MISCutoff: "3pm"}, errs: 1},
+	}
+	for _, tt := range tests {
+		if errs := tt.policy.validate(); len(errs) != tt.errs {
+			t.Errorf("%s: got %v, want %d errors", tt.name, errs, tt.errs)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+const (
+	// maxResultsArg is separate from the limit of the query options, which pages the candidates.
+	maxResultsArg      = "max_results"
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+var isinPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{9}[0-9]$`)
+
+var searchExchanges = map[string]bool{
+	"NSE": true, "BSE": true, "NFO": true, "BFO": true, "CDS": true, "BCD": true, "MCX": true,
+}
+
+// exchangeRank orders equal matches, so NSE listings come before BSE ones.
+var exchangeRank = map[string]int{
+	"NSE": 0, "BSE": 1, "NFO": 2, "BFO": 3, "MCX": 4, "CDS": 5, "BCD": 6,
+}
+
+var instrumentTypeWords = map[string]string{
+	"CE": "CE", "CALL": "CE", "CALLS": "CE",
+	"PE": "PE", "PUT": "PE", "PUTS": "PE",
+	"FUT": "FUT", "FUTURE": "FUT", "FUTURES": "FUT",
+	"EQ": "EQ", "EQUITY": "EQ", "STOCK": "EQ", "SHARE": "EQ", "SHARES": "EQ",
+}
+
+var monthWords = map[string]time.Month{
+	"JAN": time.January, "JANUARY": time.January,
+	"FEB": time.February, "FEBRUARY": time.February,
+	"MAR": time.March, "MARCH": time.March,
+	"APR": time.April, "APRIL": time.April,
+	"MAY": time.May,
+	"JUN": time.June, "JUNE": time.June,
+	"JUL": time.July, "JULY": time.July,
+	"AUG": time.August, "AUGUST": time.August,
+	"SEP": time.September, "SEPT": time.September, "SEPTEMBER": time.September,
+	"OCT": time.October, "OCTOBER": time.October,
+	"NOV": time.November, "NOVEMBER": time.November,
+	"DEC": time.December, "DECEMBER": time.December,
+}
+
+// searchQuery is a free text instrument query split into the name of the instrument and the
+// option shorthand around it, e.g. "nifty 24000 CE november".
+type searchQuery struct {
+	terms          []string
+	isin           string
+	exchange       string
+	instrumentType string
+	strike         float64
+	month          time.Month
+	year           int
+}
+
+func parseSearchQuery(text string) searchQuery {
+	words := strings.FieldsFunc(strings.ToUpper(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '&' && r != '-'
+	})
+
+	var q searchQuery
+	var strikeWord string
+	var strikeAt int
+	for i, word := range words {
+		if isinPattern.MatchString(word) {
+			q.isin = word
+			continue
+		}
+		if searchExchanges[word] && q.exchange == "" {
+			q.exchange = word
+			continue
+		}
+		if instrumentType, ok := instrumentTypeWords[word]; ok && q.instrumentType == "" {
+			q.instrumentType = instrumentType
+			continue
+		}
+		if month, ok := monthWords[word]; ok && q.month == 0 {
+			q.month = month
+			continue
+		}
+		if n, err := strconv.ParseFloat(word, 64); err == nil {
+			// A year only counts as one next to a month, "nifty nov 2026" and not a 2026 strike
+			nextToMonth := (i > 0 && monthWords[words[i-1]] != 0) || (i+1 < len(words) && monthWords[words[i+1]] != 0)
+			if n >= 2020 && n <= 2099 && n == float64(int(n)) && nextToMonth && q.year == 0 {
+				q.year = int(n)
+				continue
+			}
+			if q.strike == 0 {
+				q.strike, strikeWord, strikeAt = n, word, len(q.terms)
+				continue
+			}
+		}
+		q.terms = append(q.terms, word)
+	}
+
+	// A number is only a strike in option shorthand; otherwise it is part of the name, as in "nifty 50"
+	if q.strike != 0 && q.instrumentType != "CE" && q.instrumentType != "PE" && q.month == 0 {
+		q.terms = slices.Insert(q.terms, strikeAt, strikeWord)
+		q.strike = 0
+	}
+	return q
+}
+
+// InstrumentMatch is one candidate returned by search_instruments.
+type InstrumentMatch struct {
+	Instrument      string      `json:"instrument"`
+	InstrumentToken int         `json:"instrument_token"`
+	Exchange        string      `json:"exchange"`
+	Tradingsymbol   string      `json:"tradingsymbol"`
+	Name            string      `json:"name"`
+	InstrumentType  string      `json:"instrument_type"`
+	Segment         string      `json:"segment"`
+	Expiry          models.Time `json:"expiry"`
+	Strike          float64     `json:"strike"`
+	LotSize         float64     `json:"lot_size"`
+	TickSize        float64     `json:"tick_size"`
+	Score           int         `json:"score"`
+}
+
+// searchInstruments ranks the instrument master against a free text query and returns the best
+// matches. Derivatives must match every part of the option shorthand that was given.
+func searchInstruments(index *InstrumentIndex, text string, limit int) []InstrumentMatch {
+	q := parseSearchQuery(text)
+	phrase := strings.Join(q.terms, " ")
+	compact := strings.Join(q.terms, "")
+
+	var isinKey string
+	if q.isin != "" {
+		if instrument, ok := index.ByISIN(q.isin); ok {
+			isinKey = instrumentKey(instrument.Exchange, instrument.Tradingsymbol)
+		}
+	}
+
+	var matches []InstrumentMatch
+	for _, instrument := range index.Instruments {
+		if !q.accepts(instrument) {
+			continue
+		}
+
+		score := 0
+		if isinKey != "" && instrumentKey(instrument.Exchange, instrument.Tradingsymbol) == isinKey {
+			score = 200
+		}
+		if compact != "" {
+			nameScore := scoreName(instrument, phrase, compact, q.terms)
+			if nameScore == 0 && score == 0 {
+				continue
+			}
+			score += nameScore
+		} else if score == 0 && q.instrumentType == "" && q.strike == 0 && q.month == 0 {
+			continue
+		}
+		if q.instrumentType == "" && q.strike == 0 && q.month == 0 && instrument.InstrumentType == "EQ" {
+			// Plain names most often mean the stock rather than its derivatives
+			score += 5
+		}
+
+		matches = append(matches, InstrumentMatch{
+			Instrument:      instrument.Exchange + ":" + instrument.Tradingsymbol,
+			InstrumentToken: instrument.InstrumentToken,
+			Exchange:        instrument.Exchange,
+			Tradingsymbol:   instrument.Tradingsymbol,
+			Name:            instrument.Name,
+			InstrumentType:  instrument.InstrumentType,
+			Segment:         instrument.Segment,
+			Expiry:          instrument.Expiry,
+			Strike:          instrument.StrikePrice,
+			LotSize:         instrument.LotSize,
+			TickSize:        instrument.TickSize,
+			Score:           score,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.Expiry.Equal(b.Expiry.Time) {
+			// Nearest expiry first, with undated instruments such as stocks ahead of contracts
+			return a.Expiry.IsZero() || (!b.Expiry.IsZero() && a.Expiry.Before(b.Expiry.Time))
+		}
+		if exchangeRank[a.Exchange] != exchangeRank[b.Exchange] {
+			return exchangeRank[a.Exchange] < exchangeRank[b.Exchange]
+		}
+		if len(a.Tradingsymbol) != len(b.Tradingsymbol) {
+			return len(a.Tradingsymbol) < len(b.Tradingsymbol)
+		}
+		return a.Instrument < b.Instrument
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// accepts applies the exchange, instrument type, strike and expiry parts of the query.
+func (q searchQuery) accepts(instrument kiteconnect.Instrument) bool {
+	if q.exchange != "" && !strings.EqualFold(instrument.Exchange, q.exchange) {
+		return false
+	}
+	if q.instrumentType != "" && !strings.EqualFold(instrument.InstrumentType, q.instrumentType) {
+		return false
+	}
+	if q.strike != 0 && instrument.StrikePrice != q.strike {
+		return false
+	}
+	if q.month != 0 || q.year != 0 {
+		if instrument.Expiry.IsZero() {
+			return false
+		}
+		if q.month != 0 && instrument.Expiry.Month() != q.month {
+			return false
+		}
+		if q.year != 0 && instrument.Expiry.Year() != q.year {
+			return false
+		}
+	}
+	return true
+}
+
+// scoreName rates how well the trading symbol or name matches the words of the query, 0 for no match.
+func scoreName(instrument kiteconnect.Instrument, phrase, compact string, terms []string) int {
+	symbol := strings.ToUpper(instrument.Tradingsymbol)
+	name := strings.ToUpper(instrument.Name)
+
+	switch {
+	case symbol == compact:
+		return 100
+	case name == phrase || strings.ReplaceAll(name, " ", "") == compact:
+		return 90
+	case strings.HasPrefix(name, phrase+" "):
+		return 75
+	case strings.HasPrefix(symbol, compact):
+		return 70
+	}
+
+	matched := 0
+	for _, term := range terms {
+		if strings.Contains(name, term) || strings.Contains(symbol, term) {
+			matched++
+		}
+	}
+	if matched == len(terms) {
+		return 50
+	}
+	if len(compact) >= 4 && editDistance(symbol, compact) <= max(1, len(compact)/4) {
+		return 40
+	}
+	if matched > 0 && len(terms) > 1 {
+		return 10 * matched
+	}
+	return 0
+}
+
+// editDistance is the Levenshtein distance, used to forgive typos in a trading symbol.
+func editDistance(a, b string) int {
+	if a == b {
+		return 0
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func (z *ZerodhaMcpServer) SearchInstruments() server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		text, _ := request.Params.Arguments["query"].(string)
+		if strings.TrimSpace(text) == "" {
+			return mcp.NewToolResultError("query is required"), nil
+		}
+		limit, err := intArg(request.Params.Arguments, maxResultsArg)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if limit == 0 {
+			limit = defaultSearchLimit
+		}
+		limit = min(limit, maxSearchLimit)
+
+		index, err := z.instruments.Index(z.client(ctx))
+		if err != nil {
+			return nil, err
+		}
+		matches := searchInstruments(index, text, limit)
+
+		summary := fmt.Sprintf("No instruments match %q.", text)
+		if len(matches) > 0 {
+			summary = fmt.Sprintf("%s for %q, best match %s.", countSummary(len(matches), "candidate"), text, matches[0].Instrument)
+		}
+		return z.listResult(request, summary, matches)
+	}
+}
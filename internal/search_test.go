@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want searchQuery
+	}{
+		{"infy", searchQuery{terms: []string{"INFY"}}},
+		{"NSE tata consultancy", searchQuery{terms: []string{"TATA", "CONSULTANCY"}, exchange: "NSE"}},
+		{"nifty 25000 CE november", searchQuery{terms: []string{"NIFTY"}, instrumentType: "CE", strike: 25000, month: time.November}},
+		{"banknifty puts dec 2026 52000", searchQuery{terms: []string{"BANKNIFTY"}, instrumentType: "PE", strike: 52000, month: time.December, year: 2026}},
+		{"nifty 2026 oct", searchQuery{terms: []string{"NIFTY"}, month: time.October, year: 2026}},
+		{"nifty 2026 call", searchQuery{terms: []string{"NIFTY"}, instrumentType: "CE", strike: 2026}},
+		{"nifty 24500.5 pe 25000", searchQuery{terms: []string{"NIFTY", "25000"}, instrumentType: "PE", strike: 24500.5}},
+		{"nifty 50", searchQuery{terms: []string{"NIFTY", "50"}}},
+		{"nifty next 50 fut", searchQuery{terms: []string{"NIFTY", "NEXT", "50"}, instrumentType: "FUT"}},
+		{"ine009a01021", searchQuery{isin: "INE009A01021"}},
+		{"m&m futures", searchQuery{terms: []string{"M&M"}, instrumentType: "FUT"}},
+		{"bajaj-auto, share", searchQuery{terms: []string{"BAJAJ-AUTO"}, instrumentType: "EQ"}},
+		{"nse bse infy", searchQuery{terms: []string{"BSE", "INFY"}, exchange: "NSE"}},
+	}
+	for _, tt := range tests {
+		got := parseSearchQuery(tt.text)
+		if strings.Join(got.terms, " ") != strings.Join(tt.want.terms, " ") || got.isin != tt.want.isin || got.exchange != tt.want.exchange ||
+			got.instrumentType != tt.want.instrumentType || got.strike != tt.want.strike || got.month != tt.want.month || got.year != tt.want.year {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchInstruments(t *testing.T) {
+	store := newTestInstrumentStore(testInstruments)
+	store.LearnISINs(kiteconnect.Holdings{{ISIN: "INE009A01021", Exchange: "NSE", Tradingsymbol: "INFY"}})
+	index := store.index
+
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		// The stock comes first, NSE before BSE
+		{"infy", 10, "NSE:INFY BSE:INFY"},
+		{"infosys", 10, "NSE:INFY BSE:INFY"},
+		{"bse infy", 10, "BSE:INFY"},
+		{"infyy", 10, "NSE:INFY BSE:INFY"},
+		{"tata consultancy", 10, "NSE:TCS"},
+		{"consultancy tata", 10, "NSE:TCS"},
+		{"INE009A01021", 10, "NSE:INFY"},
+		{"nifty 50", 1, "NSE:NIFTY 50"},
+		// Without an option type or expiry a number is matched as part of the name, so contracts by nearest expiry
+		{"nifty 25000", 3, "NFO:NIFTY26OCT25000CE NFO:NIFTY26OCT25000PE NFO:NIFTY26NOV25000CE"},
+		{"nifty fut", 10, "NFO:NIFTY26OCTFUT"},
+		{"nifty 25000 ce", 10, "NFO:NIFTY26OCT25000CE NFO:NIFTY26NOV25000CE"},
+		{"nifty nov call", 10, "NFO:NIFTY26NOV25000CE"},
+		{"nifty put october 2026", 10, "NFO:NIFTY26OCT25000PE"},
+		{"nifty put october 2027", 10, ""},
+		{"nifty 24000 ce", 10, ""},
+		{"calls", 10, "NFO:NIFTY26OCT25000CE NFO:NIFTY26NOV25000CE"},
+		{"wipro", 10, ""},
+	}
+	for _, tt := range tests {
+		matches := searchInstruments(index, tt.text, tt.limit)
+		got := make([]string, len(matches))
+		for i, match := range matches {
+			got[i] = match.Instrument
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("searchInstruments(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"INFY", "INFY", 0},
+		{"INFY", "", 4},
+		{"", "TCS", 3},
+		{"INFY", "INFYY", 1},
+		{"RELIANCE", "RELAINCE", 2},
+		{"HDFCBANK", "HDFCBNK", 1},
+		{"SBIN", "SBI", 1},
+		{"TCS", "WIPRO", 5},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
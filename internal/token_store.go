@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+const (
+	tokenStoreDir  = "zerodha-mcp"
+	tokenStoreFile = "token.json"
+
+	// Kite invalidates every access token at 6 AM IST the day after it was issued.
+	tokenExpiryHour = 6
+)
+
+var istLocation = time.FixedZone("IST", 5*60*60+30*60)
+
+// StoredToken is the subset of a Kite session that is persisted between restarts.
+type StoredToken struct {
+	APIKey      string    `json:"api_key"`
+	AccessToken string    `json:"access_token"`
+	UserID      string    `json:"user_id"`
+	LoginTime   time.Time `json:"login_time"`
+}
+
+// NewStoredToken builds a StoredToken from a freshly generated Kite session.
+// Kite reports login_time in IST without a zone, so the local clock is used instead.
+func NewStoredToken(apiKey string, session kiteconnect.UserSession) StoredToken {
+	return StoredToken{
+		APIKey:      apiKey,
+		AccessToken: session.AccessToken,
+		UserID:      session.UserID,
+		LoginTime:   time.Now(),
+	}
+}
+
+// ExpiresAt returns the next 6 AM IST after the login time.
+func (t StoredToken) ExpiresAt() time.Time {
+	login := t.LoginTime.In(istLocation)
+	expiry := time.Date(login.Year(), login.Month(), login.Day(), tokenExpiryHour, 0, 0, 0, istLocation)
+	if !expiry.After(login) {
+		expiry = expiry.AddDate(0, 0, 1)
+	}
+	return expiry
+}
+
+// IsExpired reports whether Kite has already invalidated the token at the given time.
+func (t StoredToken) IsExpired(now time.Time) bool {
+	return t.AccessToken == "" || !now.Before(t.ExpiresAt())
+}
+
+// TokenStore saves and loads the Kite access token from a file readable only by the current user.
+type TokenStore struct {
+	path string
+}
+
+func NewTokenStore(path string) *TokenStore {
+	return &TokenStore{
+		path: path,
+	}
+}
+
+// DefaultTokenStorePath returns the token file location under the user config dir.
+func DefaultTokenStorePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, tokenStoreDir, tokenStoreFile), nil
+}
+
+func (s *TokenStore) Path() string {
+	return s.path
+}
+
+// Load returns the stored token. A missing file is reported as os.ErrNotExist.
+func (s *TokenStore) Load() (StoredToken, error) {
+	var token StoredToken
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return token, err
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return token, fmt.Errorf("parse token store %s: %w", s.path, err)
+	}
+	return token, nil
+}
+
+// Save writes the token atomically with 0600 permissions.
+func (s *TokenStore) Save(token StoredToken) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), tokenStoreFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Clear removes the stored token, ignoring a file that is already gone.
+func (s *TokenStore) Clear() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func istTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	at, err := time.ParseInLocation("2006-01-02 15:04:05", value, istLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
+
+func TestStoredTokenExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		login  time.Time
+		expiry string
+	}{
+		{name: "evening login expires the next morning", login: istTime(t, "2026-10-15 21:30:00"), expiry: "2026-10-16 06:00:00"},
+		{name: "login during the session", login: istTime(t, "2026-10-16 09:05:00"), expiry: "2026-10-17 06:00:00"},
+		{name: "login just before 6 AM", login: istTime(t, "2026-10-16 05:59:59"), expiry: "2026-10-16 06:00:00"},
+		{name: "login at 6 AM", login: istTime(t, "2026-10-16 06:00:00"), expiry: "2026-10-17 06:00:00"},
+		{name: "login recorded in another zone", login: istTime(t, "2026-10-16 01:00:00").UTC(), expiry: "2026-10-16 06:00:00"},
+		{name: "month end", login: istTime(t, "2026-10-31 18:00:00"), expiry: "2026-11-01 06:00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := StoredToken{AccessToken: "token", LoginTime: tt.login}
+			expiry := istTime(t, tt.expiry)
+			if got := token.ExpiresAt(); !got.Equal(expiry) {
+				t.Fatalf("expires at %s, want %s", got.In(istLocation), expiry)
+			}
+			if token.IsExpired(expiry.Add(-time.Second)) {
+				t.Error("expired a second before 6 AM")
+			}
+			if !token.IsExpired(expiry) {
+				t.Error("still valid at 6 AM")
+			}
+		})
+	}
+}
+
+func TestStoredTokenWithoutAccessToken(t *testing.T) {
+	token := StoredToken{LoginTime: time.Now()}
+	if !token.IsExpired(time.Now()) {
+		t.Error("a token without an access token is valid")
+	}
+}
+
+func TestTokenStore(t *testing.T) {
+	store := NewTokenStore(filepath.Join(t.TempDir(), "zerodha-mcp", tokenStoreFile))
+	if _, err := store.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading a missing store: got %v, want %v", err, os.ErrNotExist)
+	}
+
+	want := StoredToken{APIKey: "key", AccessToken: "token", UserID: "AB1234", LoginTime: istTime(t, "2026-10-16 09:05:00")}
+	if err := store.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("token file has mode %o, want 600", perm)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.APIKey != want.APIKey || got.AccessToken != want.AccessToken || got.UserID != want.UserID || !got.LoginTime.Equal(want.LoginTime) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+
+	if err := store.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Clear(); err != nil {
+		t.Errorf("clearing twice: %v", err)
+	}
+}
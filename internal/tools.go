@@ -3,8 +3,6 @@ package internal
 import (
 	"context"
 	"fmt"
-	"reflect"
-	"strconv"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -12,101 +10,122 @@ import (
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 )
 
-const (
-	timeLayout = "2006-01-02 15:04:05"
-)
-
 type ZerodhaMcpServer struct {
-	kc *kiteconnect.Client
+	accounts       []*Account
+	defaultAccount *Account
+
+	instruments   *InstrumentStore
+	candles       *CandleStore
+	confirmations *Confirmations
+	risk          *RiskEngine
+
+	authTimeout    time.Duration
+	headless       bool
+	readOnly       bool
+	responseBudget int
 }
 
-func NewZerodhaMcpServer(kc *kiteconnect.Client) *ZerodhaMcpServer {
-	return &ZerodhaMcpServer{
-		kc: kc,
+func NewZerodhaMcpServer(cfg Config) *ZerodhaMcpServer {
+	z := &ZerodhaMcpServer{
+		instruments:    NewInstrumentStore(cfg.InstrumentCachePath),
+		candles:        NewCandleStore(cfg.CandleCacheDir),
+		confirmations:  NewConfirmations(),
+		risk:           NewRiskEngine(cfg.Risk),
+		authTimeout:    cfg.AuthTimeout,
+		headless:       cfg.Headless,
+		readOnly:       cfg.ReadOnly,
+		responseBudget: cfg.ResponseBudget,
 	}
-}
-
-func (z *ZerodhaMcpServer) SetKc(kc *kiteconnect.Client) {
-	z.kc = kc
-}
-
-func printStruct(s interface{}) string {
-	val := reflect.ValueOf(s)
-	typ := reflect.TypeOf(s)
-
-	if val.Kind() == reflect.Ptr {
-		val = val.Elem()
-		typ = typ.Elem()
+	for _, accountCfg := range cfg.AccountConfigs() {
+		account := NewAccount(accountCfg)
+		z.accounts = append(z.accounts, account)
+		if account.Name == cfg.DefaultAccount {
+			z.defaultAccount = account
+		}
 	}
-
-	returnVal := "<start> "
-
-	for i := 0; i < val.NumField(); i++ {
-		field := val.Field(i)
-		fieldName := typ.Field(i).Name
-		returnVal += fmt.Sprintf("%s: %v, ", fieldName, field.Interface())
+	if z.defaultAccount == nil {
+		z.defaultAccount = z.accounts[0]
 	}
-	returnVal += " <end>"
+	return z
+}
 
-	return returnVal
+func countSummary(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
 }
 
-func getHoldingText(holding kiteconnect.Holding) string {
-	holdingTemplate := "Holding: Tradingsymbol: %s, Exchange: %s, InstrumentToken %d, ISIN %s, Product %s, Price %.2f, UsedQuantity %d, Quantity %d, T1Quantity %d, RealisedQuantity %d, Average Price %.2f, Last Price %.2f, Close Price %.2f, PnL %.2f, DayChange %.2f, DayChangePercentage %.2f, Buy Value: %.2f, Current Total Value: %.2f, MTFHolding: %x"
-	return fmt.Sprintf(holdingTemplate, holding.Tradingsymbol, holding.Exchange, holding.InstrumentToken, holding.ISIN, holding.Product, holding.Price, holding.UsedQuantity, holding.Quantity, holding.T1Quantity, holding.RealisedQuantity, holding.AveragePrice, holding.LastPrice, holding.ClosePrice, holding.PnL, holding.DayChange, holding.DayChangePercentage, holding.AveragePrice*float64(holding.Quantity), holding.LastPrice*float64(holding.Quantity), holding.MTF)
+func holdingsSummary(holdings kiteconnect.Holdings) string {
+	var invested, current, pnl float64
+	for _, holding := range holdings {
+		invested += holding.AveragePrice * float64(holding.Quantity)
+		current += holding.LastPrice * float64(holding.Quantity)
+		pnl += holding.PnL
+	}
+	return fmt.Sprintf("%s, invested %.2f, current value %.2f, P&L %.2f.", countSummary(len(holdings), "holding"), invested, current, pnl)
 }
 
 func (z *ZerodhaMcpServer) KiteHoldingsTool() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		holdings, err := z.kc.GetHoldings()
+		if isAllAccounts(request) {
+			holdings, skipped, err := z.aggregateHoldings()
+			if err != nil {
+				return nil, err
+			}
+			return z.formattedResult(request, aggregateSummary(len(holdings), "holding", skipped), aggregateResult[AggregatedHolding]{Rows: holdings, SkippedAccounts: skipped}, holdings)
+		}
+
+		holdings, err := z.client(ctx).GetHoldings()
 		if err != nil {
 			return nil, err
 		}
-		holdingsText := ""
-		for _, holding := range holdings {
-			eachHolding := getHoldingText(holding)
-			holdingsText += eachHolding + "\n"
-		}
-
-		return mcp.NewToolResultText(holdingsText), nil
+		z.instruments.LearnISINs(holdings)
+		return z.listResult(request, holdingsSummary(holdings), holdings)
 	}
 }
 
 func (z *ZerodhaMcpServer) AuctionInstrumentsTool() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		auctionInstruments, err := z.kc.GetAuctionInstruments()
+		auctionInstruments, err := z.client(ctx).GetAuctionInstruments()
 		if err != nil {
 			return nil, err
 		}
-		auctionInstrumentsText := ""
-		for _, auctionInstrument := range auctionInstruments {
-			eachAuctionInstrument := printStruct(auctionInstrument)
-			auctionInstrumentsText += eachAuctionInstrument + "\n"
-		}
-
-		return mcp.NewToolResultText(auctionInstrumentsText), nil
+		return z.listResult(request, countSummary(len(auctionInstruments), "auction instrument")+".", auctionInstruments)
 	}
 }
 
+// positionRow is a day or net position in a positions table.
+type positionRow struct {
+	Type string `json:"type"`
+	kiteconnect.Position
+}
+
 func (z *ZerodhaMcpServer) Positions() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		positions, err := z.kc.GetPositions()
+		if isAllAccounts(request) {
+			positions, skipped, err := z.aggregatePositions()
+			if err != nil {
+				return nil, err
+			}
+			return z.formattedResult(request, aggregateSummary(len(positions), "net position", skipped), aggregateResult[AggregatedPosition]{Rows: positions, SkippedAccounts: skipped}, positions)
+		}
+
+		positions, err := z.client(ctx).GetPositions()
 		if err != nil {
 			return nil, err
 		}
-		dayPositions := "DAY POSITIONS --- "
-		for _, eachPosition := range positions.Day {
-			eachPositionText := printStruct(eachPosition)
-			dayPositions += eachPositionText + "\n"
-		}
-		netPositions := "NET POSITIONS --- "
+		var pnl float64
+		rows := make([]positionRow, 0, len(positions.Net)+len(positions.Day))
 		for _, position := range positions.Net {
-			eachPosition := printStruct(position)
-			netPositions += eachPosition + "\n"
+			pnl += position.PnL
+			rows = append(rows, positionRow{Type: "net", Position: position})
 		}
-
-		positionsText := dayPositions + " \n \n " + netPositions
-		return mcp.NewToolResultText(positionsText), nil
+		for _, position := range positions.Day {
+			rows = append(rows, positionRow{Type: "day", Position: position})
+		}
+		summary := fmt.Sprintf("%s, %s, net P&L %.2f.", countSummary(len(positions.Net), "net position"), countSummary(len(positions.Day), "day position"), pnl)
+		return z.formattedResult(request, summary, positions, rows)
 	}
 }
 
@@ -124,7 +143,7 @@ func (z *ZerodhaMcpServer) OrderMargins() server.ToolHandlerFunc {
 		price := request.Params.Arguments["price"].(float64)
 		triggerPrice := request.Params.Arguments["triggerPrice"].(float64)
 
-		orderMargins, err := z.kc.GetOrderMargins(kiteconnect.GetMarginParams{
+		orderMargins, err := z.client(ctx).GetOrderMargins(kiteconnect.GetMarginParams{
 			OrderParams: []kiteconnect.OrderMarginParam{
 				{
 					Exchange:        exchange,
@@ -143,267 +162,158 @@ func (z *ZerodhaMcpServer) OrderMargins() server.ToolHandlerFunc {
 			return nil, err
 		}
 
-		orderMarginsText := ""
-		for _, orderMargin := range orderMargins {
-			eachOrderMargin := printStruct(orderMargin)
-			orderMarginsText += eachOrderMargin + "\n"
-		}
-		return mcp.NewToolResultText(orderMarginsText), nil
-	}
-}
-
-func (z *ZerodhaMcpServer) Quote() server.ToolHandlerFunc {
-	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		instrument := request.Params.Arguments["instrument"].(string)
-		quote, err := z.kc.GetQuote(instrument)
-		if err != nil {
-			return nil, err
-		}
-		quoteStr := printStruct(quote)
-		return mcp.NewToolResultText(quoteStr), nil
-	}
-}
-
-func (z *ZerodhaMcpServer) LTP() server.ToolHandlerFunc {
-	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		instrumentInterface, ok := request.Params.Arguments["instrument"]
-		if !ok || instrumentInterface == nil {
-			return nil, fmt.Errorf("instrument parameter is required")
-		}
-
-		instrument, ok := instrumentInterface.(string)
-		if !ok {
-			return nil, fmt.Errorf("instrument must be a string")
-		}
-
-		ltp, err := z.kc.GetLTP(instrument)
-		if err != nil {
-			return nil, err
-		}
-		ltpStr := printStruct(ltp)
-		return mcp.NewToolResultText(ltpStr), nil
-	}
-}
-
-func (z *ZerodhaMcpServer) OHLC() server.ToolHandlerFunc {
-	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		instrument := request.Params.Arguments["instrument"].(string)
-		ohlc, err := z.kc.GetOHLC(instrument)
-		if err != nil {
-			return nil, err
-		}
-		ohlcStr := printStruct(ohlc)
-		return mcp.NewToolResultText(ohlcStr), nil
-	}
-}
-
-func (z *ZerodhaMcpServer) HistoricalData() server.ToolHandlerFunc {
-	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		instrumentToken := request.Params.Arguments["instrumentToken"].(int)
-		interval := request.Params.Arguments["interval"].(string)
-		fromDateStr := request.Params.Arguments["fromDate"].(string)
-		toDateStr := request.Params.Arguments["toDate"].(string)
-		continuousStr := request.Params.Arguments["continuous"].(string)
-		oiStr := request.Params.Arguments["oi"].(string)
-
-		fromDate, err := time.Parse(timeLayout, fromDateStr)
-		if err != nil {
-			return nil, err
-		}
-
-		toDate, err := time.Parse(timeLayout, toDateStr)
-		if err != nil {
-			return nil, err
-		}
-
-		continuous, err := strconv.ParseBool(continuousStr)
-		if err != nil {
-			return nil, err
-		}
-
-		oi, err := strconv.ParseBool(oiStr)
-		if err != nil {
-			return nil, err
-		}
-
-		historicalData, err := z.kc.GetHistoricalData(instrumentToken, interval, fromDate, toDate, continuous, oi)
-		if err != nil {
-			return nil, err
-		}
-
-		historicalDataStr := ""
-		for _, candle := range historicalData {
-			eachCandle := printStruct(candle)
-			historicalDataStr += eachCandle + "\n"
-		}
-		return mcp.NewToolResultText(historicalDataStr), nil
+		return z.listResult(request, countSummary(len(orderMargins), "order margin")+".", orderMargins)
 	}
 }
 
 func (z *ZerodhaMcpServer) Instruments() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		instruments, err := z.kc.GetInstruments()
+		index, err := z.instruments.Index(z.client(ctx))
 		if err != nil {
 			return nil, err
 		}
-		instrumentsText := ""
-		for _, instrument := range instruments {
-			eachInstrument := printStruct(instrument)
-			instrumentsText += eachInstrument + "\n"
-		}
-		return mcp.NewToolResultText(instrumentsText), nil
+		return z.listResult(request, countSummary(len(index.Instruments), "instrument")+".", index.Instruments)
 	}
 }
 
 func (z *ZerodhaMcpServer) InstrumentsByExchange() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		exchange := request.Params.Arguments["exchange"].(string)
-		instruments, err := z.kc.GetInstrumentsByExchange(exchange)
+		index, err := z.instruments.Index(z.client(ctx))
 		if err != nil {
 			return nil, err
 		}
-		instrumentsText := ""
-		for _, instrument := range instruments {
-			eachInstrument := printStruct(instrument)
-			instrumentsText += eachInstrument + "\n"
-		}
-		return mcp.NewToolResultText(instrumentsText), nil
+		instruments := index.Exchange(exchange)
+		return z.listResult(request, countSummary(len(instruments), "instrument")+".", instruments)
 	}
 }
 
 func (z *ZerodhaMcpServer) MFInstruments() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		instruments, err := z.kc.GetMFInstruments()
+		instruments, err := z.client(ctx).GetMFInstruments()
 		if err != nil {
 			return nil, err
 		}
-		instrumentsText := ""
-		for _, instrument := range instruments {
-			eachInstrument := printStruct(instrument)
-			instrumentsText += eachInstrument + "\n"
-		}
-		return mcp.NewToolResultText(instrumentsText), nil
+		return z.listResult(request, countSummary(len(instruments), "mutual fund instrument")+".", instruments)
 	}
 }
 
 func (z *ZerodhaMcpServer) MFOrders() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		mfOrders, err := z.kc.GetMFOrders()
+		mfOrders, err := z.client(ctx).GetMFOrders()
 		if err != nil {
 			return nil, err
 		}
-		mfOrdersText := ""
-		for _, order := range mfOrders {
-			eachOrder := printStruct(order)
-			mfOrdersText += eachOrder + "\n"
-		}
-		return mcp.NewToolResultText(mfOrdersText), nil
+		return z.listResult(request, countSummary(len(mfOrders), "mutual fund order")+".", mfOrders)
 	}
 }
 
 func (z *ZerodhaMcpServer) MFOrderInfo() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		orderId := request.Params.Arguments["orderId"].(string)
-		mfOrderInfo, err := z.kc.GetMFOrderInfo(orderId)
+		mfOrderInfo, err := z.client(ctx).GetMFOrderInfo(orderId)
 		if err != nil {
 			return nil, err
 		}
-		mfOrderInfoStr := printStruct(mfOrderInfo)
-		return mcp.NewToolResultText(mfOrderInfoStr), nil
+		return jsonResult(fmt.Sprintf("Mutual fund order %s is %s.", mfOrderInfo.OrderID, mfOrderInfo.Status), mfOrderInfo)
 	}
 }
 
 func (z *ZerodhaMcpServer) MfSipInfo() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		sipId := request.Params.Arguments["sipId"].(string)
-		mfSipInfo, err := z.kc.GetMFSIPInfo(sipId)
+		mfSipInfo, err := z.client(ctx).GetMFSIPInfo(sipId)
 		if err != nil {
 			return nil, err
 		}
-		mfSipInfoStr := printStruct(mfSipInfo)
-		return mcp.NewToolResultText(mfSipInfoStr), nil
+		return jsonResult(fmt.Sprintf("SIP %s for %s is %s.", mfSipInfo.ID, mfSipInfo.Tradingsymbol, mfSipInfo.Status), mfSipInfo)
 	}
 }
 
 func (z *ZerodhaMcpServer) MFHoldings() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		holdings, err := z.kc.GetMFHoldings()
+		holdings, err := z.client(ctx).GetMFHoldings()
 		if err != nil {
 			return nil, err
 		}
-		holdingsText := ""
-		for _, holding := range holdings {
-			eachHolding := printStruct(holding)
-			holdingsText += eachHolding + "\n"
-		}
-		return mcp.NewToolResultText(holdingsText), nil
+		return z.listResult(request, countSummary(len(holdings), "mutual fund holding")+".", holdings)
 	}
 }
 
 func (z *ZerodhaMcpServer) MFHoldingInfo() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		isin := request.Params.Arguments["isin"].(string)
-		holdingInfo, err := z.kc.GetMFHoldingInfo(isin)
+		holdingInfo, err := z.client(ctx).GetMFHoldingInfo(isin)
 		if err != nil {
 			return nil, err
 		}
-		holdingInfoStr := printStruct(holdingInfo)
-		return mcp.NewToolResultText(holdingInfoStr), nil
+		return z.listResult(request, fmt.Sprintf("%s in the mutual fund holding.", countSummary(len(holdingInfo), "trade")), holdingInfo)
 	}
 }
 
 func (z *ZerodhaMcpServer) MFAllottedISINs() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		allottedISINs, err := z.kc.GetMFAllottedISINs()
+		allottedISINs, err := z.client(ctx).GetMFAllottedISINs()
 		if err != nil {
 			return nil, err
 		}
-		allottedISINsText := fmt.Sprintf("%s", allottedISINs)
-		return mcp.NewToolResultText(allottedISINsText), nil
+		return z.listResult(request, countSummary(len(allottedISINs), "allotted ISIN")+".", allottedISINs)
 	}
 }
 
 func (z *ZerodhaMcpServer) UserProfile() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		userProfile, err := z.kc.GetUserProfile()
+		userProfile, err := z.client(ctx).GetUserProfile()
 		if err != nil {
 			return nil, err
 		}
-		userProfileStr := printStruct(userProfile)
-		return mcp.NewToolResultText(userProfileStr), nil
+		return jsonResult(fmt.Sprintf("Profile of %s (%s).", userProfile.UserName, userProfile.UserID), userProfile)
 	}
 }
 
 func (z *ZerodhaMcpServer) FullUserProfile() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		userProfile, err := z.kc.GetFullUserProfile()
+		userProfile, err := z.client(ctx).GetFullUserProfile()
 		if err != nil {
 			return nil, err
 		}
-		userProfileStr := printStruct(userProfile)
-		return mcp.NewToolResultText(userProfileStr), nil
+		return jsonResult(fmt.Sprintf("Profile of %s (%s).", userProfile.UserName, userProfile.UserID), userProfile)
 	}
 }
 
+// marginRow is one segment in a margins table.
+type marginRow struct {
+	Segment string `json:"segment"`
+	kiteconnect.Margins
+}
+
 func (z *ZerodhaMcpServer) UserMargins() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		userMargins, err := z.kc.GetUserMargins()
+		if isAllAccounts(request) {
+			margins, skipped, err := z.aggregateMargins()
+			if err != nil {
+				return nil, err
+			}
+			return z.formattedResult(request, aggregateSummary(len(margins), "margin segment", skipped), aggregateResult[AggregatedMargins]{Rows: margins, SkippedAccounts: skipped}, margins)
+		}
+
+		userMargins, err := z.client(ctx).GetUserMargins()
 		if err != nil {
 			return nil, err
 		}
-		userMarginsText := printStruct(userMargins)
-		return mcp.NewToolResultText(userMarginsText), nil
+		rows := []marginRow{{Segment: "equity", Margins: userMargins.Equity}, {Segment: "commodity", Margins: userMargins.Commodity}}
+		summary := fmt.Sprintf("Equity net margin %.2f, commodity net margin %.2f.", userMargins.Equity.Net, userMargins.Commodity.Net)
+		return z.formattedResult(request, summary, userMargins, rows)
 	}
 }
 
 func (z *ZerodhaMcpServer) UserSegmentMargins() server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		segment := request.Params.Arguments["segment"].(string)
-		userSegmentMargins, err := z.kc.GetUserSegmentMargins(segment)
+		userSegmentMargins, err := z.client(ctx).GetUserSegmentMargins(segment)
 		if err != nil {
 			return nil, err
 		}
-		userSegmentMarginsText := printStruct(userSegmentMargins)
-		return mcp.NewToolResultText(userSegmentMarginsText), nil
+		return jsonResult(fmt.Sprintf("Net margin %.2f, available cash %.2f.", userSegmentMargins.Net, userSegmentMargins.Available.Cash), userSegmentMargins)
 	}
 }
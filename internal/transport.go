@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	TransportStdio = "stdio"
+	TransportSSE   = "sse"
+
+	// minBearerTokenLength keeps the SSE endpoint from being guarded by a guessable token.
+	minBearerTokenLength = 16
+)
+
+// ServeSSE serves the MCP server over SSE on its own listener until ctx is cancelled.
+// Every request must carry the configured bearer token.
+func ServeSSE(ctx context.Context, s *server.MCPServer, cfg Config) error {
+	srv := &http.Server{
+		Addr:              cfg.HTTPAddr,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	sseServer := server.NewSSEServer(s,
+		server.WithBaseURL(cfg.HTTPBaseURL()),
+		server.WithHTTPServer(srv),
+		server.WithKeepAlive(true),
+	)
+	srv.Handler = RequireBearerToken(cfg.BearerToken, sseServer)
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := sseServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("SSE server shutdown error", "error", err)
+		}
+	}()
+
+	slog.Info("Serving MCP over SSE", "sse_endpoint", sseServer.CompleteSseEndpoint())
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// RequireBearerToken rejects requests whose Authorization header does not carry the token.
+func RequireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zerodha-mcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
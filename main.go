@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,49 +22,64 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/sukeesh/zerodha-mcp/internal"
-	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 )
 
-var (
-	requestToken    = ""
-	isAuthenticated = false
-	z               *internal.ZerodhaMcpServer
-
-	// Command line flags
-	apiKey    string
-	apiSecret string
-)
+func renderHTMLResponse(c *gin.Context, content string, status int) {
+	html := internal.RenderHTMLResponse(content)
+	c.Data(status, "text/html; charset=utf-8", []byte(html))
+}
 
-func setEnvs() {
-	eApiKey := os.Getenv("ZERODHA_API_KEY")
-	eApiSecret := os.Getenv("ZERODHA_API_SECRET")
+// authCallback exchanges the request token of the Kite redirect, once, for the login attempt
+// whose state it carries.
+func authCallback(z *internal.ZerodhaMcpServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		slog.Debug("Request received on auth request")
+		// The callback endpoint is closed unless a login attempt is pending
+		if !z.LoginPending() {
+			renderHTMLResponse(c, internal.ErrorContentTemplate, http.StatusGone)
+			return
+		}
 
-	// Validate required flags
-	if eApiKey == "" || eApiSecret == "" {
-		fmt.Println("Error: apikey and apisecret flags are required")
-		fmt.Println("Usage example: ./zerodha-mcp -apikey=YOUR_API_KEY -apisecret=YOUR_API_SECRET")
-		os.Exit(1)
-	}
+		paramRequestToken := c.Query("request_token")
+		if paramRequestToken == "" {
+			// Render error template
+			renderHTMLResponse(c, internal.ErrorContentTemplate, http.StatusBadRequest)
+			return
+		}
 
-	apiKey = eApiKey
-	apiSecret = eApiSecret
-}
+		if err := z.CompleteLogin(paramRequestToken, c.Query("state")); err != nil {
+			slog.Warn("Rejected auth callback", "error", err)
+			status := http.StatusBadRequest
+			if errors.Is(err, internal.ErrLoginStateInvalid) {
+				status = http.StatusForbidden
+			} else if errors.Is(err, internal.ErrNoLoginPending) {
+				status = http.StatusGone
+			}
+			// Render error template
+			renderHTMLResponse(c, internal.ErrorContentTemplate, status)
+			return
+		}
 
-func renderHTMLResponse(c *gin.Context, content string, status int) {
-	html := internal.RenderHTMLResponse(content)
-	c.Data(status, "text/html; charset=utf-8", []byte(html))
+		slog.Info("Zerodha authentication successful")
+		// Render success template
+		renderHTMLResponse(c, internal.SuccessContentTemplate, http.StatusOK)
+	}
 }
 
-func startRouter() (*http.Server, func()) {
+func startRouter(cfg internal.Config, z *internal.ZerodhaMcpServer) (*http.Server, func()) {
 	gin.DefaultWriter = os.Stderr
 	gin.DefaultErrorWriter = os.Stderr
 
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
 	// use a fresh Engine so we don't get the default stdout logger
 	r := gin.New()
-	r.Use(
-		gin.LoggerWithWriter(os.Stderr),
-		gin.RecoveryWithWriter(os.Stderr),
-	)
+	r.Use(gin.RecoveryWithWriter(os.Stderr))
+	if gin.IsDebugging() {
+		r.Use(gin.LoggerWithWriter(os.Stderr))
+	}
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -67,28 +87,10 @@ func startRouter() (*http.Server, func()) {
 		})
 	})
 
-	r.GET("/auth", func(c *gin.Context) {
-		fmt.Fprintln(os.Stderr, "Request received on auth request")
-		paramRequestToken := c.Query("request_token")
-		if paramRequestToken == "" {
-			// Render error template
-			renderHTMLResponse(c, internal.ErrorContentTemplate, http.StatusBadRequest)
-			return
-		}
-
-		requestToken = paramRequestToken
-		if requestToken != "" {
-			isAuthenticated = true
-			// Render success template
-			renderHTMLResponse(c, internal.SuccessContentTemplate, http.StatusOK)
-		} else {
-			// Render error template
-			renderHTMLResponse(c, internal.ErrorContentTemplate, http.StatusBadRequest)
-		}
-	})
+	r.GET(cfg.RedirectPath, authCallback(z))
 
 	srv := &http.Server{
-		Addr:    ":5888",
+		Addr:    net.JoinHostPort(cfg.ListenHost, strconv.Itoa(cfg.ListenPort)),
 		Handler: r,
 	}
 
@@ -98,72 +100,312 @@ func startRouter() (*http.Server, func()) {
 		defer cancel()
 
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server shutdown error: %v", err)
+			slog.Error("HTTP server shutdown error", "error", err)
 		}
-		log.Println("HTTP server stopped")
+		slog.Info("HTTP server stopped")
 	}
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("listen: %s\n", err)
+			slog.Error("Unable to start the login callback listener", "addr", srv.Addr, "error", err)
+			os.Exit(1)
 		}
 	}()
 
 	return srv, shutdownFn
 }
 
-func kiteAuthenticate() *kiteconnect.Client {
-	isAuthenticated = false
+// kiteAuthenticate reuses stored sessions and opens the Kite login page for the default account.
+// It never blocks the MCP server; tools report a login required result until the callback arrives,
+// and other accounts log in on demand through the login tool.
+func kiteAuthenticate(ctx context.Context, cfg internal.Config, z *internal.ZerodhaMcpServer) {
+	for _, account := range z.Accounts() {
+		account.RestoreSession()
+	}
+
+	account := z.DefaultAccount()
+	if account.AuthState() == internal.AuthAuthenticated {
+		return
+	}
+	loginURL := account.BeginLogin()
+
+	waitCtx, cancel := context.WithTimeout(ctx, cfg.AuthTimeout)
+	defer cancel()
 
-	kc := kiteconnect.New(apiKey)
-	webbrowser.Open(kc.GetLoginURL())
+	if cfg.Headless {
+		fmt.Fprintf(os.Stderr, "Open this URL in any browser to log in to Zerodha account %s:\n\n  %s\n\n", account.Name, loginURL)
+		fmt.Fprintln(os.Stderr, "Then paste the redirect URL into the complete_login tool or the terminal prompt.")
+		go promptLogin(ctx, z)
+	} else {
+		if err := webbrowser.Open(loginURL); err != nil {
+			slog.Warn("Unable to open browser", "error", err)
+		}
+		slog.Info("Waiting for authentication from user", "account", account.Name, "login_url", loginURL)
+	}
+
+	if err := account.WaitForLogin(waitCtx); err != nil {
+		slog.Warn("No auth yet for Zerodha, tools will return the login URL until login completes", "account", account.Name, "auth_timeout", cfg.AuthTimeout)
+		account.AbandonLogin()
+	}
+}
 
-	curTime := time.Now()
+// promptLogin reads a pasted redirect URL or request token from the controlling terminal.
+// Stdin and stdout carry the MCP protocol, so the prompt goes through /dev/tty instead.
+func promptLogin(ctx context.Context, z *internal.ZerodhaMcpServer) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		slog.Debug("No terminal available for the login prompt", "error", err)
+		return
+	}
+	go func() {
+		// Unblock the prompt once the login completes through any other route
+		z.DefaultAccount().WaitForLogin(ctx)
+		tty.Close()
+	}()
 
+	scanner := bufio.NewScanner(tty)
 	for {
-		time.Sleep(5 * time.Second)
-		if isAuthenticated {
-			break
-		} else {
-			fmt.Fprintln(os.Stderr, fmt.Sprintf("Waiting for authentication from user. Please authenticate from %s", kc.GetLoginURL()))
+		fmt.Fprint(tty, "Paste the Zerodha redirect URL or request token: ")
+		if !scanner.Scan() {
+			return
+		}
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		if _, err := z.CompletePromptedLogin("", scanner.Text()); err != nil {
+			fmt.Fprintln(tty, "Login failed:", err)
+			continue
 		}
+		fmt.Fprintln(tty, "Zerodha authentication successful")
+		return
+	}
+}
 
-		if time.Since(curTime) > time.Minute*2 {
-			fmt.Fprintln(os.Stderr, "2 mins and no auth yet for Zerodha, Exiting...")
-			os.Exit(1)
+func withAccount() mcp.ToolOption {
+	return mcp.WithString("account",
+		mcp.Description("Name of the Zerodha account to use, see list_accounts. Defaults to the default account."),
+	)
+}
+
+func withAccountOrAll() mcp.ToolOption {
+	return mcp.WithString("account",
+		mcp.Description("Name of the Zerodha account to use, see list_accounts, or \"all\" to aggregate across every logged in account. Defaults to the default account."),
+	)
+}
+
+// withFormat adds the output format and paging arguments of list tools.
+func withFormat() mcp.ToolOption {
+	options := []mcp.ToolOption{
+		mcp.WithString("format",
+			mcp.Description("Output format: json (default), csv or markdown. csv and markdown return one row per item with nested values as JSON."),
+			mcp.Enum(internal.FormatJSON, internal.FormatCSV, internal.FormatMarkdown),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("Cursor returned by a previous call whose output was cut at the response budget. Pass it with otherwise identical arguments to get the next page."),
+		),
+		mcp.WithNumber("max_bytes",
+			mcp.Description("Maximum size of the output in bytes, overriding the server's response budget."),
+			mcp.Min(0),
+		),
+		mcp.WithNumber("max_tokens",
+			mcp.Description("Maximum size of the output in tokens (estimated at 4 bytes per token), overriding the server's response budget."),
+			mcp.Min(0),
+		),
+	}
+	return func(tool *mcp.Tool) {
+		for _, option := range options {
+			option(tool)
 		}
 	}
+}
 
-	data, err := kc.GenerateSession(requestToken, apiSecret)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return nil
+// withQuery adds the arguments of the list query layer: projection, filters, sorting and paging.
+func withQuery() mcp.ToolOption {
+	options := []mcp.ToolOption{
+		mcp.WithString("fields",
+			mcp.Description("Comma separated fields to return, e.g. tradingsymbol,last_price,pnl. Defaults to all fields."),
+		),
+		mcp.WithArray("filter",
+			mcp.Description("Predicates that every returned row must match, e.g. [\"segment=NFO-OPT\", \"expiry<2026-11-30\", \"pnl<0\"]. Operators: = != < <= > >= and ~ / !~ for contains / does not contain. Text compares ignore case for = and !=; dates compare as YYYY-MM-DD."),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("sort_by",
+			mcp.Description("Field to sort by, prefixed with - for descending order, e.g. -pnl."),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of rows to return."),
+			mcp.Min(0),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of matching rows to skip before returning results."),
+			mcp.Min(0),
+		),
+	}
+	return func(tool *mcp.Tool) {
+		for _, option := range options {
+			option(tool)
+		}
 	}
+}
 
-	kc.SetAccessToken(data.AccessToken)
-	return kc
+// withInstruments adds the arguments of the quote tools: one or more instruments, or every
+// instrument held or in an open position.
+func withInstruments() mcp.ToolOption {
+	options := []mcp.ToolOption{
+		mcp.WithString("instrument",
+			mcp.Description("Instrument as `exchange:tradingsymbol`, e.g. NSE:INFY. Several can be given separated by commas."),
+		),
+		mcp.WithArray("instruments",
+			mcp.Description("Instruments as `exchange:tradingsymbol`, e.g. [\"NSE:INFY\", \"NSE:TCS\"]. Large lists are split into batches Kite accepts. Kite has no watchlist API, so pass a watchlist's instruments here."),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("source",
+			mcp.Description("Also include every instrument in the account's holdings, or in its open positions."),
+			mcp.Enum(internal.SourceHoldings, internal.SourcePositions),
+		),
+	}
+	return func(tool *mcp.Tool) {
+		for _, option := range options {
+			option(tool)
+		}
+	}
+}
+
+// withConfirmation adds the confirmation token of tools that preview an action before taking it.
+func withConfirmation() mcp.ToolOption {
+	return mcp.WithString("confirmation_token",
+		mcp.Description("Leave empty to get a preview and a one-time token. After the user approves the preview, repeat the call with exactly the same arguments and this token to execute it."),
+	)
+}
+
+// withOrderFilters adds the filters shared by the order book and the tradebook.
+func withOrderFilters() mcp.ToolOption {
+	options := []mcp.ToolOption{
+		mcp.WithString("symbol",
+			mcp.Description("Only these instruments, as tradingsymbols or `exchange:tradingsymbol`, comma separated."),
+		),
+		mcp.WithString("transaction_type",
+			mcp.Description("Only buys or only sells."),
+			mcp.Enum(internal.TransactionTypes...),
+		),
+		mcp.WithString("from",
+			mcp.Description("Only from this time on, as a time of day in IST such as 09:30 or a date and time."),
+		),
+		mcp.WithString("to",
+			mcp.Description("Only up to this time, in the same forms as from."),
+		),
+	}
+	return func(tool *mcp.Tool) {
+		for _, option := range options {
+			option(tool)
+		}
+	}
+}
+
+// withGTT adds the legs of create_gtt and modify_gtt.
+func withGTT() mcp.ToolOption {
+	options := []mcp.ToolOption{
+		mcp.WithString("type",
+			mcp.Description("single for one trigger, or oco for a stop-loss and a target where the one that triggers cancels the other."),
+			mcp.Enum(internal.GTTTypes...),
+		),
+		mcp.WithString("transaction_type",
+			mcp.Description("Side of the orders placed when the GTT triggers."),
+			mcp.Enum(internal.TransactionTypes...),
+		),
+		mcp.WithNumber("quantity",
+			mcp.Description("Quantity of the orders placed when the GTT triggers."),
+		),
+		mcp.WithString("product",
+			mcp.Description("CNC by default, or NRML."),
+			mcp.Enum(internal.GTTProducts...),
+		),
+		mcp.WithNumber("trigger_price",
+			mcp.Description("Trigger of a single GTT."),
+		),
+		mcp.WithNumber("price",
+			mcp.Description("Limit price of the order a single GTT places."),
+		),
+		mcp.WithNumber("lower_trigger",
+			mcp.Description("Lower trigger of an OCO GTT, below the last price; the stop-loss when selling."),
+		),
+		mcp.WithNumber("lower_price",
+			mcp.Description("Limit price of the order the lower trigger places. For a stop-loss, set it a little below lower_trigger so that it fills in a falling market."),
+		),
+		mcp.WithNumber("upper_trigger",
+			mcp.Description("Upper trigger of an OCO GTT, above the last price; the target when selling."),
+		),
+		mcp.WithNumber("upper_price",
+			mcp.Description("Limit price of the order the upper trigger places."),
+		),
+	}
+	return func(tool *mcp.Tool) {
+		for _, option := range options {
+			option(tool)
+		}
+	}
 }
 
-func mcpMain(ctx context.Context, s *server.MCPServer, kc *kiteconnect.Client) {
-	z = internal.NewZerodhaMcpServer(kc)
+// registerTools adds every tool enabled in the config to the MCP server.
+func registerTools(s *server.MCPServer, z *internal.ZerodhaMcpServer, cfg internal.Config) error {
+	known := map[string]bool{}
+	addTool := func(tool mcp.Tool, handler server.ToolHandlerFunc) {
+		known[tool.Name] = true
+		if cfg.ToolEnabled(tool.Name) {
+			s.AddTool(tool, handler)
+		}
+	}
+
+	loginTool := mcp.NewTool("login",
+		mcp.WithDescription("Log in to Zerodha Kite. Returns the login URL to show to the user. Call again with wait=true to block until the user finishes logging in. Use this when other tools report login_required or an expired session."),
+		withAccount(),
+		mcp.WithBoolean("wait",
+			mcp.Description("Wait for the login callback to complete before returning"),
+		),
+	)
+	addTool(loginTool, z.Login())
+
+	completeLoginTool := mcp.NewTool("complete_login",
+		mcp.WithDescription("Complete a Zerodha login by pasting the URL the browser was redirected to after logging in. Use this in headless mode or when the browser cannot reach the login callback. The URL must be the full redirect URL of the login started with the login tool, including its state."),
+		mcp.WithString("redirect_url",
+			mcp.Required(),
+			mcp.Description("The full redirect URL containing request_token and state"),
+		),
+	)
+	addTool(completeLoginTool, z.ManualLogin())
+
+	listAccountsTool := mcp.NewTool("list_accounts",
+		mcp.WithDescription("List the configured Zerodha accounts with their login status. Use the account names as the account argument of other tools."),
+	)
+	addTool(listAccountsTool, z.ListAccounts())
 
 	kiteHoldingsTool := mcp.NewTool("get_kite_holdings",
 		mcp.WithDescription("Get current holdings in Zerodha Kite account. This includes stocks, ETFs, and other securities traded on NSE/BSE exchanges. Does not include mutual fund holdings."),
+		withAccountOrAll(),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(kiteHoldingsTool, z.KiteHoldingsTool())
+	addTool(kiteHoldingsTool, z.KiteHoldingsTool())
 
 	auctionInstrumentsTool := mcp.NewTool("get_auction_instruments",
 		mcp.WithDescription("Retrieves list of available instruments for a auction session"),
+		withAccount(),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(auctionInstrumentsTool, z.AuctionInstrumentsTool())
+	addTool(auctionInstrumentsTool, z.AuctionInstrumentsTool())
 
 	positionsTool := mcp.NewTool("get_positions",
 		mcp.WithDescription("Get current day and net positions in your Zerodha account. Day positions show intraday trades, while net positions show delivery holdings and carried forward F&O positions. Includes quantity, average price, PnL and more details for each position."),
+		withAccountOrAll(),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(positionsTool, z.Positions())
+	addTool(positionsTool, z.Positions())
 
 	orderMarginsTool := mcp.NewTool("get_order_margins",
 		mcp.WithDescription("Get order margins for a specific instrument. This tool helps you check the margin requirements for placing orders on Zerodha. It provides the necessary information to ensure you have enough margin to execute trades."),
+		withAccount(),
 		mcp.WithString("exchange",
 			mcp.Required(),
 			mcp.Description("The exchange value"),
@@ -201,150 +443,598 @@ func mcpMain(ctx context.Context, s *server.MCPServer, kc *kiteconnect.Client) {
 			mcp.Required(),
 			mcp.Description("Trigger Price"),
 		),
+		withFormat(),
 	)
-	s.AddTool(orderMarginsTool, z.OrderMargins())
+	addTool(orderMarginsTool, z.OrderMargins())
 
-	quoteTool := mcp.NewTool("get_quote",
-		mcp.WithDescription("Get quote for a specific instrument. This tool provides real-time market data for stocks, ETFs, and other securities traded on NSE/BSE exchanges."),
+	placeOrderTool := mcp.NewTool("place_order",
+		mcp.WithDescription("Place an order. The first call only returns a preview with the resolved instrument, estimated value, margin, charges and resulting position, plus a one-time confirmation token. Nothing is sent to the exchange until the call is repeated with that token, which must only be done after the user approves the preview."),
+		withAccount(),
+		mcp.WithString("instrument",
+			mcp.Required(),
+			mcp.Description("Instrument as `exchange:tradingsymbol`, e.g. NSE:INFY. Use search_instruments to find it."),
+		),
+		mcp.WithString("transaction_type",
+			mcp.Required(),
+			mcp.Enum(internal.TransactionTypes...),
+		),
+		mcp.WithNumber("quantity",
+			mcp.Required(),
+			mcp.Description("Quantity in units; for derivatives a multiple of the lot size."),
+			mcp.Min(1),
+		),
+		mcp.WithString("product",
+			mcp.Required(),
+			mcp.Description("CNC for delivery, MIS for intraday, NRML for overnight derivatives, MTF for margin trading."),
+			mcp.Enum(internal.OrderProducts...),
+		),
+		mcp.WithString("order_type",
+			mcp.Description("MARKET by default. LIMIT needs price, SL needs price and trigger_price, SL-M needs trigger_price."),
+			mcp.Enum(internal.OrderTypes...),
+		),
+		mcp.WithNumber("price",
+			mcp.Description("Limit price, a multiple of the tick size."),
+		),
+		mcp.WithNumber("trigger_price",
+			mcp.Description("Trigger price of SL and SL-M orders, or the stop loss of a cover order."),
+		),
+		mcp.WithString("variety",
+			mcp.Description("regular by default; amo for after market orders, co for cover orders, iceberg to split a large order into legs."),
+			mcp.Enum(internal.OrderVarieties...),
+		),
+		mcp.WithString("validity",
+			mcp.Description("DAY by default, IOC, or TTL with validity_ttl."),
+			mcp.Enum(internal.OrderValidities...),
+		),
+		mcp.WithNumber("validity_ttl",
+			mcp.Description("Minutes the order stays open with TTL validity."),
+		),
+		mcp.WithNumber("disclosed_quantity",
+			mcp.Description("Quantity disclosed to the market, for equity orders."),
+		),
+		mcp.WithNumber("iceberg_legs",
+			mcp.Description("Number of legs of an iceberg order, 2 to 50."),
+		),
+		mcp.WithNumber("iceberg_quantity",
+			mcp.Description("Quantity of each leg of an iceberg order."),
+		),
+		mcp.WithString("tag",
+			mcp.Description("Optional tag of up to 20 characters to identify the order."),
+		),
+		withConfirmation(),
+	)
+	addTool(placeOrderTool, z.PlaceOrder())
+
+	modifyOrderTool := mcp.NewTool("modify_order",
+		mcp.WithDescription("Modify an open order. Only the given fields change. The first call returns a preview of the changes with a one-time confirmation token; the change is only sent when the call is repeated with that token after the user approves."),
+		withAccount(),
+		mcp.WithString("order_id",
+			mcp.Required(),
+			mcp.Description("ID of the order to modify."),
+		),
+		mcp.WithNumber("quantity",
+			mcp.Description("New quantity."),
+		),
+		mcp.WithString("order_type",
+			mcp.Description("New order type."),
+			mcp.Enum(internal.OrderTypes...),
+		),
+		mcp.WithNumber("price",
+			mcp.Description("New limit price."),
+		),
+		mcp.WithNumber("trigger_price",
+			mcp.Description("New trigger price."),
+		),
+		mcp.WithString("validity",
+			mcp.Description("New validity."),
+			mcp.Enum(internal.OrderValidities...),
+		),
+		mcp.WithNumber("validity_ttl",
+			mcp.Description("New TTL in minutes."),
+		),
+		mcp.WithNumber("disclosed_quantity",
+			mcp.Description("New disclosed quantity."),
+		),
+		withConfirmation(),
+	)
+	addTool(modifyOrderTool, z.ModifyOrder())
+
+	cancelOrderTool := mcp.NewTool("cancel_order",
+		mcp.WithDescription("Cancel an open order. The first call returns a preview of the order with a one-time confirmation token; the order is only cancelled when the call is repeated with that token after the user approves."),
+		withAccount(),
+		mcp.WithString("order_id",
+			mcp.Required(),
+			mcp.Description("ID of the order to cancel."),
+		),
+		withConfirmation(),
+	)
+	addTool(cancelOrderTool, z.CancelOrder())
+
+	ordersTool := mcp.NewTool("get_orders",
+		mcp.WithDescription("Get today's orders with their status, fills and the exchange's message. The summary counts orders by status and repeats why any order was rejected."),
+		withAccount(),
+		mcp.WithString("status",
+			mcp.Description("Only orders in these states, comma separated, e.g. COMPLETE, REJECTED, CANCELLED or TRIGGER PENDING. `open` selects every order that can still be modified or cancelled."),
+		),
+		withOrderFilters(),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(ordersTool, z.Orders())
+
+	orderHistoryTool := mcp.NewTool("get_order_history",
+		mcp.WithDescription("Get every state an order went through, e.g. OPEN PENDING, TRIGGER PENDING, REJECTED, with the exchange's message at each step. Use it to find out why an order was rejected or cancelled."),
+		withAccount(),
+		mcp.WithString("order_id",
+			mcp.Required(),
+			mcp.Description("ID of the order, from get_orders or place_order."),
+		),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(orderHistoryTool, z.OrderHistory())
+
+	tradesTool := mcp.NewTool("get_trades",
+		mcp.WithDescription("Get today's trades, the fills of executed orders. The summary totals the value bought and sold."),
+		withAccount(),
+		withOrderFilters(),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(tradesTool, z.Trades())
+
+	orderTradesTool := mcp.NewTool("get_order_trades",
+		mcp.WithDescription("Get the trades that filled one order, with the quantity and price of each fill."),
+		withAccount(),
+		mcp.WithString("order_id",
+			mcp.Required(),
+			mcp.Description("ID of the order."),
+		),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(orderTradesTool, z.OrderTrades())
+
+	gttsTool := mcp.NewTool("get_gtts",
+		mcp.WithDescription("Get the GTT (Good Till Triggered) orders of the account with their triggers, limit prices and status."),
+		withAccount(),
+		mcp.WithString("status",
+			mcp.Description("Only GTTs in these states, comma separated: active, triggered, disabled, expired, cancelled, rejected or deleted."),
+		),
+		mcp.WithString("symbol",
+			mcp.Description("Only GTTs on these instruments, as tradingsymbols or `exchange:tradingsymbol`, comma separated."),
+		),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(gttsTool, z.GTTs())
+
+	gttTool := mcp.NewTool("get_gtt",
+		mcp.WithDescription("Get one GTT with its condition, the orders it places and why it was rejected, if it was."),
+		withAccount(),
+		mcp.WithNumber("trigger_id",
+			mcp.Required(),
+			mcp.Description("ID of the GTT."),
+		),
+	)
+	addTool(gttTool, z.GTT())
+
+	createGTTTool := mcp.NewTool("create_gtt",
+		mcp.WithDescription("Create a single or OCO GTT that places limit orders when the price reaches its triggers. The first call returns a preview with a one-time confirmation token; the GTT is only created when the call is repeated with that token after the user approves."),
+		withAccount(),
 		mcp.WithString("instrument",
 			mcp.Required(),
-			mcp.Description("format of `exchange:tradingsymbol`"),
+			mcp.Description("Instrument as `exchange:tradingsymbol`, e.g. NSE:INFY."),
+		),
+		withGTT(),
+		withConfirmation(),
+	)
+	addTool(createGTTTool, z.CreateGTT())
+
+	modifyGTTTool := mcp.NewTool("modify_gtt",
+		mcp.WithDescription("Modify an active GTT. Only the given fields change. The first call returns a preview of the changes with a one-time confirmation token; the change is only sent when the call is repeated with that token after the user approves."),
+		withAccount(),
+		mcp.WithNumber("trigger_id",
+			mcp.Required(),
+			mcp.Description("ID of the GTT to modify."),
+		),
+		withGTT(),
+		withConfirmation(),
+	)
+	addTool(modifyGTTTool, z.ModifyGTT())
+
+	deleteGTTTool := mcp.NewTool("delete_gtt",
+		mcp.WithDescription("Delete a GTT. The first call returns a preview with a one-time confirmation token; the GTT is only deleted when the call is repeated with that token after the user approves."),
+		withAccount(),
+		mcp.WithNumber("trigger_id",
+			mcp.Required(),
+			mcp.Description("ID of the GTT to delete."),
+		),
+		withConfirmation(),
+	)
+	addTool(deleteGTTTool, z.DeleteGTT())
+
+	proposeGTTsTool := mcp.NewTool("propose_gtts",
+		mcp.WithDescription("Propose OCO stop-loss and target GTTs for every holding without an active stop-loss GTT, one with a SELL leg that triggers below the last price. Nothing is created: each proposal holds the create_gtt arguments, to be created one by one after the user approves them."),
+		withAccount(),
+		mcp.WithString("rule",
+			mcp.Description("percent (default) places the stop-loss and target a percentage from the last price, atr a multiple of the daily average true range."),
+			mcp.Enum(internal.GTTRules...),
+		),
+		mcp.WithNumber("stoploss_pct",
+			mcp.Description("Stop-loss trigger this many percent below the last price, 5 by default."),
+		),
+		mcp.WithNumber("target_pct",
+			mcp.Description("Target trigger this many percent above the last price, 10 by default."),
+		),
+		mcp.WithNumber("atr_period",
+			mcp.Description("Days of the ATR, 14 by default."),
+		),
+		mcp.WithNumber("stoploss_atr",
+			mcp.Description("Stop-loss trigger this many ATRs below the last price, 2 by default."),
+		),
+		mcp.WithNumber("target_atr",
+			mcp.Description("Target trigger this many ATRs above the last price, 4 by default."),
+		),
+		mcp.WithNumber("limit_offset_pct",
+			mcp.Description("Limit price of the stop-loss this many percent below its trigger, so that it fills in a falling market, 0.5 by default."),
 		),
+		mcp.WithString("symbol",
+			mcp.Description("Only these holdings, as tradingsymbols or `exchange:tradingsymbol`, comma separated."),
+		),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(quoteTool, z.Quote())
+	addTool(proposeGTTsTool, z.ProposeGTTs())
+
+	quoteTool := mcp.NewTool("get_quote",
+		mcp.WithDescription("Get quotes for one or more instruments, or for every holding or open position. This tool provides real-time market data for stocks, ETFs, and other securities traded on NSE/BSE exchanges, returned as one table."),
+		withAccount(),
+		withInstruments(),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(quoteTool, z.Quote())
 
 	ltpTool := mcp.NewTool("get_ltp",
-		mcp.WithDescription("Get Last Traded Price (LTP) for a specific instrument. This tool provides the latest price at which the instrument was traded in the market."),
+		mcp.WithDescription("Get Last Traded Price (LTP) for one or more instruments, or for every holding or open position. This tool provides the latest price at which each instrument was traded in the market."),
+		withAccount(),
+		withInstruments(),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(ltpTool, z.LTP())
+
+	ohlcTool := mcp.NewTool("get_ohlc",
+		mcp.WithDescription("Get Open, High, Low, Close (OHLC) quotes with the last price and change for one or more instruments, or for every holding or open position."),
+		withAccount(),
+		withInstruments(),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(ohlcTool, z.OHLC())
+
+	historicalData := mcp.NewTool("get_historical_data",
+		mcp.WithDescription("Get historical OHLCV candles for an instrument. Long ranges are split into several Kite requests automatically and merged. Minute candles go back about 60 days per request, so prefer day candles for long ranges."),
+		withAccount(),
 		mcp.WithString("instrument",
 			mcp.Required(),
-			mcp.Description("format of `exchange:tradingsymbol`"),
+			mcp.Description("Instrument as `exchange:tradingsymbol`, e.g. NSE:INFY, or its instrument token. Use search_instruments to find it."),
+		),
+		mcp.WithString("interval",
+			mcp.Description("Candle interval, day by default."),
+			mcp.Enum(internal.HistoricalIntervals...),
+		),
+		mcp.WithString("from",
+			mcp.Required(),
+			mcp.Description("Start of the range in IST, `YYYY-MM-DD` or `YYYY-MM-DD HH:MM:SS`."),
+		),
+		mcp.WithString("to",
+			mcp.Description("End of the range in IST, `YYYY-MM-DD` (the whole day) or `YYYY-MM-DD HH:MM:SS`. Defaults to now."),
+		),
+		mcp.WithBoolean("continuous",
+			mcp.Description("Stitch expired futures contracts into a continuous series. Only for day candles of futures."),
+		),
+		mcp.WithBoolean("oi",
+			mcp.Description("Include open interest for derivatives."),
+		),
+		mcp.WithString("resample",
+			mcp.Description("Aggregate the candles into a longer interval, e.g. minute candles into 15minute, or day candles into week or month. Weeks start on Monday."),
+			mcp.Enum(internal.ResampleTargets...),
+		),
+		mcp.WithBoolean("summary",
+			mcp.Description("Return period return, high and low with dates, average volume, max drawdown and volatility with a small sample of candles, instead of every candle."),
+		),
+		mcp.WithNumber("sample",
+			mcp.Description("Number of evenly spaced candles in the summary sample, 10 by default."),
+			mcp.Min(0),
 		),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(ltpTool, z.LTP())
+	addTool(historicalData, z.HistoricalData())
 
-	ohlcTool := mcp.NewTool("get_ohlc",
-		mcp.WithDescription("Get Open, High, Low, Close (OHLC) quotes for a specific instrument. This tool provides the historical price data for the instrument over a specific time period."),
+	indicators := mcp.NewTool("get_indicators",
+		mcp.WithDescription("Compute technical indicators (SMA, EMA, RSI, MACD, Bollinger Bands, ATR, VWAP, SuperTrend) from historical candles. Returns the latest values and a short recent series."),
+		withAccount(),
 		mcp.WithString("instrument",
 			mcp.Required(),
-			mcp.Description("format of `exchange:tradingsymbol`"),
+			mcp.Description("Instrument as `exchange:tradingsymbol`, e.g. NSE:INFY, or its instrument token. Use search_instruments to find it."),
+		),
+		mcp.WithString("interval",
+			mcp.Description("Candle interval, day by default."),
+			mcp.Enum(internal.HistoricalIntervals...),
+		),
+		mcp.WithArray("indicators",
+			mcp.Description("Indicators to compute, all by default. Parameters follow the name as in the result columns, e.g. `ema_50`, `rsi_14`, `macd_12_26_9`, `bollinger_20_2`, `atr_14`, `supertrend_10_3`. Defaults: "+
+				"sma 20, ema 20, rsi 14, macd 12/26/9, bollinger 20/2, atr 14, supertrend 10/3. VWAP restarts every session, so use it with intraday intervals."),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithNumber("points",
+			mcp.Description("Number of recent candles in the series, 5 by default, at most 200."),
+			mcp.Min(1),
+			mcp.Max(200),
+		),
+		mcp.WithString("from",
+			mcp.Description("Start of the candles in IST, `YYYY-MM-DD` or `YYYY-MM-DD HH:MM:SS`. Defaults to enough history for the indicators to settle."),
+		),
+		mcp.WithString("to",
+			mcp.Description("End of the candles in IST, `YYYY-MM-DD` (the whole day) or `YYYY-MM-DD HH:MM:SS`. Defaults to now."),
+		),
+		mcp.WithBoolean("continuous",
+			mcp.Description("Stitch expired futures contracts into a continuous series. Only for day candles of futures."),
 		),
 	)
-	s.AddTool(ohlcTool, z.OHLC())
+	addTool(indicators, z.Indicators())
 
-	// TODO: Complete Historical data tool. Need a way to consume huge amount of data.
+	chart := mcp.NewTool("chart",
+		mcp.WithDescription("Render a candlestick or line chart of an instrument as a PNG image, with optional moving average, Bollinger, VWAP or SuperTrend overlays, volume bars and markers for today's trades."),
+		withAccount(),
+		mcp.WithString("instrument",
+			mcp.Required(),
+			mcp.Description("Instrument as `exchange:tradingsymbol`, e.g. NSE:INFY, or its instrument token. Use search_instruments to find it."),
+		),
+		mcp.WithString("interval",
+			mcp.Description("Candle interval, day by default."),
+			mcp.Enum(internal.HistoricalIntervals...),
+		),
+		mcp.WithString("type",
+			mcp.Description("Chart type, candlestick by default."),
+			mcp.Enum(internal.ChartCandlestick, internal.ChartLine),
+		),
+		mcp.WithNumber("candles",
+			mcp.Description("Number of most recent candles to draw, 120 by default, at most 1000."),
+			mcp.Min(1),
+			mcp.Max(1000),
+		),
+		mcp.WithArray("overlays",
+			mcp.Description("Indicators drawn over the price, named like get_indicators columns, e.g. `sma_20`, `ema_50`, `bollinger_20_2`, `vwap`, `supertrend_10_3`."),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithBoolean("volume",
+			mcp.Description("Draw volume bars under the price, true by default."),
+		),
+		mcp.WithBoolean("trades",
+			mcp.Description("Mark this account's trades in the instrument from today's tradebook."),
+		),
+		mcp.WithString("from",
+			mcp.Description("Start of the candles in IST, `YYYY-MM-DD` or `YYYY-MM-DD HH:MM:SS`. Defaults to enough history for the candles and overlays."),
+		),
+		mcp.WithString("to",
+			mcp.Description("End of the candles in IST, `YYYY-MM-DD` (the whole day) or `YYYY-MM-DD HH:MM:SS`. Defaults to now."),
+		),
+		mcp.WithBoolean("continuous",
+			mcp.Description("Stitch expired futures contracts into a continuous series. Only for day candles of futures."),
+		),
+		mcp.WithNumber("width",
+			mcp.Description("Image width in pixels, 1000 by default."),
+			mcp.Min(400),
+			mcp.Max(2000),
+		),
+		mcp.WithNumber("height",
+			mcp.Description("Image height in pixels, 600 by default."),
+			mcp.Min(300),
+			mcp.Max(1200),
+		),
+	)
+	addTool(chart, z.Chart())
 
 	instrumentsTool := mcp.NewTool("get_instruments",
 		mcp.WithDescription("Get list of all available instruments on Zerodha. This tool provides a comprehensive list of all the instruments that can be traded on Zerodha, including stocks, ETFs, futures, options, and more."),
+		withAccount(),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(instrumentsTool, z.Instruments())
+	addTool(instrumentsTool, z.Instruments())
 
 	instrumentsByExchange := mcp.NewTool("get_instruments_by_exchange",
 		mcp.WithDescription("Get list of instruments by exchange. This tool allows you to filter and retrieve specific instruments based on the exchange they are traded on."),
+		withAccount(),
 		mcp.WithString("exchange",
 			mcp.Required(),
 			mcp.Description("The exchange value"),
 			mcp.Enum("nse", "bse"),
 		),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(instrumentsByExchange, z.InstrumentsByExchange())
+
+	searchInstruments := mcp.NewTool("search_instruments",
+		mcp.WithDescription("Search the instrument master by company name, trading symbol or ISIN and return the best matching instruments with their exchange:tradingsymbol, instrument token, lot size, tick size and expiry. Understands option shorthand such as \"nifty 24000 CE november\" or \"banknifty fut dec 2026\". Use it to find the exact instrument for get_quote, get_ltp and other tools."),
+		withAccount(),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("What to look for, e.g. \"Reliance\", \"HDFC bank\", \"INE009A01021\" or \"nifty 24000 CE november\". An exchange (NSE, BSE, NFO, ...) in the query restricts the search to it."),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Number of candidates to return, 10 by default and at most 50."),
+			mcp.Min(1),
+			mcp.Max(50),
+		),
+		withFormat(),
 	)
-	s.AddTool(instrumentsByExchange, z.InstrumentsByExchange())
+	addTool(searchInstruments, z.SearchInstruments())
 
 	mfInstruments := mcp.NewTool("get_mf_instruments",
 		mcp.WithDescription("Get list of all available mutual fund instruments on Zerodha. This tool provides a comprehensive list of all the mutual fund instruments that can be traded on Zerodha."),
+		withAccount(),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(mfInstruments, z.MFInstruments())
+	addTool(mfInstruments, z.MFInstruments())
 
 	mfOrders := mcp.NewTool("get_mf_orders",
 		mcp.WithDescription("Get list of all Mutual Fund orders. This tool provides a comprehensive list of all the mutual fund orders that can be traded on Zerodha."),
+		withAccount(),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(mfOrders, z.MFOrders())
+	addTool(mfOrders, z.MFOrders())
 
 	mfOrderInfo := mcp.NewTool("get_mf_order_info",
 		mcp.WithDescription("Get individual mutual fund order info. This tool provides detailed information about a specific mutual fund order, including the order ID, status, and other relevant details."),
+		withAccount(),
 		mcp.WithString("orderId",
 			mcp.Required(),
 			mcp.Description("The Order ID of the mutual fund"),
 		))
-	s.AddTool(mfOrderInfo, z.MFOrderInfo())
+	addTool(mfOrderInfo, z.MFOrderInfo())
 
 	mfSipInfo := mcp.NewTool("get_mf_sip_info",
 		mcp.WithDescription("Get individual mutual fund SIP info. This tool provides detailed information about a specific mutual fund SIP, including the SIP ID, status, and other relevant details."),
+		withAccount(),
 		mcp.WithString("sipId",
 			mcp.Required(),
 			mcp.Description("The SIP ID of the mutual fund"),
 		))
-	s.AddTool(mfSipInfo, z.MfSipInfo())
+	addTool(mfSipInfo, z.MfSipInfo())
 
 	mfHoldings := mcp.NewTool("get_mf_holdings",
 		mcp.WithDescription("Get list of Mutual fund holdings for a user. This tool provides a comprehensive list of all the mutual fund holdings that can be traded on Zerodha."),
+		withAccount(),
+		withFormat(),
+		withQuery(),
 	)
-	s.AddTool(mfHoldings, z.MFHoldings())
+	addTool(mfHoldings, z.MFHoldings())
 
 	mfHoldingsInfo := mcp.NewTool("get_mf_holdings_info",
 		mcp.WithDescription("Get individual mutual fund holdings info. This tool provides detailed information about a specific mutual fund holding, including the holding ID, status, and other relevant details."),
+		withAccount(),
 		mcp.WithString("isin",
 			mcp.Required(),
 			mcp.Description("The ISIN of the mutual fund holding"),
 		))
-	s.AddTool(mfHoldingsInfo, z.MFHoldingInfo())
+	addTool(mfHoldingsInfo, z.MFHoldingInfo())
 
 	mfAllottedIsins := mcp.NewTool("get_mf_allotted_isins",
-		mcp.WithDescription("Get Allotted mutual fund ISINs. This tool provides a comprehensive list of all the mutual fund ISINs that can be traded on Zerodha."))
-	s.AddTool(mfAllottedIsins, z.MFAllottedISINs())
+		mcp.WithDescription("Get Allotted mutual fund ISINs. This tool provides a comprehensive list of all the mutual fund ISINs that can be traded on Zerodha."),
+		withAccount(),
+		withFormat(),
+		withQuery(),
+	)
+	addTool(mfAllottedIsins, z.MFAllottedISINs())
 
 	userProfile := mcp.NewTool("get_user_profile",
 		mcp.WithDescription("Get basic user profile. This tool provides basic information about the user, including the user ID, name, and other relevant details."),
+		withAccount(),
 	)
-	s.AddTool(userProfile, z.UserProfile())
+	addTool(userProfile, z.UserProfile())
 
 	// TODO: Figure out the right permissions for this
 	//fullUserProfile := mcp.NewTool("get_full_user_profile",
 	//	mcp.WithDescription("get full user profile"))
-	//s.AddTool(fullUserProfile, z.FullUserProfile())
+	//addTool(fullUserProfile, z.FullUserProfile())
 
 	userMargins := mcp.NewTool("get_user_margins",
-		mcp.WithDescription("Get all user margins. This tool provides a comprehensive list of all the margins that can be traded on Zerodha."))
-	s.AddTool(userMargins, z.UserMargins())
+		mcp.WithDescription("Get all user margins. This tool provides a comprehensive list of all the margins that can be traded on Zerodha."),
+		withAccountOrAll(),
+		withFormat(),
+	)
+	addTool(userMargins, z.UserMargins())
 
 	userSegmentMargins := mcp.NewTool("get_user_segment_margins",
 		mcp.WithDescription("Get segment wise user margins. This tool provides a comprehensive list of all the margins that can be traded on Zerodha."),
+		withAccount(),
 		mcp.WithString("segment",
 			mcp.Required(),
 			mcp.Description("segment of the mutual fund holding"),
 		),
 	)
-	s.AddTool(userSegmentMargins, z.UserSegmentMargins())
+	addTool(userSegmentMargins, z.UserSegmentMargins())
+
+	for _, name := range cfg.EnabledTools {
+		if !known[name] {
+			return fmt.Errorf("enabled_tools: unknown tool %q", name)
+		}
+	}
+	for _, name := range cfg.DisabledTools {
+		if !known[name] {
+			return fmt.Errorf("disabled_tools: unknown tool %q", name)
+		}
+	}
+	return nil
+}
 
+func mcpMain(ctx context.Context, s *server.MCPServer, cfg internal.Config) {
 	// Start the server and handle interruption via context
 	go func() {
 		<-ctx.Done()
 		// This will only happen when ctx is cancelled - implement any cleanup needed here
-		log.Println("MCP server received shutdown signal")
+		slog.Info("MCP server received shutdown signal")
 	}()
 
+	if cfg.Transport == internal.TransportSSE {
+		if err := internal.ServeSSE(ctx, s, cfg); err != nil {
+			slog.Error("Server error", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := server.ServeStdio(s); err != nil {
-		log.Fatalf("Server error: %v", err)
+		slog.Error("Server error", "error", err)
+		os.Exit(1)
 	}
 }
 
 func main() {
-	setEnvs()
+	cfg, err := internal.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	level, _ := cfg.SlogLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	z := internal.NewZerodhaMcpServer(cfg)
+
 	s := server.NewMCPServer(
 		"Zerodha MCP Server",
 		"0.0.1",
 		server.WithResourceCapabilities(true, true),
 		server.WithLogging(),
 		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(z.AuthMiddleware),
 	)
+	if err := registerTools(s, z, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if cfg.ReadOnly {
+		slog.Info("Read-only mode, tools that change orders or GTTs are disabled")
+	}
 
 	// Start the router and get the shutdown function
-	_, httpShutdownFn := startRouter()
-
-	kc := kiteAuthenticate()
-	fmt.Fprintln(os.Stderr, "Zerodha authentication successful, starting MCP Server...")
+	_, httpShutdownFn := startRouter(cfg, z)
 
 	// Create a context that can be cancelled
 	ctx, cancel := context.WithCancel(context.Background())
@@ -353,12 +1043,14 @@ func main() {
 	mcpDone := make(chan struct{})
 	go func() {
 		defer close(mcpDone)
-		mcpMain(ctx, s, kc)
+		mcpMain(ctx, s, cfg)
 	}()
 
+	go kiteAuthenticate(ctx, cfg, z)
+
 	// Wait for quit signal
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
 
 	// Cancel the context to signal all operations to stop
 	cancel()
@@ -369,11 +1061,11 @@ func main() {
 	// Wait for the MCP server to finish or timeout
 	select {
 	case <-mcpDone:
-		log.Println("MCP server stopped")
+		slog.Info("MCP server stopped")
 	case <-time.After(5 * time.Second):
-		log.Println("MCP server shutdown timed out")
+		slog.Warn("MCP server shutdown timed out")
 	}
 
-	log.Println("Server exiting")
+	slog.Info("Server exiting")
 	os.Exit(0)
 }
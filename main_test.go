@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sukeesh/zerodha-mcp/internal"
+)
+
+func TestAuthCallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	z := internal.NewZerodhaMcpServer(internal.Config{APIKey: "key", APISecret: "secret"})
+	r := gin.New()
+	r.GET("/auth", authCallback(z))
+
+	callback := func(query string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth?"+query, nil))
+		return w.Code
+	}
+
+	if got := callback("request_token=abc123&state=anything"); got != http.StatusGone {
+		t.Errorf("callback without a pending login: got %d, want %d", got, http.StatusGone)
+	}
+
+	account := z.DefaultAccount()
+	loginURL, err := url.Parse(account.BeginLogin())
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := url.ParseQuery(loginURL.Query().Get("redirect_params"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := redirect.Get("state")
+	if state == "" {
+		t.Fatalf("login URL %s carries no state", loginURL)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "no request token", query: "state=" + state, want: http.StatusBadRequest},
+		{name: "no state", query: "request_token=abc123", want: http.StatusForbidden},
+		{name: "wrong state", query: "request_token=abc123&state=" + state + "0", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := callback(tt.query); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	// Rejected callbacks leave the attempt pending, with the same nonce
+	if !account.LoginPending() || account.LoginURL() != loginURL.String() {
+		t.Fatal("a rejected callback changed the pending login")
+	}
+
+	account.AbandonLogin()
+	if got := callback("request_token=abc123&state=" + state); got != http.StatusGone {
+		t.Errorf("callback after the login was abandoned: got %d, want %d", got, http.StatusGone)
+	}
+}
+
+// registeredTools returns the names of the tools registerTools adds for cfg, as listed to a client.
+func registeredTools(t *testing.T, cfg internal.Config) ([]string, error) {
+	t.Helper()
+	cfg.APIKey, cfg.APISecret = "key", "secret"
+	s := server.NewMCPServer("test", "0.0.1")
+	if err := registerTools(s, internal.NewZerodhaMcpServer(cfg), cfg); err != nil {
+		return nil, err
+	}
+
+	response := s.HandleMessage(context.Background(), json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Result mcp.ListToolsResult `json:"result"`
+	}
+	if err := json.Unmarshal(encoded, &list); err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(list.Result.Tools))
+	for _, tool := range list.Result.Tools {
+		names = append(names, tool.Name)
+	}
+	return names, nil
+}
+
+func TestRegisterTools(t *testing.T) {
+	all, err := registeredTools(t, internal.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range internal.MutationTools {
+		if !slices.Contains(all, name) {
+			t.Errorf("mutation tool %q is not a registered tool", name)
+		}
+	}
+
+	readOnly, err := registeredTools(t, internal.Config{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range all {
+		changesOrders := slices.ContainsFunc([]string{"place_", "modify_", "cancel_", "create_", "delete_"}, func(prefix string) bool {
+			return strings.HasPrefix(name, prefix)
+		})
+		if got := slices.Contains(readOnly, name); got == changesOrders {
+			t.Errorf("read-only mode: %q registered = %v, want %v", name, got, !changesOrders)
+		}
+	}
+
+	enabled, err := registeredTools(t, internal.Config{EnabledTools: []string{"get_quote", "get_ltp", "place_order"}, DisabledTools: []string{"place_order"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Sort(enabled); !slices.Equal(enabled, []string{"get_ltp", "get_quote"}) {
+		t.Errorf("enabled_tools without the disabled one: got %v", enabled)
+	}
+
+	disabled, err := registeredTools(t, internal.Config{DisabledTools: []string{"chart"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disabled) != len(all)-1 || slices.Contains(disabled, "chart") {
+		t.Errorf("disabled_tools: got %d tools, want all %d but chart", len(disabled), len(all))
+	}
+
+	tests := []struct {
+		name    string
+		cfg     internal.Config
+		wantErr string
+	}{
+		{name: "unknown enabled tool", cfg: internal.Config{EnabledTools: []string{"get_quote", "get_quotes"}}, wantErr: `enabled_tools: unknown tool "get_quotes"`},
+		{name: "unknown disabled tool", cfg: internal.Config{DisabledTools: []string{"place_orders"}}, wantErr: `disabled_tools: unknown tool "place_orders"`},
+	}
+	for _, tt := range tests {
+		if _, err := registeredTools(t, tt.cfg); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}